@@ -0,0 +1,421 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// aggCmd represents the agg command
+var aggCmd = &cobra.Command{
+	Use:   "agg",
+	Short: "Run aggregations on an index",
+	Long: `Run aggregations on an index, without returning any hits, and write the buckets as an
+	indented table, with a row for each bucket and its sub-buckets below it, or as CSV, with
+	a row for each innermost bucket and a column for the key of each level, or as JSON.
+
+	The aggregations can be read from a JSON file with --query; it may hold just the
+	aggregations, or a search body with an "aggs" key and a "query":
+	$ opensearch-doc agg -i logs --query agg.json
+	or built from flags: each --terms, --date-histogram, and --histogram adds a level of
+	buckets within the one before, in the order given, and each --metric is computed for the
+	innermost buckets, or for the whole index if there are none. --q limits the documents
+	with a query string.
+	$ opensearch-doc agg -i logs --date-histogram @timestamp:1d --terms status --metric avg:latency
+
+	--terms takes a field and, optionally, the number of buckets, as status:20 (default 10);
+	--date-histogram a field and an interval, as @timestamp:1d, which is a calendar interval
+	for a single unit (1m, 1h, 1d, 1w, 1M, 1q, 1y) and a fixed one otherwise, as 15m;
+	--histogram a numeric field and an interval, as price:100; and --metric an aggregation
+	and a field, as avg:price, where the aggregation may be avg, sum, min, max, cardinality,
+	value_count, stats, or percentiles.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, _ := cmd.Flags().GetString("index")
+		query, _ := cmd.Flags().GetString("query")
+		q, _ := cmd.Flags().GetString("q")
+		metrics, _ := cmd.Flags().GetStringArray("metric")
+		format, _ := cmd.Flags().GetString("format")
+		Agg(AggOptions{
+			Index:   index,
+			Query:   query,
+			Q:       q,
+			Buckets: aggBuckets,
+			Metrics: metrics,
+			Format:  format,
+		})
+	},
+}
+
+// aggBuckets are the bucket levels of the --terms, --date-histogram, and
+// --histogram flags, in the order given.
+var aggBuckets []bucketLevel
+
+func init() {
+	rootCmd.AddCommand(aggCmd)
+
+	aggCmd.Flags().StringP("index", "i", "", "The index (or comma-separated indices or wildcard) to aggregate")
+	aggCmd.Flags().String("query", "", "A JSON file of the aggregations, or of a search body with them; - for stdin")
+	aggCmd.Flags().String("q", "", "A query string selecting the documents, as in 'status:active'")
+	aggCmd.Flags().Var(&bucketFlag{"terms", &aggBuckets}, "terms", "A level of buckets by the terms of a field, as field[:size]; may be repeated")
+	aggCmd.Flags().Var(&bucketFlag{"date_histogram", &aggBuckets}, "date-histogram", "A level of buckets by date, as field:interval; may be repeated")
+	aggCmd.Flags().Var(&bucketFlag{"histogram", &aggBuckets}, "histogram", "A level of buckets by a numeric field, as field:interval; may be repeated")
+	aggCmd.Flags().StringArray("metric", nil, "A metric of the innermost buckets, as aggregation:field; may be repeated")
+	aggCmd.Flags().String("format", "table", "The output format: table, csv, or json")
+	aggCmd.MarkFlagRequired("index")
+}
+
+// bucketLevel is a level of buckets given by a flag.
+type bucketLevel struct {
+	kind string // terms, date_histogram, or histogram
+	spec string // The field and its parameter, as field:parameter
+}
+
+// bucketFlag is a flag adding a level of buckets of a kind, so that the
+// levels of all the bucket flags are kept in the order given.
+type bucketFlag struct {
+	kind   string
+	levels *[]bucketLevel
+}
+
+func (f *bucketFlag) String() string { return "" }
+func (f *bucketFlag) Type() string   { return "field" }
+
+func (f *bucketFlag) Set(value string) error {
+	*f.levels = append(*f.levels, bucketLevel{f.kind, value})
+	return nil
+}
+
+// AggOptions holds the settings for running aggregations.
+type AggOptions struct {
+	Index   string        // The index to aggregate
+	Query   string        // A JSON file of the aggregations or search body, or - for stdin
+	Q       string        // A query string
+	Buckets []bucketLevel // Levels of buckets, outermost first
+	Metrics []string      // Metrics of the innermost buckets, as aggregation:field
+	Format  string        // table, csv, or json
+}
+
+// Agg runs aggregations on an index and prints their results.
+func Agg(opts AggOptions) {
+	switch opts.Format {
+	case "table", "csv", "json":
+	default:
+		logFatalf("unknown format '%s'", opts.Format)
+	}
+	var body map[string]interface{}
+	if opts.Query != "" {
+		if len(opts.Buckets) > 0 || len(opts.Metrics) > 0 {
+			logFatalf("--query can't be used with --terms, --date-histogram, --histogram, or --metric")
+		}
+		var err error
+		body, err = readJSONFile(opts.Query, "")
+		if err != nil {
+			logFatalf("Error reading the aggregations: %s", err)
+		}
+		// a file of just the aggregations
+		_, hasAggs := body["aggs"]
+		_, hasAggregations := body["aggregations"]
+		if !hasAggs && !hasAggregations {
+			body = map[string]interface{}{"aggs": body}
+		}
+	} else {
+		aggs, err := buildAggs(opts.Buckets, opts.Metrics)
+		if err != nil {
+			logFatalf("%s", err)
+		}
+		if len(aggs) == 0 {
+			logFatalf("no aggregations: give --query, or --terms, --date-histogram, --histogram, or --metric")
+		}
+		body = map[string]interface{}{"aggs": aggs}
+	}
+	if opts.Q != "" {
+		if _, ok := body["query"]; ok {
+			logFatalf("--q can't be used with a --query file that has a query")
+		}
+		body["query"] = map[string]interface{}{"query_string": map[string]interface{}{"query": opts.Q}}
+	}
+	body["size"] = 0
+	// the count of all the documents, not just the first 10,000
+	if _, ok := body["track_total_hits"]; !ok {
+		body["track_total_hits"] = true
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		logFatalf("Error encoding the aggregations: %s", err)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := performRequest(context.Background(), client, http.MethodPost, "/"+url.PathEscape(opts.Index)+"/_search", data)
+	if err != nil {
+		logFatalf("Error running the aggregations: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error running the aggregations: %s", err)
+	}
+	var result struct {
+		Hits struct {
+			Total struct {
+				Value json.Number `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Aggregations map[string]interface{} `json:"aggregations"`
+	}
+	// numbers are kept as they were written, however long
+	decoder := json.NewDecoder(res.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
+		logFatalf("Error reading the aggregations: %s", err)
+	}
+	if opts.Format == "json" {
+		out, err := json.MarshalIndent(result.Aggregations, "", "  ")
+		if err != nil {
+			logFatalf("Error writing the aggregations: %s", err)
+		}
+		fmt.Println(string(out))
+		return
+	}
+	root := aggBucket{docCount: result.Hits.Total.Value.String(), metrics: map[string]string{}}
+	root.addAggs(result.Aggregations)
+	if err := writeBuckets(&root, opts.Format); err != nil {
+		logFatalf("Error writing the aggregations: %s", err)
+	}
+}
+
+// buildAggs returns the aggregations of bucket levels, each within the one
+// before, with the metrics within the innermost.
+func buildAggs(levels []bucketLevel, metrics []string) (map[string]interface{}, error) {
+	aggs := map[string]interface{}{}
+	for _, metric := range metrics {
+		kind, field, ok := strings.Cut(metric, ":")
+		if !ok || kind == "" || field == "" {
+			return nil, fmt.Errorf("--metric '%s' isn't aggregation:field", metric)
+		}
+		aggs[fmt.Sprintf("%s(%s)", kind, field)] = map[string]interface{}{kind: map[string]interface{}{"field": field}}
+	}
+	for i := len(levels) - 1; i >= 0; i-- {
+		level := levels[i]
+		field, parameter, _ := strings.Cut(level.spec, ":")
+		if field == "" {
+			return nil, fmt.Errorf("--%s needs a field", strings.ReplaceAll(level.kind, "_", "-"))
+		}
+		settings := map[string]interface{}{"field": field}
+		switch level.kind {
+		case "terms":
+			if parameter != "" {
+				size, err := strconv.Atoi(parameter)
+				if err != nil || size <= 0 {
+					return nil, fmt.Errorf("--terms '%s' has a bad size", level.spec)
+				}
+				settings["size"] = size
+			}
+		case "date_histogram":
+			if parameter == "" {
+				return nil, fmt.Errorf("--date-histogram '%s' needs an interval, as field:1d", level.spec)
+			}
+			switch parameter {
+			case "1m", "1h", "1d", "1w", "1M", "1q", "1y":
+				settings["calendar_interval"] = parameter
+			default:
+				settings["fixed_interval"] = parameter
+			}
+		case "histogram":
+			interval, err := strconv.ParseFloat(parameter, 64)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("--histogram '%s' needs an interval, as field:100", level.spec)
+			}
+			settings["interval"] = interval
+		}
+		agg := map[string]interface{}{level.kind: settings}
+		if len(aggs) > 0 {
+			agg["aggs"] = aggs
+		}
+		aggs = map[string]interface{}{field: agg}
+	}
+	return aggs, nil
+}
+
+// aggBucket is a bucket of an aggregation's results, with the metrics and
+// the buckets of the aggregations within it.
+type aggBucket struct {
+	name     string // The name of the aggregation of the bucket
+	key      string
+	docCount string
+	metrics  map[string]string // The values of the metrics, by column
+	buckets  []*aggBucket
+}
+
+// addAggs adds the results of aggregations, by name, to a bucket.
+func (b *aggBucket) addAggs(aggs map[string]interface{}) {
+	names := make([]string, 0, len(aggs))
+	for name := range aggs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result, ok := aggs[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		b.addAgg(name, result)
+	}
+}
+
+// addAgg adds the result of an aggregation to a bucket: its buckets, or
+// its single bucket, or its values as metrics.
+func (b *aggBucket) addAgg(name string, result map[string]interface{}) {
+	switch buckets := result["buckets"].(type) {
+	case []interface{}:
+		for _, bucket := range buckets {
+			if object, ok := bucket.(map[string]interface{}); ok {
+				b.addBucket(name, bucketKey(object), object)
+			}
+		}
+		return
+	case map[string]interface{}:
+		// keyed buckets, as of a filters aggregation
+		keys := make([]string, 0, len(buckets))
+		for key := range buckets {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if object, ok := buckets[key].(map[string]interface{}); ok {
+				b.addBucket(name, key, object)
+			}
+		}
+		return
+	}
+	if _, ok := result["doc_count"]; ok {
+		// a single bucket, as of a filter or nested aggregation
+		b.addBucket(name, "", result)
+		return
+	}
+	if value, ok := result["value_as_string"]; ok {
+		b.metrics[name] = cellValue(value)
+		return
+	}
+	if value, ok := result["value"]; ok {
+		b.metrics[name] = cellValue(value)
+		return
+	}
+	// several values, as of a stats or percentiles aggregation
+	values, ok := result["values"].(map[string]interface{})
+	if !ok {
+		values = result
+	}
+	for key, value := range values {
+		if key == "meta" {
+			continue
+		}
+		b.metrics[name+"."+key] = cellValue(value)
+	}
+}
+
+// addBucket adds a sub-bucket of an aggregation to a bucket.
+func (b *aggBucket) addBucket(name string, key string, object map[string]interface{}) {
+	bucket := &aggBucket{name: name, key: key, docCount: cellValue(object["doc_count"]), metrics: map[string]string{}}
+	sub := map[string]interface{}{}
+	for field, value := range object {
+		switch field {
+		case "key", "key_as_string", "doc_count", "from", "from_as_string", "to", "to_as_string", "doc_count_error_upper_bound", "bg_count", "score", "meta":
+		default:
+			sub[field] = value
+		}
+	}
+	bucket.addAggs(sub)
+	b.buckets = append(b.buckets, bucket)
+}
+
+// bucketKey returns the key of a bucket, as a string if it has one.
+func bucketKey(bucket map[string]interface{}) string {
+	if key, ok := bucket["key_as_string"]; ok {
+		return cellValue(key)
+	}
+	return cellValue(bucket["key"])
+}
+
+// writeBuckets writes the buckets under root to stdout as an indented
+// table, or as CSV with a row for each innermost bucket.
+func writeBuckets(root *aggBucket, format string) error {
+	var metricColumns []string
+	seen := map[string]bool{}
+	var levelColumns []string
+	var walk func(b *aggBucket, depth int)
+	walk = func(b *aggBucket, depth int) {
+		for name := range b.metrics {
+			if !seen[name] {
+				seen[name] = true
+				metricColumns = append(metricColumns, name)
+			}
+		}
+		for _, sub := range b.buckets {
+			if depth >= len(levelColumns) {
+				levelColumns = append(levelColumns, sub.name)
+			}
+			walk(sub, depth+1)
+		}
+	}
+	walk(root, 0)
+	sort.Strings(metricColumns)
+	metricCells := func(b *aggBucket) []string {
+		cells := make([]string, len(metricColumns))
+		for i, column := range metricColumns {
+			cells[i] = b.metrics[column]
+		}
+		return cells
+	}
+	var rows [][]string
+	if format == "table" {
+		columns := append([]string{"bucket", "doc_count"}, metricColumns...)
+		var add func(b *aggBucket, depth int)
+		add = func(b *aggBucket, depth int) {
+			label := b.name
+			if b.key != "" {
+				label += " = " + b.key
+			}
+			rows = append(rows, append([]string{strings.Repeat("  ", depth) + label, b.docCount}, metricCells(b)...))
+			for _, sub := range b.buckets {
+				add(sub, depth+1)
+			}
+		}
+		rows = append(rows, append([]string{"(all)", root.docCount}, metricCells(root)...))
+		for _, sub := range root.buckets {
+			add(sub, 1)
+		}
+		return writeRows(os.Stdout, format, columns, rows)
+	}
+	columns := append(append(append([]string(nil), levelColumns...), "doc_count"), metricColumns...)
+	var add func(b *aggBucket, keys []string)
+	add = func(b *aggBucket, keys []string) {
+		if len(b.buckets) == 0 {
+			row := make([]string, len(levelColumns))
+			copy(row, keys)
+			rows = append(rows, append(append(row, b.docCount), metricCells(b)...))
+			return
+		}
+		for _, sub := range b.buckets {
+			key := sub.key
+			if key == "" {
+				key = sub.name
+			}
+			add(sub, append(append([]string(nil), keys...), key))
+		}
+	}
+	add(root, nil)
+	return writeRows(os.Stdout, format, columns, rows)
+}
@@ -0,0 +1,180 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// aliasCmd represents the alias command
+var aliasCmd = &cobra.Command{
+	Use:   "alias",
+	Short: "Manage index aliases",
+}
+
+// aliasListCmd represents the alias list command
+var aliasListCmd = &cobra.Command{
+	Use:   "list [alias]",
+	Short: "List aliases and their indices",
+	Long: `List aliases and the indices they point to, optionally only those matching a
+	name, which may contain wildcards.
+	$ opensearch-doc alias list 'logs*'`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+		ListAliases(name)
+	},
+}
+
+// aliasAddCmd represents the alias add command
+var aliasAddCmd = &cobra.Command{
+	Use:   "add <index> <alias>",
+	Short: "Point an alias at an index",
+	Long: `Point an alias at an index, in addition to any other indices it points to. With
+	--write-index, writes to the alias go to this index.
+	$ opensearch-doc alias add logs-2022.02 logs --write-index`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		writeIndex, _ := cmd.Flags().GetBool("write-index")
+		action := aliasAction{Index: args[0], Alias: args[1]}
+		if writeIndex {
+			action.IsWriteIndex = &writeIndex
+		}
+		UpdateAliases([]map[string]aliasAction{{"add": action}})
+		fmt.Printf("Added alias [%s] to [%s]\n", args[1], args[0])
+	},
+}
+
+// aliasRemoveCmd represents the alias remove command
+var aliasRemoveCmd = &cobra.Command{
+	Use:   "remove <index> <alias>",
+	Short: "Remove an alias from an index",
+	Long: `Remove an alias from an index; the alias still points to its other indices.
+	$ opensearch-doc alias remove logs-2021.12 logs`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		UpdateAliases([]map[string]aliasAction{{"remove": {Index: args[0], Alias: args[1]}}})
+		fmt.Printf("Removed alias [%s] from [%s]\n", args[1], args[0])
+	},
+}
+
+// aliasSwapCmd represents the alias swap command
+var aliasSwapCmd = &cobra.Command{
+	Use:   "swap",
+	Short: "Move an alias from one index to another atomically",
+	Long: `Move an alias from one index to another in a single request, so that searches
+	of the alias never see both indices or neither. This is how a new version of an index
+	is put into service once it has been loaded and checked:
+	$ opensearch-doc alias swap --name products --from products-v1 --to products-v2`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		name, _ := cmd.Flags().GetString("name")
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		UpdateAliases([]map[string]aliasAction{
+			{"remove": {Index: from, Alias: name}},
+			{"add": {Index: to, Alias: name}},
+		})
+		fmt.Printf("Moved alias [%s] from [%s] to [%s]\n", name, from, to)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(aliasCmd)
+	aliasCmd.AddCommand(aliasListCmd)
+	aliasCmd.AddCommand(aliasAddCmd)
+	aliasCmd.AddCommand(aliasRemoveCmd)
+	aliasCmd.AddCommand(aliasSwapCmd)
+
+	aliasAddCmd.Flags().Bool("write-index", false, "Make this the index that writes to the alias go to")
+	aliasSwapCmd.Flags().String("name", "", "The alias to move")
+	aliasSwapCmd.Flags().String("from", "", "The index the alias points to now")
+	aliasSwapCmd.Flags().String("to", "", "The index to point the alias to")
+	aliasSwapCmd.MarkFlagRequired("name")
+	aliasSwapCmd.MarkFlagRequired("from")
+	aliasSwapCmd.MarkFlagRequired("to")
+}
+
+// aliasAction is an add or remove action of an _aliases request.
+type aliasAction struct {
+	Index        string `json:"index"`
+	Alias        string `json:"alias"`
+	IsWriteIndex *bool  `json:"is_write_index,omitempty"`
+}
+
+// ListAliases prints the aliases matching name, or all of them if name is
+// empty, with their indices.
+func ListAliases(name string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	req := opensearchapi.CatAliasesRequest{
+		Format: "json",
+		H:      []string{"alias", "index", "is_write_index"},
+		S:      []string{"alias", "index"},
+	}
+	if name != "" {
+		req.Name = []string{name}
+	}
+	res, err := req.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error listing the aliases: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error listing the aliases: %s", err)
+	}
+	var rows []struct {
+		Alias        string `json:"alias"`
+		Index        string `json:"index"`
+		IsWriteIndex string `json:"is_write_index"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+		logFatalf("Error reading the aliases: %s", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ALIAS\tINDEX\tWRITE INDEX")
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", row.Alias, row.Index, row.IsWriteIndex)
+	}
+	w.Flush()
+}
+
+// UpdateAliases applies alias actions in a single request, so they take
+// effect together or not at all.
+func UpdateAliases(actions []map[string]aliasAction) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	if err := updateAliases(client, actions); err != nil {
+		logFatalf("Error updating the aliases: %s", err)
+	}
+}
+
+func updateAliases(client *opensearch.Client, actions []map[string]aliasAction) error {
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return err
+	}
+	res, err := opensearchapi.IndicesUpdateAliasesRequest{Body: bytes.NewReader(body)}.Do(context.Background(), client)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return responseError(res)
+}
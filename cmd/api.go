@@ -0,0 +1,132 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// apiError is an error response from OpenSearch.
+type apiError = osdoc.APIError
+
+// responseError returns the error described by an error response, or nil
+// if res isn't an error. It reads the body of an error response.
+func responseError(res *opensearchapi.Response) error {
+	return osdoc.ResponseError(res)
+}
+
+// readJSONFile reads a JSON object from the named file, or from stdin if
+// path is "-". If the object has a single key, wrapper, its value is
+// returned instead, so that a file can hold either {"settings": {...}} or
+// just the settings.
+func readJSONFile(path string, wrapper string) (map[string]interface{}, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if inner, ok := object[wrapper].(map[string]interface{}); ok && len(object) == 1 {
+		return inner, nil
+	}
+	return object, nil
+}
+
+// printJSON copies a JSON response body to stdout, indented.
+func printJSON(r io.Reader) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		return err
+	}
+	indented.WriteByte('\n')
+	_, err = indented.WriteTo(os.Stdout)
+	return err
+}
+
+// shardResults is the count of shards an operation such as a refresh
+// succeeded and failed on.
+type shardResults struct {
+	Total      int `json:"total"`
+	Successful int `json:"successful"`
+	Failed     int `json:"failed"`
+}
+
+// readShardResults reads the shard counts from a response body.
+func readShardResults(r io.Reader) (shardResults, error) {
+	var body struct {
+		Shards shardResults `json:"_shards"`
+	}
+	err := json.NewDecoder(r).Decode(&body)
+	return body.Shards, err
+}
+
+// performRequest sends a request to an API the client has no request type
+// for, such as a plugin's, with ctx. path may include a query string, and
+// body may be nil.
+func performRequest(ctx context.Context, client *opensearch.Client, method string, path string, body []byte) (*opensearchapi.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, path, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := client.Perform(req)
+	if err != nil {
+		return nil, err
+	}
+	return &opensearchapi.Response{StatusCode: res.StatusCode, Header: res.Header, Body: res.Body}, nil
+}
+
+// jsonRequest sends a request with performRequest, with body encoded as
+// JSON unless it is nil, and decodes the response into result unless it is
+// nil.
+func jsonRequest(ctx context.Context, client *opensearch.Client, method string, path string, body interface{}, result interface{}) error {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+	res, err := performRequest(ctx, client, method, path, data)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
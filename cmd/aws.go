@@ -0,0 +1,100 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/spf13/viper"
+)
+
+// newAWSTransport wraps next with AWS SigV4 request signing, using the
+// standard AWS credential chain, an optional named profile, and an
+// optional role to assume.
+func newAWSTransport(next http.RoundTripper) (http.RoundTripper, error) {
+	sess, creds, err := newAWSSession()
+	if err != nil {
+		return nil, err
+	}
+	region := aws.StringValue(sess.Config.Region)
+	if region == "" {
+		return nil, errors.New("an AWS region is required for --aws-sigv4; set --aws-region or AWS_REGION")
+	}
+	return &awsTransport{
+		signer:  v4.NewSigner(creds),
+		service: viper.GetString("aws-service"),
+		region:  region,
+		next:    next,
+	}, nil
+}
+
+// newS3Client creates an S3 client, for reading documents from S3, with
+// the same AWS settings as --aws-sigv4.
+func newS3Client() (*s3.S3, error) {
+	sess, creds, err := newAWSSession()
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(sess, &aws.Config{Credentials: creds}), nil
+}
+
+// newAWSSession creates an AWS session with the --aws-region and
+// --aws-profile, and returns it with its credentials, or those of the
+// --aws-role-arn if one is given.
+func newAWSSession() (*session.Session, *credentials.Credentials, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(viper.GetString("aws-region"))},
+		Profile:           viper.GetString("aws-profile"),
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	creds := sess.Config.Credentials
+	if roleARN := viper.GetString("aws-role-arn"); roleARN != "" {
+		creds = stscreds.NewCredentials(sess, roleARN)
+	}
+	return sess, creds, nil
+}
+
+// awsTransport signs each request with AWS SigV4 before sending it.
+type awsTransport struct {
+	signer  *v4.Signer
+	service string // es for Amazon OpenSearch Service, aoss for Serverless
+	region  string
+	next    http.RoundTripper
+}
+
+func (t *awsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Serverless collections require the payload hash header.
+	hash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(hash[:]))
+	// Sign also resets the request body to the given reader.
+	if _, err := t.signer.Sign(req, bytes.NewReader(body), t.service, t.region, time.Now()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
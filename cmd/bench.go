@@ -0,0 +1,233 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/opensearch-project/opensearch-go/opensearchtransport"
+	"github.com/spf13/cobra"
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// benchCmd represents the bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure the performance of a cluster",
+}
+
+// benchIndexCmd represents the bench index command
+var benchIndexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Measure the indexing throughput of a cluster",
+	Long: `Index --docs synthetic documents of about --doc-size each with the same bulk indexer
+	as the bulk command, and report the sustained throughput, in documents and bytes a
+	second, and the percentiles of the latency of the bulk requests, to check that a
+	cluster is sized for a load.
+	$ opensearch-doc bench index -i bench_idx --docs 1000000 --doc-size 2kb --workers 8
+
+	Each document has an ID, a timestamp, a keyword, two numbers, and a message of random
+	words to fill it out to the size; sizes take a b, kb, or mb suffix. Documents with the
+	same IDs are overwritten, so a benchmark can be repeated on the same index. Create the
+	index first to benchmark its settings, such as the number of shards and replicas, and
+	delete it afterwards.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, _ := cmd.Flags().GetString("index")
+		docs, _ := cmd.Flags().GetInt("docs")
+		docSize, _ := cmd.Flags().GetString("doc-size")
+		workers, _ := cmd.Flags().GetInt("workers")
+		flushBytes, _ := cmd.Flags().GetInt("flush-bytes")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		size, err := parseByteSize(docSize)
+		if err != nil {
+			logFatalf("Invalid --doc-size: %s", err)
+		}
+		stats, err := BenchIndex(BenchIndexOptions{
+			Index:      index,
+			Docs:       docs,
+			DocSize:    size,
+			Workers:    workers,
+			FlushBytes: flushBytes,
+			Quiet:      quiet,
+		})
+		if err != nil {
+			logErrorf("%s", err)
+		}
+		if code := bulkExitCode(false, stats, err); code != 0 {
+			exit(code)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(benchCmd)
+	benchCmd.AddCommand(benchIndexCmd)
+
+	benchIndexCmd.Flags().StringP("index", "i", "", "The index to load the documents into")
+	benchIndexCmd.Flags().Int("docs", 100000, "The number of documents to index")
+	benchIndexCmd.Flags().String("doc-size", "1kb", "The approximate size of each document")
+	benchIndexCmd.Flags().Int("workers", 4, "The number of indexer worker goroutines")
+	benchIndexCmd.Flags().Int("flush-bytes", 5e+6, "The flush threshold in bytes")
+	benchIndexCmd.Flags().BoolP("quiet", "q", false, "Don't report progress")
+	benchIndexCmd.MarkFlagRequired("index")
+}
+
+// BenchIndexOptions holds the settings for an indexing benchmark.
+type BenchIndexOptions struct {
+	Index   string // The index to load the documents into
+	Docs    int    // The number of documents
+	DocSize int    // The approximate size of each document, in bytes
+
+	Workers    int // The number of indexer worker goroutines
+	FlushBytes int // The flush threshold in bytes
+
+	Quiet bool // Don't report progress
+}
+
+// benchWords are the words of the messages of the benchmark documents.
+var benchWords = strings.Fields(`alpha bravo charlie delta echo foxtrot golf hotel india juliett
+	kilo lima mike november oscar papa quebec romeo sierra tango uniform victor whiskey xray
+	yankee zulu cluster shard replica segment merge refresh flush translog mapping analyzer
+	token query filter bucket aggregation document field index node heap thread pool`)
+
+// BenchIndex indexes synthetic documents, reports the throughput and the
+// latency of the bulk requests, and returns the Stats of the load.
+func BenchIndex(opts BenchIndexOptions) (osdoc.Stats, error) {
+	if opts.Docs <= 0 {
+		return osdoc.Stats{}, fmt.Errorf("--docs must be positive")
+	}
+	client, err := NewClient()
+	if err != nil {
+		return osdoc.Stats{}, &connectionError{fmt.Errorf("creating the client: %w", err)}
+	}
+	timer := &latencyTransport{next: client.Transport}
+	client = &opensearch.Client{Transport: timer, API: opensearchapi.New(timer)}
+	loader, err := osdoc.NewBulkLoader(context.Background(), client, osdoc.Options{
+		Index:         opts.Index,
+		Action:        "index",
+		IDField:       "_id",
+		Format:        "json",
+		Workers:       opts.Workers,
+		FlushBytes:    opts.FlushBytes,
+		FlushInterval: 30 * time.Second,
+	})
+	if err != nil {
+		return osdoc.Stats{}, err
+	}
+	start := time.Now()
+	stats, err := load(loader, BulkOptions{Quiet: opts.Quiet, ProgressInterval: time.Second}, start, func(p *progress) error {
+		add := loader.Adder("bench")
+		random := rand.New(rand.NewSource(start.UnixNano()))
+		var message strings.Builder
+		for i := 1; i <= opts.Docs; i++ {
+			// about 150 bytes go to the other fields
+			message.Reset()
+			for message.Len() < opts.DocSize-150 {
+				message.WriteString(benchWords[random.Intn(len(benchWords))])
+				message.WriteByte(' ')
+			}
+			err := add(i, map[string]interface{}{
+				"_id":        strconv.Itoa(i),
+				"@timestamp": start.Add(time.Duration(i) * time.Millisecond).UTC().Format(time.RFC3339Nano),
+				"category":   benchWords[i%10],
+				"count":      random.Intn(1000),
+				"value":      random.Float64() * 1000,
+				"message":    strings.TrimSpace(message.String()),
+			})
+			if err == osdoc.ErrStopped {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	elapsed := time.Since(start).Seconds()
+	latencies, bytes := timer.results()
+	fmt.Printf("Throughput over %.1fs: %.0f documents/s, %.1f MB/s\n",
+		elapsed, float64(stats.Flushed)/elapsed, float64(bytes)/elapsed/(1<<20))
+	if len(latencies) > 0 {
+		fmt.Printf("Bulk request latency over [%d] requests: p50 %s, p90 %s, p99 %s, max %s\n", len(latencies),
+			percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99), percentile(latencies, 100))
+	}
+	return stats, err
+}
+
+// latencyTransport records the latency and the size of each bulk request.
+type latencyTransport struct {
+	next opensearchtransport.Interface
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	bytes     int64
+}
+
+func (t *latencyTransport) Perform(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/_bulk") {
+		return t.next.Perform(req)
+	}
+	start := time.Now()
+	res, err := t.next.Perform(req)
+	latency := time.Since(start)
+	t.mu.Lock()
+	t.latencies = append(t.latencies, latency)
+	if req.ContentLength > 0 {
+		t.bytes += req.ContentLength
+	}
+	t.mu.Unlock()
+	return res, err
+}
+
+// results returns the latencies of the bulk requests, sorted, and the
+// bytes sent in them.
+func (t *latencyTransport) results() ([]time.Duration, int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	latencies := append([]time.Duration(nil), t.latencies...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	return latencies, t.bytes
+}
+
+// percentile returns the pth percentile of sorted latencies, rounded to
+// the millisecond.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i].Round(time.Millisecond)
+}
+
+// parseByteSize parses a size such as 512, 2kb, or 1.5mb, in bytes.
+func parseByteSize(size string) (int, error) {
+	s := strings.ToLower(strings.TrimSpace(size))
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix     string
+		multiplier float64
+	}{{"kb", 1 << 10}, {"mb", 1 << 20}, {"b", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("'%s' isn't a size", size)
+	}
+	return int(n * multiplier), nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// indexBlocks are the blocks that can be put on an index, by flag name.
+var indexBlocks = []struct {
+	flag  string
+	block string
+	usage string
+}{
+	{"write", "write", "Block writes to the index"},
+	{"read", "read", "Block reads from the index"},
+	{"read-only", "read_only", "Block writes to the index and changes to its metadata"},
+	{"metadata", "metadata", "Block changes to the index's metadata"},
+}
+
+// blockCmd represents the block command
+var blockCmd = &cobra.Command{
+	Use:   "block <index>",
+	Short: "Block writes or reads on an index",
+	Long: `Block operations on an opensearch index, for example to freeze it before taking a
+	snapshot or migrating it. --write blocks writes, --read blocks reads, --read-only blocks
+	writes and metadata changes, and --metadata blocks metadata changes. The name may
+	contain wildcards. Use unblock to lift the blocks.
+	$ opensearch-doc index block my_index --write`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		BlockIndex(args[0], flaggedBlocks(cmd))
+	},
+}
+
+// unblockCmd represents the unblock command
+var unblockCmd = &cobra.Command{
+	Use:   "unblock <index>",
+	Short: "Lift blocks on an index",
+	Long: `Lift blocks put on an opensearch index with block; the flags are the same.
+	$ opensearch-doc index unblock my_index --write`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		UnblockIndex(args[0], flaggedBlocks(cmd))
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(blockCmd)
+	indexCmd.AddCommand(unblockCmd)
+
+	for _, b := range indexBlocks {
+		blockCmd.Flags().Bool(b.flag, false, b.usage)
+		unblockCmd.Flags().Bool(b.flag, false, strings.Replace(b.usage, "Block", "Unblock", 1))
+	}
+}
+
+// flaggedBlocks returns the names of the blocks whose flags are set.
+func flaggedBlocks(cmd *cobra.Command) []string {
+	var blocks []string
+	for _, b := range indexBlocks {
+		if set, _ := cmd.Flags().GetBool(b.flag); set {
+			blocks = append(blocks, b.block)
+		}
+	}
+	return blocks
+}
+
+// BlockIndex puts blocks on an index.
+func BlockIndex(index string, blocks []string) {
+	if len(blocks) == 0 {
+		logFatalf("no blocks given; use --write, --read, --read-only, or --metadata")
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	for _, block := range blocks {
+		res, err := opensearchapi.IndicesAddBlockRequest{Index: []string{index}, Block: block}.Do(context.Background(), client)
+		if err != nil {
+			logFatalf("Error blocking the index: %s", err)
+		}
+		err = responseError(res)
+		res.Body.Close()
+		if err != nil {
+			logFatalf("Error blocking the index: %s", err)
+		}
+	}
+	fmt.Printf("Blocked %s on [%s]\n", strings.Join(blocks, ", "), index)
+}
+
+// UnblockIndex lifts blocks on an index. There is no API to remove a
+// block, so the index.blocks settings it sets are turned off.
+func UnblockIndex(index string, blocks []string) {
+	if len(blocks) == 0 {
+		logFatalf("no blocks given; use --write, --read, --read-only, or --metadata")
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	settings := map[string]interface{}{}
+	for _, block := range blocks {
+		settings["index.blocks."+block] = false
+	}
+	if err := osdoc.PutIndexSettings(context.Background(), client, []string{index}, settings); err != nil {
+		logFatalf("Error unblocking the index: %s", err)
+	}
+	fmt.Printf("Unblocked %s on [%s]\n", strings.Join(blocks, ", "), index)
+}
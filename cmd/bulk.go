@@ -4,18 +4,24 @@ Copyright © 2022 Will Fitzgerald <willf@github.com>
 package cmd
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
+	"encoding/base64"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/opensearch-project/opensearch-go"
-	"github.com/opensearch-project/opensearch-go/opensearchutil"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/willf/opensearch-doc/pkg/osdoc"
 )
 
 // bulkCmd represents the bulk command
@@ -26,9 +32,183 @@ var bulkCmd = &cobra.Command{
 	Add documents to an OpenSearch index.
 
 	Documents are read from stdin, one per line, and added to the index. Each line much be a valid JSON document.
+	Input that starts with a JSON array of documents, or with a pretty-printed object, is
+	read as a stream of JSON values instead, so it needn't be reformatted first.
+	Documents can also be read from one or more files with the -F flag, which may be repeated
+	and may contain glob patterns. -F also takes s3://bucket/key URLs, using the AWS settings
+	of --aws-sigv4 and the standard AWS credential chain; s3://bucket/prefix/, ending with a
+	slash, reads every object under the prefix, and a glob pattern the objects matching it.
+	Objects are streamed, so large exports needn't be downloaded first:
+	$ opensearch-doc bulk -i my_index -f id -F 's3://exports/2022-10/*.ndjson.gz'
+	-F also takes http:// or https:// URLs, following redirects; a download that breaks off
+	is resumed where it stopped, with a Range request, up to --max-retries times. Send
+	credentials with --http-auth user:password, or other headers with --http-header:
+	$ opensearch-doc bulk -i my_index -f id -F https://example.com/data.ndjson --http-auth me:secret
 	A document ID is required for each document. The ID field can be specified with the -f flag.
-	The default ID field is _id.
-	The document id and its value will be removed from the document before indexing.
+	The default ID field is _id. A nested ID field can be given as a dotted path, such as
+	-f metadata.uuid; use a backslash for a dot that is part of a field name, as in -f 'a\.b'.
+	To build the ID from several fields, list them separated by commas; their values are
+	joined with the --id-separator, as in -f user_id,event_time --id-separator :
+	The document id and its value will be removed from the document before indexing,
+	unless --keep-id is given.
+	Documents without the ID field are skipped, unless --auto-id is given, in which case
+	OpenSearch assigns an ID, or --hash-id, in which case the ID is a hash of the document's
+	content, so that loading the same documents again doesn't duplicate them.
+	Input compressed with gzip, bzip2, or zstd is detected and decompressed automatically.
+
+	With --action update, each document is applied as a partial update of the existing
+	document with the same ID. Add --upsert to index the document if it doesn't exist yet.
+
+	Documents are routed to shards with --routing, which gives one routing value for all of
+	them, or --routing-field, which names a field holding each document's routing value (for
+	example, the parent ID of a join field). Documents without the field use the --routing.
+
+	Documents can go to different indices: --index-field names a field holding each document's
+	index, and documents without it go to the --index. An index name can contain a date pattern
+	in braces, using yyyy, yy, MM, dd, HH, mm, and ss, which is filled in from the document's
+	--date-field (an ISO 8601 date, or milliseconds since the epoch) in UTC, or from the current
+	time if no date field is given:
+	$ opensearch-doc bulk -i "logs-{yyyy.MM.dd}" --date-field @timestamp -F app.log.json
+
+	To try a load on part of the input first, --skip N skips the first N documents, --sample
+	0.05 indexes a random 5% of them, and --limit N stops after N documents have been sent:
+	$ opensearch-doc bulk -i my_index -f id --limit 1000 -F export.json
+
+	With --dedupe, documents with the same ID as an earlier one in the run are dropped and
+	counted. With --dedupe last, the last document with each ID is indexed instead; documents
+	are then held in memory until the input ends. For very large runs, --dedupe-approx tracks
+	IDs in fixed memory with a bloom filter sized by --dedupe-capacity, at the cost of
+	occasionally dropping a document that isn't a duplicate (about 0.1% of them at capacity).
+
+	With --where, only documents for which a jq expression is true (anything but false or
+	null) are indexed; the others are skipped and counted in the summary. It is tested against
+	each document as read, before any other changes:
+	$ opensearch-doc bulk -i users -f id --where '.status == "active" and .age >= 18'
+
+	With --transform, each document is reshaped by a jq expression before it is indexed. If the
+	expression yields nothing, the document is skipped, and if it yields several objects, each
+	is indexed:
+	$ opensearch-doc bulk -i my_index -f id --transform 'del(.debug) | .name |= ascii_downcase'
+	$ opensearch-doc bulk -i orders -f id --transform '.items[] | select(.quantity > 0)'
+
+	For simpler changes, --rename old=new, --drop field, and --set key=value change each
+	document's fields, in that order; each may be repeated. A --set value that is valid JSON,
+	such as 42 or true, is set as that value, and otherwise as a string. --timestamp-field adds
+	the time each document was read. These are applied after any --transform:
+	$ opensearch-doc bulk -i my_index --rename uid=_id --drop debug --set source=import \
+	    --timestamp-field ingested_at -F data.json
+
+	With --embed-field, --embed-target, and --embed-endpoint, the text of a field of each
+	document is embedded by an OpenAI-compatible embeddings API, such as OpenAI's, or a local
+	Ollama, vLLM, or text-embeddings-inference server, and the vector is set in the target field
+	before the document is indexed, so vectors can be loaded without an ingest pipeline.
+	Documents are embedded --embed-batch-size at a time, with --embed-workers requests at once,
+	and a request that fails with a network error, a 429, or a 5xx is retried up to
+	--embed-retries times. --embed-model names the model, and --embed-api-key (env
+	OPENSEARCH_EMBED_API_KEY) is sent as a bearer token. Documents without the field are indexed
+	as they are; those that can't be embedded are counted as failures. A dry run doesn't embed.
+	$ opensearch-doc bulk -i passages -f id --embed-field text --embed-target text_vector \
+	    --embed-endpoint http://localhost:11434/v1/embeddings --embed-model nomic-embed-text -F passages.json
+
+	With --pipeline, documents are run through the named ingest pipeline on the server before
+	they are indexed, for example to enrich them or to parse a raw field.
+
+	By default, documents become searchable at the next periodic refresh. For tests that query
+	the index right after loading it, --refresh true refreshes after each bulk request, and
+	--refresh wait_for waits for the next refresh before returning. --wait-for-active-shards
+	makes each bulk request wait until that many copies of each shard (or all) are active.
+	$ opensearch-doc bulk -i my_index -f id --refresh wait_for -F fixtures.json
+
+	With --optimize-load, refresh and replicas are turned off on the existing indices matching
+	--index while the documents are loaded, which makes large loads much faster. When the load
+	ends, their settings are restored and the indices are refreshed.
+
+	To keep a large load from crowding out other traffic on a shared cluster, --max-docs-per-sec
+	and --max-bytes-per-sec limit how fast documents are sent.
+
+	To keep from overwhelming an undersized cluster, --auto-tune sends one bulk request at a
+	time to start with, and sends more at once while the responses stay fast, up to --workers
+	(16 by default). When the cluster returns a 429 or 503, or rejects documents because its
+	write thread pool is full, it halves the number; when a response is much slower than the
+	fastest, it sends one fewer.
+
+	With --pause-on-red, the cluster health is checked every --health-interval during the
+	load, and no bulk requests are sent while it is red; the load resumes by itself once the
+	cluster recovers. --pause-on-yellow also pauses while it is yellow, and --pause-rejections
+	pauses while the nodes' write thread pools reject more than that many requests a second.
+
+	On an interrupt (Ctrl-C) or SIGTERM, reading stops, the documents already read are sent,
+	and the summary and checkpoint are written as usual; interrupt again to stop sending them,
+	restore the index settings, and quit. With --timeout, a load that takes longer, such as
+	one against a cluster that has stopped responding, is stopped the same way.
+
+	With --watch, documents are read from the files of a directory whose names match the
+	--watch-pattern: first the lines already in them, then the lines appended to them and to
+	new files as they are written, until the load is interrupted. Only complete lines are read,
+	and the offset reached in each file is tracked, so this is a lightweight alternative to a log
+	shipper; with --checkpoint and --resume, a restarted watch skips the lines already indexed.
+	$ opensearch-doc bulk -i logs -f id --watch /var/log/app --checkpoint app.checkpoint --resume
+
+	With --kafka-brokers, --kafka-topic, and --kafka-group, documents are the JSON messages of a
+	Kafka topic, consumed as a member of the consumer group until the load is interrupted. The
+	group's offsets are committed every --kafka-commit-interval, and when the load ends, but only
+	for messages whose documents have been flushed, so a restarted consumer picks up with the
+	first message not yet sent; documents that fail are written to --failed-output, if given.
+	$ opensearch-doc bulk -i events -f id --kafka-brokers kafka1:9092,kafka2:9092 --kafka-topic events --kafka-group opensearch
+
+	With --db-dsn and --db-query, documents are the rows of a query on a Postgres, MySQL, or
+	SQLite database, streamed as they are read, with a field for each column; the column to
+	use as the ID is given with -f as usual. For --checkpoint and --resume, the query needs an
+	ORDER BY, since rows are resumed by position.
+	$ opensearch-doc bulk -i users -f user_id --db-dsn postgres://reader@db/app --db-query "SELECT * FROM users ORDER BY user_id"
+
+	Add --max-errors to stop once that many documents have failed to parse or index; the
+	documents already read are still sent. The exit code is 0 if every document was indexed,
+	2 if the cluster couldn't be reached, 3 if some documents failed, and 4 if all of them did.
+
+	With --version-field, each document's version number is taken from the named field, and
+	the document is only indexed or deleted if its version is newer than the one in the index
+	(--version-type external), or at least as new (external_gte). This lets a change data
+	capture feed be replayed safely: stale changes are counted as version conflicts in the
+	summary, not as failures. Updates don't support external versions.
+	$ opensearch-doc bulk -i orders -f id --version-field lsn --action-field op -F changes.json
+
+	Documents created with --action create that already exist are counted separately in the
+	summary. They are failures unless --skip-existing is given, which makes re-running the
+	same input safe: only the documents not yet in the index are added.
+	$ opensearch-doc bulk -i my_index -f id --action create --skip-existing -F events.json
+
+	With --action-field, each document can give its own action (index, create, update, or
+	delete) in the named field, which is removed before indexing; documents without the field
+	use the --action. This lets a change feed with mixed operations be applied in one pass:
+	$ opensearch-doc bulk -i my_index -f id --action-field _op -F changes.json
+
+	With --format csv or --format tsv, the first row of each input is a header naming the
+	fields of the documents that follow. Values are indexed as strings unless --types gives
+	a column's type (string, int, float, or bool) or --infer-types is set.
+
+	With --format parquet, each row of a Parquet file, such as an export from a data lake,
+	is a document. Timestamps and dates become dates OpenSearch recognizes, and decimals become
+	numbers. --columns reads just the named top-level columns:
+	$ opensearch-doc bulk -i orders -f order_id --format parquet --columns order_id,total,placed_at -F orders.parquet
+
+	With --format avro, each record of an Avro object container file is a document, with union
+	values unwrapped and logical types converted as for Parquet. Avro messages from Kafka are
+	decoded with the schemas in the --schema-registry, which must be given.
+
+	With --format xml, each element named by --record-element, wherever it is, is a document,
+	read as the input streams in. Attributes become "@name" fields, child elements become fields
+	(arrays if repeated, and strings if they only hold text), and the element's own text beside
+	them becomes "#text":
+	$ opensearch-doc bulk -i products -f @sku --format xml --record-element item -F feed.xml
+
+	With --format yaml, each document of a YAML stream, separated by "---" lines, is a document:
+	$ opensearch-doc bulk -i catalog -f name --format yaml -F 'catalog/*.yaml'
+
+	With --action delete, the input can be just the IDs to delete: a plain list, one per
+	line (--format ids, or detected when the input doesn't start with a JSON document), or
+	a one-column CSV, whose column is taken as the ID whatever its header says:
+	$ opensearch-doc bulk -i my_index --action delete -F stale-ids.txt
 
 	Example:
 	$ cat my_documents.json | opensearch-doc bulk -i my_index -f id
@@ -41,10 +221,248 @@ var bulkCmd = &cobra.Command{
 
 	and so forth.
 
+	To read from files instead of stdin:
+	$ opensearch-doc bulk -i my_index -f id -F part-1.json -F 'more/*.json'
+
+	Progress (documents and megabytes per second, errors, and an ETA when the size of the
+	input is known) is reported on stderr every second; use --quiet to turn it off.
+
+	With --schema, each document is validated against a JSON Schema before it is sent, after any
+	--transform or field changes; documents that don't match are logged with the reasons, and
+	written to the --failed-output file, instead of being rejected by the cluster with an
+	opaque mapping error.
+
+	With --stats-output json, a JSON summary of the run is written to stdout, or to the
+	--stats-file, in place of the text summary: the numbers of documents flushed, failed, created,
+	updated, and deleted, the bulk requests and retries, the duration and throughput, and the
+	number of failures of each error type, for schedulers and scripts to parse.
+
+	To watch a long load on a dashboard, --metrics-addr :9090 serves Prometheus metrics at
+	/metrics while it runs: the documents flushed, succeeded, and failed, failures by error
+	type, bulk requests in flight, bytes sent, and retries. export and copy also report the
+	documents read from the index, and how many there are to read.
+
+	With --otlp-endpoint http://localhost:4318, a trace of the command is exported to an OTLP
+	collector, with a span for each bulk and search request giving its index, document count,
+	and status. The span is passed on to the cluster in a traceparent header, so a slow load
+	can be matched with the cluster's own traces.
+
+	To check the input without indexing anything, use --dry-run. Each invalid record is
+	reported, followed by a summary. Add --validate-mapping to also check the documents
+	against the mapping of the index.
+
+	To build a bulk request offline, without contacting a cluster, use --to-file. The request
+	bodies are written to the file as NDJSON, each action line followed by its document, with
+	the index and pipeline on every item, to be sent later:
+
+	$ opensearch-doc bulk -i my_index -f id -F docs.json --to-file bulk.ndjson
+	$ curl -H 'Content-Type: application/x-ndjson' --data-binary @bulk.ndjson host:9200/_bulk
+
+	Such a file, or captured _bulk traffic, can be replayed with --from-bulk-file, which sends
+	its items as they are, in requests sized by --flush-bytes, with the usual retries, stats,
+	--failed-output, and --checkpoint. Items without an _index go to the -i index, and the
+	options that change documents don't apply:
+
+	$ opensearch-doc bulk -i my_index --from-bulk-file bulk.ndjson
+
+	Long loads can be made resumable with --checkpoint, which periodically records how much
+	of each input has been indexed. After a crash or interruption, run the same command with
+	--resume to skip the input that was already indexed.
+
+	Documents that fail to index can be written to a file with --failed-output. Each line
+	records the input name and line number, the status and error, and the original document,
+	which can be extracted to re-feed the documents once they are fixed:
+	$ jq -c .document failed.json | opensearch-doc bulk -i my_index -f id
+	With --resume, the failures are appended to the file, after those of the earlier run.
+
+	To load a CSV file:
+	$ opensearch-doc bulk -i my_index -f id --format csv --types age=int,active=bool -F people.csv
+
 	`,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("bulk started")
-		Bulk(cmd.Flag("index").Value.String(), cmd.Flag("action").Value.String(), cmd.Flag("id_field").Value.String())
+		logDebugf("bulk started")
+		keepID, _ := cmd.Flags().GetBool("keep-id")
+		autoID, _ := cmd.Flags().GetBool("auto-id")
+		hashID, _ := cmd.Flags().GetBool("hash-id")
+		actionField, _ := cmd.Flags().GetString("action-field")
+		upsert, _ := cmd.Flags().GetBool("upsert")
+		routing, _ := cmd.Flags().GetString("routing")
+		indexField, _ := cmd.Flags().GetString("index-field")
+		dateField, _ := cmd.Flags().GetString("date-field")
+		pipeline, _ := cmd.Flags().GetString("pipeline")
+		optimizeLoad, _ := cmd.Flags().GetBool("optimize-load")
+		pauseOnRed, _ := cmd.Flags().GetBool("pause-on-red")
+		pauseOnYellow, _ := cmd.Flags().GetBool("pause-on-yellow")
+		pauseRejections, _ := cmd.Flags().GetFloat64("pause-rejections")
+		healthInterval, _ := cmd.Flags().GetDuration("health-interval")
+		refresh, _ := cmd.Flags().GetString("refresh")
+		waitForActiveShards, _ := cmd.Flags().GetString("wait-for-active-shards")
+		transform, _ := cmd.Flags().GetString("transform")
+		where, _ := cmd.Flags().GetString("where")
+		schema, _ := cmd.Flags().GetString("schema")
+		skip, _ := cmd.Flags().GetInt("skip")
+		limit, _ := cmd.Flags().GetInt("limit")
+		sample, _ := cmd.Flags().GetFloat64("sample")
+		dedupe, _ := cmd.Flags().GetString("dedupe")
+		dedupeApprox, _ := cmd.Flags().GetBool("dedupe-approx")
+		dedupeCapacity, _ := cmd.Flags().GetInt("dedupe-capacity")
+		set, _ := cmd.Flags().GetStringArray("set")
+		drop, _ := cmd.Flags().GetStringArray("drop")
+		rename, _ := cmd.Flags().GetStringArray("rename")
+		timestampField, _ := cmd.Flags().GetString("timestamp-field")
+		embedField, _ := cmd.Flags().GetString("embed-field")
+		embedTarget, _ := cmd.Flags().GetString("embed-target")
+		embedEndpoint, _ := cmd.Flags().GetString("embed-endpoint")
+		embedModel, _ := cmd.Flags().GetString("embed-model")
+		embedAPIKey, _ := cmd.Flags().GetString("embed-api-key")
+		if embedAPIKey == "" {
+			embedAPIKey = os.Getenv("OPENSEARCH_EMBED_API_KEY")
+		}
+		embedBatchSize, _ := cmd.Flags().GetInt("embed-batch-size")
+		embedWorkers, _ := cmd.Flags().GetInt("embed-workers")
+		embedRetries, _ := cmd.Flags().GetInt("embed-retries")
+		maxDocsPerSec, _ := cmd.Flags().GetInt("max-docs-per-sec")
+		maxBytesPerSec, _ := cmd.Flags().GetInt("max-bytes-per-sec")
+		maxErrors, _ := cmd.Flags().GetInt("max-errors")
+		maxLineBytes, _ := cmd.Flags().GetInt("max-line-bytes")
+		routingField, _ := cmd.Flags().GetString("routing-field")
+		versionField, _ := cmd.Flags().GetString("version-field")
+		skipExisting, _ := cmd.Flags().GetBool("skip-existing")
+		versionType, _ := cmd.Flags().GetString("version-type")
+		files, _ := cmd.Flags().GetStringArray("file")
+		httpHeaders, _ := cmd.Flags().GetStringArray("http-header")
+		httpAuth, _ := cmd.Flags().GetString("http-auth")
+		watch, _ := cmd.Flags().GetString("watch")
+		watchPattern, _ := cmd.Flags().GetString("watch-pattern")
+		kafkaBrokers, _ := cmd.Flags().GetStringSlice("kafka-brokers")
+		kafkaTopic, _ := cmd.Flags().GetString("kafka-topic")
+		kafkaGroup, _ := cmd.Flags().GetString("kafka-group")
+		kafkaCommitInterval, _ := cmd.Flags().GetDuration("kafka-commit-interval")
+		schemaRegistry, _ := cmd.Flags().GetString("schema-registry")
+		dbDSN, _ := cmd.Flags().GetString("db-dsn")
+		dbQuery, _ := cmd.Flags().GetString("db-query")
+		fromBulkFile, _ := cmd.Flags().GetString("from-bulk-file")
+		types, _ := cmd.Flags().GetStringToString("types")
+		inferTypes, _ := cmd.Flags().GetBool("infer-types")
+		columns, _ := cmd.Flags().GetStringSlice("columns")
+		recordElement, _ := cmd.Flags().GetString("record-element")
+		workers, _ := cmd.Flags().GetInt("workers")
+		autoTune, _ := cmd.Flags().GetBool("auto-tune")
+		if autoTune && !cmd.Flags().Changed("workers") {
+			// the tuner's own default, rather than the fixed count's
+			workers = 0
+		}
+		flushBytes, _ := cmd.Flags().GetInt("flush-bytes")
+		flushInterval, _ := cmd.Flags().GetDuration("flush-interval")
+		failedOutput, _ := cmd.Flags().GetString("failed-output")
+		checkpoint, _ := cmd.Flags().GetString("checkpoint")
+		checkpointInterval, _ := cmd.Flags().GetDuration("checkpoint-interval")
+		resume, _ := cmd.Flags().GetBool("resume")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		toFile, _ := cmd.Flags().GetString("to-file")
+		validateMapping, _ := cmd.Flags().GetBool("validate-mapping")
+		statsOutput, _ := cmd.Flags().GetString("stats-output")
+		statsFile, _ := cmd.Flags().GetString("stats-file")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		progressInterval, _ := cmd.Flags().GetDuration("progress-interval")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		ctx, cancel := withTimeout(cmd.Context(), timeout)
+		stats, err := Bulk(ctx, BulkOptions{
+			Options: osdoc.Options{
+				Index:               cmd.Flag("index").Value.String(),
+				IndexField:          indexField,
+				DateField:           dateField,
+				Pipeline:            pipeline,
+				Refresh:             refresh,
+				WaitForActiveShards: waitForActiveShards,
+				Action:              cmd.Flag("action").Value.String(),
+				ActionField:         actionField,
+				Upsert:              upsert,
+				Routing:             routing,
+				RoutingField:        routingField,
+				VersionField:        versionField,
+				VersionType:         versionType,
+				SkipExisting:        skipExisting,
+				IDField:             cmd.Flag("id_field").Value.String(),
+				IDSeparator:         cmd.Flag("id-separator").Value.String(),
+				KeepID:              keepID,
+				AutoID:              autoID,
+				HashID:              hashID,
+				Format:              cmd.Flag("format").Value.String(),
+				Types:               types,
+				InferTypes:          inferTypes,
+				Columns:             columns,
+				RecordElement:       recordElement,
+				Transform:           transform,
+				Where:               where,
+				Schema:              schema,
+				Skip:                skip,
+				Limit:               limit,
+				Sample:              sample,
+				Dedupe:              dedupe,
+				DedupeApprox:        dedupeApprox,
+				DedupeCapacity:      dedupeCapacity,
+				Set:                 set,
+				Drop:                drop,
+				Rename:              rename,
+				TimestampField:      timestampField,
+				EmbedField:          embedField,
+				EmbedTarget:         embedTarget,
+				EmbedEndpoint:       embedEndpoint,
+				EmbedModel:          embedModel,
+				EmbedAPIKey:         embedAPIKey,
+				EmbedBatchSize:      embedBatchSize,
+				EmbedWorkers:        embedWorkers,
+				EmbedRetries:        embedRetries,
+				MaxLineBytes:        maxLineBytes,
+				Workers:             workers,
+				AutoTune:            autoTune,
+				FlushBytes:          flushBytes,
+				FlushInterval:       flushInterval,
+				MaxDocsPerSec:       maxDocsPerSec,
+				MaxBytesPerSec:      maxBytesPerSec,
+				OptimizeLoad:        optimizeLoad,
+				PauseOnRed:          pauseOnRed,
+				PauseOnYellow:       pauseOnYellow,
+				PauseRejections:     pauseRejections,
+				HealthInterval:      healthInterval,
+				FailedOutput:        failedOutput,
+				MaxErrors:           maxErrors,
+				Checkpoint:          checkpoint,
+				CheckpointInterval:  checkpointInterval,
+				Resume:              resume,
+				DryRun:              dryRun,
+				ToFile:              toFile,
+				ValidateMapping:     validateMapping,
+			},
+			Files:        files,
+			HTTPHeaders:  httpHeaders,
+			HTTPAuth:     httpAuth,
+			Watch:        watch,
+			WatchPattern: watchPattern,
+			Kafka: osdoc.KafkaOptions{
+				Brokers:        kafkaBrokers,
+				Topic:          kafkaTopic,
+				Group:          kafkaGroup,
+				CommitInterval: kafkaCommitInterval,
+				SchemaRegistry: schemaRegistry,
+			},
+			DBDSN:            dbDSN,
+			DBQuery:          dbQuery,
+			FromBulkFile:     fromBulkFile,
+			StatsOutput:      statsOutput,
+			StatsFile:        statsFile,
+			Quiet:            quiet,
+			ProgressInterval: progressInterval,
+		})
+		cancel()
+		if err != nil {
+			logErrorf("%s", err)
+		}
+		if code := bulkExitCode(dryRun, stats, err); code != 0 {
+			exit(code)
+		}
 	},
 }
 
@@ -63,130 +481,472 @@ func init() {
 	bulkCmd.Flags().StringP("index", "i", "", "The OpenSearch index for the documents")
 	// require an index flag
 	bulkCmd.MarkFlagRequired("index")
-	bulkCmd.Flags().StringP("id_field", "f", "_id", "The field to use as the document ID")
+	bulkCmd.Flags().String("index-field", "", "A field (or dotted path) giving the index of each document, overriding --index")
+	bulkCmd.Flags().String("date-field", "", "A field (or dotted path) giving the date used to expand a date pattern in the index name")
+	bulkCmd.Flags().String("pipeline", "", "An ingest pipeline to run the documents through")
+	bulkCmd.Flags().String("refresh", "", "Make the documents searchable: true to refresh after each request, or wait_for to wait for the next refresh")
+	bulkCmd.Flags().String("wait-for-active-shards", "", "The number of active shard copies (or all) each request waits for")
+	bulkCmd.Flags().StringP("id_field", "f", "_id", "The field to use as the document ID, or a dotted path to a nested field; several fields may be separated by commas")
+	bulkCmd.Flags().String("id-separator", ":", "The separator between the values of a composite document ID")
+	bulkCmd.Flags().Bool("keep-id", false, "Keep the ID field in the indexed document")
+	bulkCmd.Flags().Bool("auto-id", false, "Let OpenSearch assign IDs to documents without the ID field")
+	bulkCmd.Flags().Bool("hash-id", false, "Use a hash of the content as the ID of documents without the ID field")
+	bulkCmd.MarkFlagsMutuallyExclusive("auto-id", "hash-id")
+	// accept --id-field as well as --id_field
+	bulkCmd.Flags().SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "id-field" {
+			name = "id_field"
+		}
+		return pflag.NormalizedName(name)
+	})
 	bulkCmd.Flags().StringP("action", "a", "index", "What do to with the document: index, create, update, delete")
+	bulkCmd.Flags().String("action-field", "", "A field giving the action for each document, overriding --action")
+	bulkCmd.Flags().Bool("upsert", false, "For updates, index the document if it doesn't exist yet")
+	bulkCmd.Flags().String("routing", "", "A routing value for all documents")
+	bulkCmd.Flags().String("routing-field", "", "A field (or dotted path) giving the routing value of each document")
+	bulkCmd.Flags().String("version-field", "", "A field (or dotted path) giving the external version of each document")
+	bulkCmd.Flags().String("version-type", "external", "With --version-field, the version type: external or external_gte")
+	bulkCmd.Flags().Bool("skip-existing", false, "With the create action, don't count documents that already exist as failures")
+	bulkCmd.Flags().StringArrayP("file", "F", nil, "A file (or glob pattern), s3:// URL, or http(s):// URL to read documents from instead of stdin; may be repeated")
+	bulkCmd.Flags().StringArray("http-header", nil, "A header, as 'Name: value', to send when reading http(s):// URLs; may be repeated")
+	bulkCmd.Flags().String("http-auth", "", "A user:password for basic authentication when reading http(s):// URLs")
+	bulkCmd.Flags().String("watch", "", "A directory to index the JSON lines written to its files from, as they are written, until interrupted")
+	bulkCmd.Flags().String("watch-pattern", "*.ndjson", "The names of the files in the --watch directory to read, as a glob pattern")
+	bulkCmd.Flags().StringSlice("kafka-brokers", nil, "Kafka brokers, as host:port, to consume documents from until interrupted")
+	bulkCmd.Flags().String("kafka-topic", "", "With --kafka-brokers, the topic to consume")
+	bulkCmd.Flags().String("kafka-group", "", "With --kafka-brokers, the consumer group whose offsets are committed")
+	bulkCmd.Flags().Duration("kafka-commit-interval", 5*time.Second, "With --kafka-brokers, how often to commit the offsets of the documents flushed")
+	bulkCmd.Flags().String("schema-registry", "", "With --kafka-brokers and --format avro, the URL of the schema registry to decode messages with")
+	bulkCmd.Flags().String("db-dsn", "", "A postgres://, mysql://, or sqlite:// URL of a database to read the rows of --db-query from")
+	bulkCmd.Flags().String("db-query", "", "With --db-dsn, the query whose rows are the documents")
+	bulkCmd.Flags().String("format", "json", "The input format: json, csv, tsv, ids, parquet, avro, xml, or yaml")
+	bulkCmd.Flags().StringToString("types", nil, "Column types for csv/tsv input, e.g. age=int,price=float,active=bool")
+	bulkCmd.Flags().Bool("infer-types", false, "Infer int, float, and bool values for csv/tsv columns without a type")
+	bulkCmd.Flags().StringSlice("columns", nil, "For parquet input, the top-level columns to read; all of them if not given")
+	bulkCmd.Flags().String("record-element", "", "For xml input, the name of the elements that are documents")
+	bulkCmd.Flags().Int("skip", 0, "Skip this many documents at the start of the input")
+	bulkCmd.Flags().Int("limit", 0, "Stop after indexing this many documents; 0 for no limit")
+	bulkCmd.Flags().Float64("sample", 0, "Index a random sample of this fraction of the documents, e.g. 0.05")
+	bulkCmd.Flags().String("dedupe", "", "Drop documents with the same ID as another, keeping the first or last of them")
+	bulkCmd.Flags().Lookup("dedupe").NoOptDefVal = "first"
+	bulkCmd.Flags().Bool("dedupe-approx", false, "With --dedupe first, track IDs approximately in fixed memory")
+	bulkCmd.Flags().Int("dedupe-capacity", 10000000, "With --dedupe-approx, the number of IDs to size for")
+	bulkCmd.Flags().String("where", "", "A jq expression; only documents for which it is true are indexed")
+	bulkCmd.Flags().String("transform", "", "A jq expression applied to each document before it is indexed")
+	bulkCmd.Flags().StringArray("set", nil, "Set a field of each document, as key=value; may be repeated")
+	bulkCmd.Flags().StringArray("drop", nil, "Remove a field from each document; may be repeated")
+	bulkCmd.Flags().StringArray("rename", nil, "Rename a field of each document, as old=new; may be repeated")
+	bulkCmd.Flags().String("timestamp-field", "", "A field to set to the time each document is read")
+	bulkCmd.Flags().String("embed-field", "", "A text field (or dotted path) of each document to embed with --embed-endpoint")
+	bulkCmd.Flags().String("embed-target", "", "The field (or dotted path) to set to the embedding of the --embed-field")
+	bulkCmd.Flags().String("embed-endpoint", "", "The URL of an OpenAI-compatible embeddings API, such as https://api.openai.com/v1/embeddings")
+	bulkCmd.Flags().String("embed-model", "", "The model to ask the embeddings API for")
+	bulkCmd.Flags().String("embed-api-key", "", "A bearer token for the embeddings API (env OPENSEARCH_EMBED_API_KEY)")
+	bulkCmd.Flags().Int("embed-batch-size", 64, "The number of documents to embed in each request")
+	bulkCmd.Flags().Int("embed-workers", 4, "The number of embedding requests to make at once")
+	bulkCmd.Flags().Int("embed-retries", 3, "The most times to retry a failed embedding request")
+	bulkCmd.Flags().Int("max-line-bytes", 100<<20, "The longest JSON line to accept; longer lines are skipped")
+	bulkCmd.Flags().Int("workers", 4, "The number of indexer worker goroutines")
+	bulkCmd.Flags().Bool("auto-tune", false, "Adjust the number of concurrent bulk requests, up to --workers (default 16), to the cluster's responses")
+	bulkCmd.Flags().Int("flush-bytes", 5e+6, "The flush threshold in bytes")
+	bulkCmd.Flags().Duration("flush-interval", 30*time.Second, "The periodic flush interval")
+	bulkCmd.Flags().Int("max-docs-per-sec", 0, "The most documents to send per second; 0 for no limit")
+	bulkCmd.Flags().Int("max-bytes-per-sec", 0, "The most document bytes to send per second; 0 for no limit")
+	bulkCmd.Flags().Bool("optimize-load", false, "Turn off refresh and replicas on the index during the load")
+	bulkCmd.Flags().Bool("pause-on-red", false, "Pause sending documents while the cluster health is red")
+	bulkCmd.Flags().Bool("pause-on-yellow", false, "Pause sending documents while the cluster health is yellow or red")
+	bulkCmd.Flags().Float64("pause-rejections", 0, "Pause sending documents while the write thread pools reject more than this many requests a second; 0 for no limit")
+	bulkCmd.Flags().Duration("health-interval", 10*time.Second, "How often to check the cluster health with --pause-on-red, --pause-on-yellow, or --pause-rejections")
+	bulkCmd.Flags().Int("max-errors", 0, "Stop after this many documents fail; 0 for no limit")
+	bulkCmd.Flags().String("failed-output", "", "A file to write documents that fail to index to, as NDJSON")
+	bulkCmd.Flags().String("checkpoint", "", "A file to record progress in, so an interrupted load can be resumed")
+	bulkCmd.Flags().Duration("checkpoint-interval", 10*time.Second, "How often to write the checkpoint file")
+	bulkCmd.Flags().Bool("resume", false, "Skip the input already indexed according to the --checkpoint file")
+	bulkCmd.Flags().String("schema", "", "A JSON Schema file that documents must match to be indexed")
+	bulkCmd.Flags().Bool("dry-run", false, "Parse and validate the input without indexing anything")
+	bulkCmd.Flags().String("to-file", "", "Write the bulk request bodies to this file instead of sending them to the cluster")
+	bulkCmd.Flags().String("from-bulk-file", "", "Send a _bulk request body from this file, or - for stdin, in place of documents")
+	bulkCmd.Flags().Bool("validate-mapping", false, "With --dry-run, check documents against the index mapping")
+	bulkCmd.Flags().String("stats-output", "", "Write a summary of the run in this format: json")
+	bulkCmd.Flags().String("stats-file", "", "The file to write the --stats-output summary to (default stdout)")
+	bulkCmd.Flags().BoolP("quiet", "q", false, "Don't report progress")
+	bulkCmd.Flags().Duration("progress-interval", time.Second, "How often to report progress")
+	bulkCmd.Flags().Duration("timeout", 0, "The longest the load may take, after which the documents not yet sent are dropped; 0 for no limit")
 }
 
-func Bulk(index string, action string, idField string) {
-	fmt.Println("bulk called")
-	// TODO: add support for other configuration options
-	client, err := opensearch.NewClient(opensearch.Config{
-		// Retry on 429 TooManyRequests statuses
-		//
-		RetryOnStatus: []int{502, 503, 504, 429},
-
-		// A simple incremental backoff function
-		//
-		RetryBackoff: func(i int) time.Duration { return time.Duration(i) * 100 * time.Millisecond },
-
-		// Retry up to 5 attempts
-		//
-		MaxRetries: 5,
-	})
+// BulkOptions holds the settings for a bulk load: those of the loader, and
+// those of the command, such as where to read the documents from.
+type BulkOptions struct {
+	osdoc.Options
+
+	Files       []string // Files or glob patterns, or S3 or HTTP URLs, to read; stdin if empty
+	HTTPHeaders []string // Headers, as "Name: value", to send with HTTP requests
+	HTTPAuth    string   // A user:password for basic authentication of HTTP requests
+
+	Watch        string // A directory to read the lines written to its files from, until stopped
+	WatchPattern string // The names of the files in the Watch directory to read
+
+	Kafka osdoc.KafkaOptions // The Kafka topic to consume, if Kafka.Brokers isn't empty
+
+	DBDSN   string // The URL of a database to query
+	DBQuery string // The query whose rows are the documents
+
+	FromBulkFile string // A _bulk request body to send, or "-" for stdin, in place of documents
+
+	StatsOutput string // The format of the run summary: json, or "" for none
+	StatsFile   string // The file to write the run summary to; stdout if empty
+
+	Quiet            bool          // Don't report progress
+	ProgressInterval time.Duration // How often to report progress
+}
+
+// Bulk loads documents from the input files, or stdin, and returns the
+// Stats of the load. The error is for a load that couldn't be started or
+// wound up; documents that fail are only counted in the Stats. Once ctx is
+// done, the load stops and the documents not yet sent are dropped.
+func Bulk(ctx context.Context, opts BulkOptions) (osdoc.Stats, error) {
+	logDebugf("bulk called")
+	start := time.Now()
+	if opts.StatsOutput != "" && opts.StatsOutput != "json" {
+		return osdoc.Stats{}, fmt.Errorf("unknown stats output format '%s'", opts.StatsOutput)
+	}
+	if opts.DryRun && opts.ToFile != "" {
+		return osdoc.Stats{}, fmt.Errorf("--to-file can't be used with --dry-run")
+	}
+	if opts.DryRun && opts.FromBulkFile != "" {
+		return osdoc.Stats{}, fmt.Errorf("--from-bulk-file can't be used with --dry-run")
+	}
+	var client *opensearch.Client
+	if !opts.DryRun && opts.ToFile == "" || opts.ValidateMapping {
+		var err error
+		client, err = NewClient()
+		if err != nil {
+			return osdoc.Stats{}, &connectionError{fmt.Errorf("creating the client: %w", err)}
+		}
+		logDebugf("client created")
+	}
+	loader, err := osdoc.NewBulkLoader(ctx, client, opts.Options)
 	if err != nil {
-		log.Fatalf("Error creating the client: %s", err)
+		return osdoc.Stats{}, err
 	}
-	fmt.Println("client created")
-	// Create the indexer
-	//
-	indexer, err := opensearchutil.NewBulkIndexer(opensearchutil.BulkIndexerConfig{
-		Client:     client, // The OpenSearch client
-		Index:      index,  // The default index name
-		NumWorkers: 4,      // The number of worker goroutines (default: number of CPUs)
-		FlushBytes: 5e+6,   // The flush threshold in bytes (default: 5M)
+	if opts.DryRun {
+		return dryRun(loader, opts)
+	}
+	if opts.FromBulkFile != "" {
+		return load(loader, opts, start, func(p *progress) error {
+			return replay(loader, opts, p)
+		})
+	}
+	return load(loader, opts, start, func(p *progress) error {
+		return readAll(loader, opts, p)
 	})
-	if err != nil {
-		log.Fatalf("Error creating the indexer: %s", err)
-	}
-	fmt.Println("indexer created")
-	scanner := bufio.NewScanner(os.Stdin)
-	//for scanner.Scan() {
-	//	fmt.Println(scanner.Text())
-	//}
-
-	var f interface{}
-	// err := json.Unmarshal(b, &f)
-	// read a JSON object from stdin
-	for scanner.Scan() {
-		text := scanner.Text()
-		err := json.Unmarshal([]byte(text), &f)
-		if err != nil {
-			log.Printf("Error unmarshalling JSON: %s", err)
-		}
-
-		// get the document Id from the JSON object using the idField
-		documentMap := f.(map[string]interface{})
-		id := documentMap[idField]
-		if id == nil {
-			log.Printf("Error: document does not contain an value for the idField '%s'; not adding", idField)
-			continue
-		}
-		// Coerce the id to a string
-		idString := fmt.Sprintf("%v", id)
-		// remove the id field from the JSON object
-		delete(documentMap, idField)
-		// marshal the JSON object back to a byte array
-		document, err := json.Marshal(documentMap)
-		if err != nil {
-			log.Printf("Error marshalling JSON: %s", err)
-		}
-		// and make a string from it
-		fmt.Println("indexing", idString)
-		// Add an item to the indexer
-		//
-		err = indexer.Add(
-			context.Background(),
-			opensearchutil.BulkIndexerItem{
-				// Action field configures the operation to perform (index, create, delete, update)
-				Action: action,
-
-				// DocumentID is the optional document ID
-				DocumentID: idString,
-
-				// Body is the document, converted to a readable byte array
-				Body: strings.NewReader(string(document)),
-
-				// OnSuccess is the optional callback for each successful operation
-				OnSuccess: func(
-					ctx context.Context,
-					item opensearchutil.BulkIndexerItem,
-					res opensearchutil.BulkIndexerResponseItem,
-				) {
-					fmt.Printf("[%d] %s %s\n", res.Status, res.Result, item.DocumentID)
-				},
-
-				// OnFailure is the optional callback for each failed operation
-				OnFailure: func(
-					ctx context.Context,
-					item opensearchutil.BulkIndexerItem,
-					res opensearchutil.BulkIndexerResponseItem, err error,
-				) {
-					if err != nil {
-						log.Printf("ERROR: %s", err)
-					} else {
-						log.Printf("ERROR: %s: %s", res.Error.Type, res.Error.Reason)
-					}
-				},
-			},
-		)
-		if err != nil {
-			log.Fatalf("Unexpected error: %s", err)
-			fmt.Printf("Unexpected error: %s", err)
+}
+
+// load runs a load whose documents input adds to the loader, reporting
+// progress unless opts.Quiet is set, and reports the results. It returns
+// the Stats of the load, and the error from input or from closing the
+// loader.
+func load(loader *osdoc.BulkLoader, opts BulkOptions, start time.Time, input func(p *progress) error) (osdoc.Stats, error) {
+	currentLoad.Store(loader)
+	var p *progress
+	if !opts.Quiet && opts.ProgressInterval > 0 {
+		size := inputSize(opts.Files)
+		if opts.Watch != "" || len(opts.Kafka.Brokers) > 0 || opts.DBDSN != "" {
+			size = 0
+		}
+		if opts.FromBulkFile != "" && opts.FromBulkFile != "-" {
+			size = inputSize([]string{opts.FromBulkFile})
 		}
+		p = newProgress(size, loader.Stats)
 	}
-	// Close the indexer channel and flush remaining items
-	//
-	if err := indexer.Close(context.Background()); err != nil {
-		log.Fatalf("Unexpected error: %s", err)
+	stopProgress := p.reportEvery(opts.ProgressInterval)
+	// On an interrupt, stop reading but flush what has been read; a second
+	// interrupt cancels the flush, and a third kills the process
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		if sig, ok := <-signals; ok {
+			logWarnf("Received %s; flushing the documents already read", sig)
+			loader.Stop()
+		}
+		if sig, ok := <-signals; ok {
+			signal.Stop(signals)
+			logWarnf("Received %s; dropping the documents not yet sent", sig)
+			loader.Cancel()
+		}
+	}()
+	inputErr := input(p)
+	signal.Stop(signals)
+	close(signals)
+	stats, err := loader.Close()
+	stopProgress()
+	if inputErr != nil {
+		if err != nil {
+			logErrorf("%s", err)
+		}
+		err = inputErr
 	}
 
 	// Report the indexer statistics
 	//
-	stats := indexer.Stats()
-	if stats.NumFailed > 0 {
-		log.Fatalf("Indexed [%d] documents with [%d] errors", stats.NumFlushed, stats.NumFailed)
+	if opts.ToFile != "" {
+		logInfof("Wrote [%d] documents to %s", stats.Flushed, opts.ToFile)
+	} else if stats.Failed > 0 {
+		logWarnf("Indexed [%d] documents with [%d] errors", stats.Flushed, stats.Failed)
+	} else {
+		logInfof("Successfully indexed [%d] documents", stats.Flushed)
+	}
+	// A JSON summary on stdout replaces the text one
+	textSummary := opts.StatsOutput == "" || (opts.StatsFile != "" && opts.StatsFile != "-")
+	if opts.ToFile != "" && textSummary {
+		fmt.Printf("Wrote [%d] documents to %s, with [%d] rejected\n", stats.Flushed, opts.ToFile, stats.Failed)
+		if stats.Skipped > 0 {
+			fmt.Printf("Skipped [%d] documents\n", stats.Skipped)
+		}
+		if stats.Duplicates > 0 {
+			fmt.Printf("Dropped [%d] duplicate documents\n", stats.Duplicates)
+		}
+	} else if textSummary {
+		fmt.Printf("Indexed [%d] documents with [%d] errors\n", stats.Flushed, stats.Failed)
+		if stats.Skipped > 0 {
+			fmt.Printf("Skipped [%d] documents\n", stats.Skipped)
+		}
+		if stats.Duplicates > 0 {
+			fmt.Printf("Dropped [%d] duplicate documents\n", stats.Duplicates)
+		}
+		if stats.Conflicts > 0 {
+			fmt.Printf("Ignored [%d] version conflicts\n", stats.Conflicts)
+		}
+		if stats.Existing > 0 {
+			if opts.SkipExisting {
+				fmt.Printf("Skipped [%d] existing documents\n", stats.Existing)
+			} else {
+				fmt.Printf("Failed to create [%d] existing documents\n", stats.Existing)
+			}
+		}
+	}
+	if opts.StatsOutput != "" {
+		summary := newBulkSummary(stats, start, bulkExitCode(false, stats, err))
+		if err := writeSummary(summary, opts.StatsFile); err != nil {
+			logErrorf("Error writing the stats summary: %s", err)
+		}
+	}
+	return stats, err
+}
+
+// The exit codes of a bulk load that doesn't succeed completely
+const (
+	exitConnectionFailure = 2 // The cluster couldn't be reached
+	exitPartialFailure    = 3 // Some documents failed
+	exitTotalFailure      = 4 // Every document failed
+)
+
+// connectionError is an error reaching a cluster, for which the exit code
+// is exitConnectionFailure.
+type connectionError struct {
+	err error
+}
+
+func (e *connectionError) Error() string { return e.err.Error() }
+func (e *connectionError) Unwrap() error { return e.err }
+
+// exitCode returns the exit code for a load that indexed some documents and
+// failed to index others, with some bulk requests failing outright.
+func exitCode(indexed, failed uint64, requestErrors int64) int {
+	switch {
+	case failed == 0:
+		return 0
+	case indexed > 0:
+		return exitPartialFailure
+	case requestErrors > 0:
+		return exitConnectionFailure
+	}
+	return exitTotalFailure
+}
+
+// bulkExitCode returns the exit code for a load, or a dry run, that
+// returned stats and err. A dry run with invalid documents, or a load that
+// otherwise succeeded but returned an error, exits with 1.
+func bulkExitCode(dryRun bool, stats osdoc.Stats, err error) int {
+	var connErr *connectionError
+	if errors.As(err, &connErr) || errors.Is(err, context.DeadlineExceeded) {
+		return exitConnectionFailure
+	}
+	code := 0
+	if dryRun {
+		if stats.Rejected > 0 {
+			code = 1
+		}
 	} else {
-		log.Printf("Successfully indexed [%d] documents", stats.NumFlushed)
+		code = exitCode(stats.Flushed, stats.Failed, stats.RequestErrors)
+	}
+	if code == 0 && err != nil {
+		code = 1
+	}
+	return code
+}
+
+// withTimeout returns a context derived from ctx that is done after
+// timeout, or when ctx is, if timeout isn't positive.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// dryRun reads and validates all of the input without indexing it, and
+// reports a summary.
+func dryRun(loader *osdoc.BulkLoader, opts BulkOptions) (osdoc.Stats, error) {
+	readErr := readAll(loader, opts, nil)
+	stats, err := loader.Close()
+	if readErr != nil {
+		if err != nil {
+			logErrorf("%s", err)
+		}
+		err = readErr
+	}
+	fmt.Printf("Dry run: [%d] documents valid, [%d] invalid\n", stats.Valid, stats.Rejected)
+	if stats.Skipped > 0 {
+		fmt.Printf("Skipped [%d] documents\n", stats.Skipped)
+	}
+	if stats.Duplicates > 0 {
+		fmt.Printf("Dropped [%d] duplicate documents\n", stats.Duplicates)
+	}
+	return stats, err
+}
+
+// readAll adds the documents of each input to the loader in turn: files
+// (or glob patterns), s3:// URLs, and http:// or https:// URLs, or stdin if
+// there are none; or those written to the --watch directory, or the
+// messages of the Kafka topic, until the load is stopped; or the rows of
+// the --db-query. The bytes read count toward the progress.
+func readAll(loader *osdoc.BulkLoader, opts BulkOptions, p *progress) error {
+	parse := func(name string, r io.Reader, add osdoc.AddFunc) error {
+		return loader.Parse(name, p.reader(r), add)
+	}
+	src, err := inputSource(loader.Context(), opts, parse)
+	if err != nil {
+		return err
+	}
+	return loader.Load(src)
+}
+
+// replay sends the _bulk request body in the --from-bulk-file, or stdin for
+// "-". The bytes read count toward the progress.
+func replay(loader *osdoc.BulkLoader, opts BulkOptions, p *progress) error {
+	if len(opts.Files) > 0 || opts.Watch != "" || len(opts.Kafka.Brokers) > 0 || opts.DBDSN != "" {
+		return fmt.Errorf("--from-bulk-file can't be used with --file, --watch, --kafka-brokers, or --db-dsn")
+	}
+	if opts.FromBulkFile == "-" {
+		return loader.Replay("stdin", p.reader(os.Stdin))
+	}
+	file, err := os.Open(opts.FromBulkFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return loader.Replay(opts.FromBulkFile, p.reader(file))
+}
+
+// inputSource returns the DocumentSource for the database query, the Kafka
+// topic, the --watch directory, or the inputs named by the -F flags, or stdin
+// if there are none.
+func inputSource(ctx context.Context, opts BulkOptions, parse osdoc.Parser) (osdoc.DocumentSource, error) {
+	if opts.DBDSN != "" {
+		switch {
+		case len(opts.Files) > 0 || opts.Watch != "" || len(opts.Kafka.Brokers) > 0:
+			return nil, fmt.Errorf("--db-dsn can't be used with --file, --watch, or --kafka-brokers")
+		case opts.DBQuery == "":
+			return nil, fmt.Errorf("--db-dsn needs a --db-query")
+		}
+		driver, dsn, err := sqlDriver(opts.DBDSN)
+		if err != nil {
+			return nil, err
+		}
+		src, err := osdoc.NewSQLSource(ctx, driver, dsn, opts.DBQuery)
+		if err != nil {
+			return nil, &connectionError{fmt.Errorf("connecting to the database: %w", err)}
+		}
+		return src, nil
+	}
+	if len(opts.Kafka.Brokers) > 0 {
+		switch {
+		case len(opts.Files) > 0 || opts.Watch != "":
+			return nil, fmt.Errorf("--kafka-brokers can't be used with --file or --watch")
+		case opts.Checkpoint != "":
+			// the consumer group's offsets are the checkpoint
+			return nil, fmt.Errorf("--kafka-brokers can't be used with --checkpoint")
+		case opts.Kafka.Topic == "" || opts.Kafka.Group == "":
+			return nil, fmt.Errorf("--kafka-brokers needs --kafka-topic and --kafka-group")
+		case opts.Format != "json" && opts.Format != "avro":
+			return nil, fmt.Errorf("--kafka-brokers reads JSON or Avro messages, so can't be used with --format %s", opts.Format)
+		case (opts.Format == "avro") != (opts.Kafka.SchemaRegistry != ""):
+			return nil, fmt.Errorf("Avro messages need --format avro and a --schema-registry")
+		}
+		return osdoc.NewKafkaSource(ctx, opts.Kafka)
+	}
+	if opts.Watch != "" {
+		switch {
+		case len(opts.Files) > 0:
+			return nil, fmt.Errorf("--watch can't be used with --file")
+		case opts.Format != "json":
+			return nil, fmt.Errorf("--watch reads lines of JSON, so can't be used with --format %s", opts.Format)
+		}
+		return osdoc.NewWatchSource(ctx, opts.Watch, opts.WatchPattern, opts.MaxLineBytes)
+	}
+	if len(opts.Files) == 0 {
+		return osdoc.NewReaderSource("stdin", os.Stdin, parse), nil
+	}
+	httpOpts, err := httpOptions(opts.HTTPHeaders, opts.HTTPAuth)
+	if err != nil {
+		return nil, err
 	}
-	fmt.Printf("Indexed [%d] documents with [%d] errors\n", stats.NumFlushed, stats.NumFailed)
+	var sources []osdoc.DocumentSource
+	var s3Client *s3.S3
+	for _, input := range opts.Files {
+		switch {
+		case strings.HasPrefix(input, "s3://"):
+			if s3Client == nil {
+				var err error
+				s3Client, err = newS3Client()
+				if err != nil {
+					return nil, fmt.Errorf("creating the S3 client: %w", err)
+				}
+			}
+			src, err := osdoc.NewS3Source(ctx, s3Client, input, parse)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, src)
+		case isURL(input):
+			sources = append(sources, osdoc.NewHTTPSource(ctx, httpOpts, []string{input}, parse))
+		default:
+			sources = append(sources, osdoc.NewGlobSource([]string{input}, parse))
+		}
+	}
+	return osdoc.MultiSource(sources...), nil
+}
+
+// httpOptions returns the settings for reading HTTP URLs, with headers
+// given as "Name: value", and basic authentication if auth, a
+// user:password, isn't empty.
+func httpOptions(headers []string, auth string) (osdoc.HTTPOptions, error) {
+	opts := osdoc.HTTPOptions{Header: http.Header{}, Retries: viper.GetInt("max-retries")}
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return opts, fmt.Errorf("--http-header '%s' isn't 'Name: value'", header)
+		}
+		opts.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if auth != "" {
+		opts.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(auth)))
+	}
+	return opts, nil
+}
+
+// isURL reports whether an input is an http:// or https:// URL.
+func isURL(input string) bool {
+	return strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
 }
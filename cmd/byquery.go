@@ -0,0 +1,188 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// deleteByQueryCmd represents the delete-by-query command
+var deleteByQueryCmd = &cobra.Command{
+	Use:   "delete-by-query",
+	Short: "Delete the documents matching a query",
+	Long: `Delete the documents of an index matching the query in a JSON file, which may wrap it
+	in a "query" key. The deletion runs in the cluster as a task; its ID is printed, and with
+	--wait, its progress is reported until it finishes. --slices splits it into parallel
+	slices, or --slices auto picks one per shard. To delete every document, give a
+	match_all query.
+	$ opensearch-doc delete-by-query -i logs --query older-than-90-days.json --wait --slices auto`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ByQuery(byQueryOptionsFrom(cmd, "delete"))
+	},
+}
+
+// updateByQueryCmd represents the update-by-query command
+var updateByQueryCmd = &cobra.Command{
+	Use:   "update-by-query",
+	Short: "Update the documents matching a query with a script",
+	Long: `Update the documents of an index matching the query in a JSON file, or all of them if
+	there is no --query, by running a Painless script from a file on each. Without a script,
+	the documents are reindexed in place, which picks up mapping changes. The update runs in
+	the cluster as a task; its ID is printed, and with --wait, its progress is reported until
+	it finishes. --slices splits it into parallel slices, or --slices auto picks one per shard.
+	$ opensearch-doc update-by-query -i users --query inactive.json --script archive.painless --wait`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ByQuery(byQueryOptionsFrom(cmd, "update"))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deleteByQueryCmd, updateByQueryCmd)
+
+	for _, cmd := range []*cobra.Command{deleteByQueryCmd, updateByQueryCmd} {
+		cmd.Flags().StringP("index", "i", "", "The index (or comma-separated indices or wildcard)")
+		cmd.Flags().String("query", "", "A JSON file of the query selecting the documents; - for stdin")
+		cmd.Flags().String("slices", "1", "The number of slices to run in parallel, or auto for one per shard")
+		cmd.Flags().Int("requests-per-second", 0, "The most batches to process per second; 0 for no limit")
+		cmd.Flags().Bool("proceed-on-conflicts", false, "Count version conflicts instead of stopping at the first")
+		cmd.Flags().Bool("wait", false, "Wait for the task to finish, reporting its progress")
+		cmd.Flags().Duration("poll-interval", 5*time.Second, "How often to report progress with --wait")
+		cmd.MarkFlagRequired("index")
+	}
+	deleteByQueryCmd.MarkFlagRequired("query")
+	updateByQueryCmd.Flags().String("script", "", "A file of a Painless script to run on each document")
+}
+
+// ByQueryOptions holds the settings for a delete or update by query.
+type ByQueryOptions struct {
+	Operation string // delete or update
+	Index     string // The indices, separated by commas
+	Query     string // A JSON file of the query, or - for stdin
+	Script    string // For updates, a file of a Painless script
+
+	Slices             string        // A number of slices, or auto
+	RequestsPerSecond  int           // The most batches per second, if positive
+	ProceedOnConflicts bool          // Count version conflicts instead of stopping
+	Wait               bool          // Wait for the task to finish
+	PollInterval       time.Duration // How often to report progress
+}
+
+// byQueryOptionsFrom reads the ByQueryOptions from the flags of the
+// command for an operation.
+func byQueryOptionsFrom(cmd *cobra.Command, operation string) ByQueryOptions {
+	opts := ByQueryOptions{Operation: operation}
+	opts.Index, _ = cmd.Flags().GetString("index")
+	opts.Query, _ = cmd.Flags().GetString("query")
+	opts.Slices, _ = cmd.Flags().GetString("slices")
+	opts.RequestsPerSecond, _ = cmd.Flags().GetInt("requests-per-second")
+	opts.ProceedOnConflicts, _ = cmd.Flags().GetBool("proceed-on-conflicts")
+	opts.Wait, _ = cmd.Flags().GetBool("wait")
+	opts.PollInterval, _ = cmd.Flags().GetDuration("poll-interval")
+	if operation == "update" {
+		opts.Script, _ = cmd.Flags().GetString("script")
+	}
+	return opts
+}
+
+// ByQuery starts a delete or update by query, and waits for it to finish
+// if opts.Wait is set.
+func ByQuery(opts ByQueryOptions) {
+	body := map[string]interface{}{}
+	if opts.Query != "" {
+		query, err := readJSONFile(opts.Query, "query")
+		if err != nil {
+			logFatalf("Error reading the query: %s", err)
+		}
+		body["query"] = query
+	}
+	if opts.Script != "" {
+		source, err := os.ReadFile(opts.Script)
+		if err != nil {
+			logFatalf("Error reading the script: %s", err)
+		}
+		body["script"] = map[string]interface{}{"source": string(source), "lang": "painless"}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		logFatalf("Error encoding the request: %s", err)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	wait := false
+	conflicts := ""
+	if opts.ProceedOnConflicts {
+		conflicts = "proceed"
+	}
+	var requestsPerSecond *int
+	if opts.RequestsPerSecond > 0 {
+		requestsPerSecond = &opts.RequestsPerSecond
+	}
+	var res *opensearchapi.Response
+	if opts.Operation == "delete" {
+		res, err = opensearchapi.DeleteByQueryRequest{
+			Index:             strings.Split(opts.Index, ","),
+			Body:              bytes.NewReader(data),
+			Conflicts:         conflicts,
+			RequestsPerSecond: requestsPerSecond,
+			Slices:            opts.Slices,
+			WaitForCompletion: &wait,
+		}.Do(context.Background(), client)
+	} else {
+		res, err = opensearchapi.UpdateByQueryRequest{
+			Index:             strings.Split(opts.Index, ","),
+			Body:              bytes.NewReader(data),
+			Conflicts:         conflicts,
+			RequestsPerSecond: requestsPerSecond,
+			Slices:            opts.Slices,
+			WaitForCompletion: &wait,
+		}.Do(context.Background(), client)
+	}
+	if err != nil {
+		logFatalf("Error starting the %s by query: %s", opts.Operation, err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error starting the %s by query: %s", opts.Operation, err)
+	}
+	var started struct {
+		Task string `json:"task"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&started); err != nil {
+		logFatalf("Error reading the response: %s", err)
+	}
+	if !opts.Wait {
+		fmt.Printf("Started %s by query task [%s]\n", opts.Operation, started.Task)
+		return
+	}
+	logInfof("Started %s by query task [%s]", opts.Operation, started.Task)
+	status, failures, err := waitForTask(client, started.Task, opts.PollInterval)
+	if err != nil {
+		logFatalf("Error in %s by query task [%s]: %s", opts.Operation, started.Task, err)
+	}
+	for _, failure := range failures {
+		logErrorf("Error with a document: %s", failure)
+	}
+	verb, changed := "Deleted", status.Deleted
+	if opts.Operation == "update" {
+		verb, changed = "Updated", status.Updated
+	}
+	fmt.Printf("%s [%d] of [%d] documents: [%d] conflicts, [%d] noops, [%d] failures\n",
+		verb, changed, status.Total, status.VersionConflicts, status.Noops, len(failures))
+	if len(failures) > 0 {
+		exit(exitPartialFailure)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// catAPI is one of the cat APIs, which list some part of the cluster's
+// state a row at a time.
+type catAPI struct {
+	use     string   // the subcommand, e.g. "shards [index]"
+	kind    string   // as in messages, e.g. "shards"
+	short   string   // the subcommand's short help
+	columns []string // the columns shown by default
+	// request returns the request for columns sorted by sort, optionally
+	// for the objects named by arg, such as an index or a node
+	request func(columns []string, sort []string, arg string) apiRequest
+}
+
+var catAPIs = []catAPI{
+	{
+		use:     "nodes",
+		kind:    "nodes",
+		short:   "List the nodes, with their roles and load",
+		columns: []string{"name", "ip", "node.role", "master", "heap.percent", "ram.percent", "cpu", "load_1m", "disk.used_percent"},
+		request: func(columns []string, sort []string, arg string) apiRequest {
+			return opensearchapi.CatNodesRequest{Format: "json", H: columns, S: sort}
+		},
+	},
+	{
+		use:     "shards [index]",
+		kind:    "shards",
+		short:   "List the shards, optionally of some indices, with their state and node",
+		columns: []string{"index", "shard", "prirep", "state", "docs", "store", "node"},
+		request: func(columns []string, sort []string, arg string) apiRequest {
+			req := opensearchapi.CatShardsRequest{Format: "json", H: columns, S: sort}
+			if arg != "" {
+				req.Index = []string{arg}
+			}
+			return req
+		},
+	},
+	{
+		use:     "allocation [node]",
+		kind:    "allocation",
+		short:   "List the shards and disk space allocated to each node",
+		columns: []string{"node", "shards", "disk.indices", "disk.used", "disk.avail", "disk.total", "disk.percent"},
+		request: func(columns []string, sort []string, arg string) apiRequest {
+			req := opensearchapi.CatAllocationRequest{Format: "json", H: columns, S: sort}
+			if arg != "" {
+				req.NodeID = []string{arg}
+			}
+			return req
+		},
+	},
+	{
+		use:     "tasks [actions]",
+		kind:    "tasks",
+		short:   "List the running tasks, optionally those whose actions match a wildcard",
+		columns: []string{"action", "task_id", "parent_task_id", "type", "start_time", "running_time", "node"},
+		request: func(columns []string, sort []string, arg string) apiRequest {
+			req := opensearchapi.CatTasksRequest{Format: "json", H: columns, S: sort}
+			if arg != "" {
+				req.Actions = []string{arg}
+			}
+			return req
+		},
+	},
+}
+
+// catCmd represents the cat command
+var catCmd = &cobra.Command{
+	Use:   "cat",
+	Short: "List nodes, shards, allocation, or tasks",
+	Long: `List the cluster's nodes, shards, disk allocation, or running tasks, to find out why
+	a bulk load is slow, such as a node that is hot or short of disk, or shards that are
+	relocating. The output is a table, or with --format, JSON (a row per line) or CSV.
+	--columns picks the columns, by the names the cat APIs use, and --sort sorts by them.
+	$ opensearch-doc cat nodes
+	$ opensearch-doc cat shards 'logs-*' --sort store:desc
+	$ opensearch-doc cat tasks '*bulk*' --format json`,
+}
+
+func init() {
+	rootCmd.AddCommand(catCmd)
+	for _, api := range catAPIs {
+		catCmd.AddCommand(newCatCmd(api))
+	}
+
+	catCmd.PersistentFlags().String("format", "table", "The output format: table, json, or csv")
+	catCmd.PersistentFlags().StringSlice("sort", nil, "The columns to sort by, separated by commas; add :desc to reverse")
+}
+
+// newCatCmd returns the subcommand for a cat API.
+func newCatCmd(api catAPI) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   api.use,
+		Short: api.short,
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			arg := ""
+			if len(args) > 0 {
+				arg = args[0]
+			}
+			format, _ := cmd.Flags().GetString("format")
+			columns, _ := cmd.Flags().GetStringSlice("columns")
+			sort, _ := cmd.Flags().GetStringSlice("sort")
+			Cat(api, arg, format, columns, sort)
+		},
+	}
+	cmd.Flags().StringSlice("columns", api.columns, "The columns to show, separated by commas")
+	return cmd
+}
+
+// Cat prints the rows of a cat API, optionally for the objects named by arg,
+// in a format: table, json, or csv.
+func Cat(api catAPI, arg string, format string, columns []string, sort []string) {
+	if format != "table" && format != "json" && format != "csv" {
+		logFatalf("unknown format '%s'", format)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := api.request(columns, sort, arg).Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error listing the %s: %s", api.kind, err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error listing the %s: %s", api.kind, err)
+	}
+	var rows []json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+		logFatalf("Error reading the %s: %s", api.kind, err)
+	}
+	if err := writeCatRows(os.Stdout, rows, format, columns); err != nil {
+		logFatalf("Error writing the %s: %s", api.kind, err)
+	}
+}
+
+// writeCatRows writes the rows of a cat response to w: as JSON, one row per
+// line, or as a table or CSV of the columns.
+func writeCatRows(w io.Writer, rows []json.RawMessage, format string, columns []string) error {
+	if format == "json" {
+		var out bytes.Buffer
+		for _, row := range rows {
+			json.Compact(&out, row)
+			out.WriteByte('\n')
+		}
+		_, err := out.WriteTo(w)
+		return err
+	}
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		var values map[string]interface{}
+		if err := json.Unmarshal(row, &values); err != nil {
+			return fmt.Errorf("row %d: %s", i+1, err)
+		}
+		cells[i] = make([]string, len(columns))
+		for j, column := range columns {
+			cells[i][j] = cellValue(values[column])
+		}
+	}
+	return writeRows(w, format, columns, cells)
+}
@@ -0,0 +1,220 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+// requestRetries counts the requests retried by clients from NewClient.
+var requestRetries atomic.Int64
+
+// NewClient creates an OpenSearch client from the connection settings
+// shared by all commands: flags, OPENSEARCH_* environment variables, and
+// the config file, in that order of precedence.
+func NewClient() (*opensearch.Client, error) {
+	return newClient(stringList(viper.Get("url")))
+}
+
+// newClient creates a client for the cluster at addresses, with the other
+// connection settings shared by all commands.
+func newClient(addresses []string) (*opensearch.Client, error) {
+	username := viper.GetString("username")
+	password := viper.GetString("password")
+	if username != "" && password == "" {
+		var err error
+		password, err = promptPassword(username)
+		if err != nil {
+			return nil, err
+		}
+		// commands with two clients, such as copy, ask only once
+		viper.Set("password", password)
+	}
+
+	httpTransport, err := newHTTPTransport()
+	if err != nil {
+		return nil, err
+	}
+	var transport http.RoundTripper = &tracingTransport{next: &metricsTransport{next: httpTransport}}
+	if apiKey := viper.GetString("api-key"); apiKey != "" {
+		transport = &apiKeyTransport{apiKey: apiKey, next: transport}
+	}
+	if viper.GetBool("aws-sigv4") {
+		transport, err = newAWSTransport(transport)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	retryOnStatus, err := intList(viper.Get("retry-on-status"))
+	if err != nil {
+		return nil, fmt.Errorf("--retry-on-status: %w", err)
+	}
+	backoff := viper.GetDuration("retry-backoff")
+	var sniffInterval time.Duration
+	if viper.GetBool("sniff") {
+		sniffInterval = viper.GetDuration("sniff-interval")
+	}
+
+	return opensearch.NewClient(opensearch.Config{
+		// The cluster's nodes, used in turn and skipped while they're down
+		//
+		Addresses: addresses,
+
+		// With --sniff, find the cluster's other nodes at the start and
+		// periodically after
+		//
+		DiscoverNodesOnStart:  viper.GetBool("sniff"),
+		DiscoverNodesInterval: sniffInterval,
+
+		// Credentials for HTTP basic authentication
+		//
+		Username: username,
+		Password: password,
+
+		// The HTTP transport, with the TLS settings, and the API key header
+		// or AWS request signature if either is configured
+		//
+		Transport: transport,
+
+		// Gzip request bodies
+		//
+		CompressRequestBody: viper.GetBool("compress"),
+
+		// Retry on these statuses, by default 429 TooManyRequests and
+		// gateway errors
+		//
+		RetryOnStatus: retryOnStatus,
+
+		// Exponential backoff with jitter
+		//
+		RetryBackoff: func(i int) time.Duration {
+			requestRetries.Add(1)
+			return retryDelay(backoff, i)
+		},
+
+		// Retry up to --max-retries attempts
+		//
+		MaxRetries:   viper.GetInt("max-retries"),
+		DisableRetry: viper.GetInt("max-retries") == 0,
+	})
+}
+
+// maxRetryDelay caps the delay between retries.
+const maxRetryDelay = 30 * time.Second
+
+func init() {
+	// so that the retries of separate runs don't line up
+	rand.Seed(time.Now().UnixNano())
+}
+
+// retryDelay returns how long to wait before the given retry, starting
+// from 1: a random duration up to base doubled for each earlier retry, so
+// that clients retrying together spread out.
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	limit := maxRetryDelay
+	if attempt < 30 && base<<(attempt-1) < limit {
+		limit = base << (attempt - 1)
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit))) + 1
+}
+
+// stringList converts a setting that may be a list, or a string of values
+// separated by commas (as from an environment variable), to strings.
+func stringList(value interface{}) []string {
+	var values []string
+	switch v := value.(type) {
+	case []string:
+		values = v
+	case []interface{}:
+		for _, x := range v {
+			values = append(values, fmt.Sprint(x))
+		}
+	default:
+		values = strings.Split(fmt.Sprint(v), ",")
+	}
+	var list []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// intList converts a setting that may be a list, or a string of numbers
+// separated by commas (as from a flag or environment variable), to ints.
+func intList(value interface{}) ([]int, error) {
+	switch v := value.(type) {
+	case []int:
+		return v, nil
+	case []interface{}:
+		ints := make([]int, len(v))
+		for i, x := range v {
+			n, err := strconv.Atoi(fmt.Sprint(x))
+			if err != nil {
+				return nil, err
+			}
+			ints[i] = n
+		}
+		return ints, nil
+	case string:
+		var ints []int
+		for _, field := range strings.FieldsFunc(strings.Trim(v, "[]"), func(r rune) bool { return r == ',' || r == ' ' }) {
+			n, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, err
+			}
+			ints = append(ints, n)
+		}
+		return ints, nil
+	}
+	return nil, fmt.Errorf("can't use %v as a list of numbers", value)
+}
+
+// promptPassword asks for the password for username on the terminal. It is
+// an error if stdin isn't a terminal, since stdin may be carrying documents.
+func promptPassword(username string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", errors.New("a password is required for --username; set --password or OPENSEARCH_PASSWORD")
+	}
+	fmt.Fprintf(os.Stderr, "Password for %s: ", username)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
+
+// apiKeyTransport adds an API key Authorization header to each request.
+type apiKeyTransport struct {
+	apiKey string
+	next   http.RoundTripper
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "ApiKey "+t.apiKey)
+	return t.next.RoundTrip(req)
+}
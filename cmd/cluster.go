@@ -0,0 +1,177 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// clusterCmd represents the cluster command
+var clusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "Inspect the opensearch cluster",
+	Long: `Inspect the opensearch cluster.
+	$ opensearch-doc cluster health`,
+}
+
+// clusterHealthCmd represents the cluster health command
+var clusterHealthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Show the cluster's health, optionally waiting for a status",
+	Long: `Show the status of the cluster (green, yellow, or red), its node and shard counts, and
+	the number of pending tasks. With -i, the health of just those indices is shown.
+
+	With --wait-for-status, the command waits until the cluster reaches at least that status,
+	for up to --timeout, asking again while the cluster can't be reached or isn't ready; the
+	exit status is 1 if it didn't in time. This is handy before starting a large load in CI:
+	$ opensearch-doc cluster health --wait-for-status yellow --timeout 120s && opensearch-doc bulk ...`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, _ := cmd.Flags().GetString("index")
+		waitForStatus, _ := cmd.Flags().GetString("wait-for-status")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		format, _ := cmd.Flags().GetString("format")
+		exit(ClusterHealth(ClusterHealthOptions{
+			Index:         index,
+			WaitForStatus: waitForStatus,
+			Timeout:       timeout,
+			Format:        format,
+		}))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(clusterCmd)
+	clusterCmd.AddCommand(clusterHealthCmd)
+
+	clusterHealthCmd.Flags().StringP("index", "i", "", "The index (or comma-separated indices or wildcard) to show the health of")
+	clusterHealthCmd.Flags().String("wait-for-status", "", "Wait until the status is at least green, yellow, or red")
+	clusterHealthCmd.Flags().Duration("timeout", 30*time.Second, "How long to wait for the status")
+	clusterHealthCmd.Flags().String("format", "text", "The output format: text or json")
+}
+
+// ClusterHealthOptions holds the settings for a cluster health check.
+type ClusterHealthOptions struct {
+	Index         string        // The indices to show the health of; all if empty
+	WaitForStatus string        // green, yellow, or red, to wait for
+	Timeout       time.Duration // How long to wait for the status
+	Format        string        // text or json
+}
+
+// clusterHealth is the part of a cluster health response that is reported.
+type clusterHealth struct {
+	ClusterName         string `json:"cluster_name"`
+	Status              string `json:"status"`
+	TimedOut            bool   `json:"timed_out"`
+	NumberOfNodes       int    `json:"number_of_nodes"`
+	NumberOfDataNodes   int    `json:"number_of_data_nodes"`
+	ActivePrimaryShards int    `json:"active_primary_shards"`
+	ActiveShards        int    `json:"active_shards"`
+	RelocatingShards    int    `json:"relocating_shards"`
+	InitializingShards  int    `json:"initializing_shards"`
+	UnassignedShards    int    `json:"unassigned_shards"`
+	PendingTasks        int    `json:"number_of_pending_tasks"`
+}
+
+// clusterHealthRetryInterval is how long a wait for a status waits before
+// asking a cluster that couldn't be asked again.
+const clusterHealthRetryInterval = time.Second
+
+// ClusterHealth prints the health of the cluster, first waiting for a
+// status if one is given, and returns the exit status: 1 if the wait timed
+// out, and exitConnectionFailure if the cluster couldn't be asked.
+func ClusterHealth(opts ClusterHealthOptions) int {
+	switch opts.WaitForStatus {
+	case "", "green", "yellow", "red":
+	default:
+		logFatalf("--wait-for-status must be green, yellow, or red, not '%s'", opts.WaitForStatus)
+	}
+	if opts.Format != "text" && opts.Format != "json" {
+		logFatalf("unknown format '%s'", opts.Format)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logErrorf("Error creating the client: %s", err)
+		return exitConnectionFailure
+	}
+	req := opensearchapi.ClusterHealthRequest{WaitForStatus: opts.WaitForStatus}
+	if opts.Index != "" {
+		req.Index = []string{opts.Index}
+	}
+	if opts.WaitForStatus != "" {
+		logInfof("Waiting up to %s for the cluster to be %s", opts.Timeout, opts.WaitForStatus)
+	}
+	// a cluster that is still starting may refuse connections, or answer
+	// 503, so a wait asks again until the timeout
+	deadline := time.Now().Add(opts.Timeout)
+	var health clusterHealth
+	for {
+		var retry bool
+		health, retry, err = getClusterHealth(client, req, time.Until(deadline))
+		if err == nil {
+			break
+		}
+		if opts.WaitForStatus == "" || !retry {
+			logErrorf("Error getting the cluster health: %s", err)
+			return exitConnectionFailure
+		}
+		if time.Until(deadline) <= clusterHealthRetryInterval {
+			logErrorf("Timed out after %s waiting for the cluster to be %s: %s", opts.Timeout, opts.WaitForStatus, err)
+			return 1
+		}
+		logDebugf("Error getting the cluster health: %s; retrying", err)
+		time.Sleep(clusterHealthRetryInterval)
+	}
+	if opts.Format == "json" {
+		data, _ := json.Marshal(health)
+		fmt.Println(string(data))
+	} else {
+		fmt.Printf("Cluster [%s] is [%s]\n", health.ClusterName, health.Status)
+		fmt.Printf("Nodes: %d (%d data)\n", health.NumberOfNodes, health.NumberOfDataNodes)
+		fmt.Printf("Shards: %d active (%d primary), %d relocating, %d initializing, %d unassigned\n",
+			health.ActiveShards, health.ActivePrimaryShards, health.RelocatingShards,
+			health.InitializingShards, health.UnassignedShards)
+		fmt.Printf("Pending tasks: %d\n", health.PendingTasks)
+	}
+	if health.TimedOut {
+		logErrorf("Timed out after %s waiting for the cluster to be %s", opts.Timeout, opts.WaitForStatus)
+		return 1
+	}
+	return 0
+}
+
+// getClusterHealth gets the health of the cluster, waiting up to timeout for
+// the status the request waits for, if any. It reports whether an error is
+// worth retrying: the cluster couldn't be reached, or wasn't ready.
+func getClusterHealth(client *opensearch.Client, req opensearchapi.ClusterHealthRequest, timeout time.Duration) (clusterHealth, bool, error) {
+	if req.WaitForStatus != "" {
+		req.Timeout = timeout
+	}
+	// the wait can take as long as the timeout, so the request mustn't time out first
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+30*time.Second)
+	defer cancel()
+	res, err := req.Do(ctx, client)
+	if err != nil {
+		return clusterHealth{}, true, err
+	}
+	defer res.Body.Close()
+	// a wait that times out is answered with 408 and the current health
+	if res.StatusCode != 408 {
+		if err := responseError(res); err != nil {
+			return clusterHealth{}, res.StatusCode == 503, err
+		}
+	}
+	var health clusterHealth
+	if err := json.NewDecoder(res.Body).Decode(&health); err != nil {
+		return clusterHealth{}, false, fmt.Errorf("reading the response: %w", err)
+	}
+	return health, false, nil
+}
@@ -0,0 +1,37 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+)
+
+var componentTemplateAPI = templateAPI{
+	kind:    "component template",
+	wrapper: "component_template",
+	put: func(name string, body []byte) apiRequest {
+		return opensearchapi.ClusterPutComponentTemplateRequest{Name: name, Body: bytes.NewReader(body)}
+	},
+	get: func(name string) apiRequest {
+		req := opensearchapi.ClusterGetComponentTemplateRequest{}
+		if name != "" {
+			req.Name = []string{name}
+		}
+		return req
+	},
+	delete: func(name string) apiRequest {
+		return opensearchapi.ClusterDeleteComponentTemplateRequest{Name: name}
+	},
+}
+
+// componentTemplateCmd represents the component-template command
+var componentTemplateCmd = newTemplateCmd(componentTemplateAPI, "component-template", `Manage component templates: settings, mappings, and aliases that index templates
+	can share by listing them in composed_of.
+	$ opensearch-doc component-template put timestamps --file timestamp-mappings.json`)
+
+func init() {
+	rootCmd.AddCommand(componentTemplateCmd)
+}
@@ -0,0 +1,32 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compress wraps w in a compressing writer if the file name ends in .gz or
+// .zst; otherwise writes go to w unchanged. Closing the returned writer
+// flushes the compressed stream but doesn't close w.
+func compress(w io.Writer, name string) (io.WriteCloser, error) {
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		return gzip.NewWriter(w), nil
+	case strings.HasSuffix(name, ".zst"):
+		return zstd.NewWriter(w)
+	}
+	return nopWriteCloser{w}, nil
+}
+
+// nopWriteCloser is a writer whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,192 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/spf13/cobra"
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// copyCmd represents the copy command
+var copyCmd = &cobra.Command{
+	Use:   "copy",
+	Short: "Copy an index from one cluster to another",
+	Long: `Copy the documents of an index from one cluster into an index of another, keeping
+	their IDs. Documents are read from the source with a point in time and search_after,
+	a page at a time, and sent to the destination with the same bulk indexer as the bulk
+	command; unlike reindex from a remote cluster, the destination needn't allow the
+	source in its settings. The connection settings, such as credentials, apply to both
+	clusters; --source-url and --dest-url default to the --url.
+	$ opensearch-doc copy --source-url https://old:9200 -i products --dest-url https://new:9200
+
+	Documents are read in order of the --sort field, which must have a different value for
+	each document; the default, _id, always does. With --query, only the documents matching
+	the query in a JSON file (which may wrap it in a "query" key) are copied.
+
+	Long copies can be made resumable with --checkpoint, which records how many documents
+	have been copied. After a crash or interruption, run the same command with --resume to
+	skip them; the source index shouldn't be changed in between.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		sourceURL, _ := cmd.Flags().GetString("source-url")
+		index, _ := cmd.Flags().GetString("index")
+		destURL, _ := cmd.Flags().GetString("dest-url")
+		destIndex, _ := cmd.Flags().GetString("dest-index")
+		query, _ := cmd.Flags().GetString("query")
+		sort, _ := cmd.Flags().GetString("sort")
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		keepAlive, _ := cmd.Flags().GetDuration("keep-alive")
+		workers, _ := cmd.Flags().GetInt("workers")
+		flushBytes, _ := cmd.Flags().GetInt("flush-bytes")
+		checkpoint, _ := cmd.Flags().GetString("checkpoint")
+		checkpointInterval, _ := cmd.Flags().GetDuration("checkpoint-interval")
+		resume, _ := cmd.Flags().GetBool("resume")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		ctx, cancel := withTimeout(cmd.Context(), timeout)
+		stats, err := Copy(ctx, CopyOptions{
+			SourceURL:          sourceURL,
+			Index:              index,
+			DestURL:            destURL,
+			DestIndex:          destIndex,
+			Query:              query,
+			Sort:               sort,
+			BatchSize:          batchSize,
+			KeepAlive:          keepAlive,
+			Workers:            workers,
+			FlushBytes:         flushBytes,
+			Checkpoint:         checkpoint,
+			CheckpointInterval: checkpointInterval,
+			Resume:             resume,
+			Quiet:              quiet,
+		})
+		cancel()
+		if err != nil {
+			logErrorf("%s", err)
+		}
+		if code := bulkExitCode(false, stats, err); code != 0 {
+			exit(code)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(copyCmd)
+
+	copyCmd.Flags().String("source-url", "", "The URL of the cluster to copy from (default the --url)")
+	copyCmd.Flags().StringP("index", "i", "", "The index to copy from")
+	copyCmd.Flags().String("dest-url", "", "The URL of the cluster to copy to (default the --url)")
+	copyCmd.Flags().String("dest-index", "", "The index to copy to (default the --index)")
+	copyCmd.Flags().String("query", "", "A JSON file of a query selecting the documents to copy")
+	copyCmd.Flags().String("sort", "_id", "A field with a different value for each document, to read them in order of")
+	copyCmd.Flags().Int("batch-size", 1000, "The number of documents to read in each request")
+	copyCmd.Flags().Duration("keep-alive", 5*time.Minute, "How long the source point in time is kept between requests")
+	copyCmd.Flags().Int("workers", 4, "The number of indexer worker goroutines")
+	copyCmd.Flags().Int("flush-bytes", 5e+6, "The flush threshold in bytes")
+	copyCmd.Flags().String("checkpoint", "", "A file to record progress in, so an interrupted copy can be resumed")
+	copyCmd.Flags().Duration("checkpoint-interval", 10*time.Second, "How often to write the checkpoint file")
+	copyCmd.Flags().Bool("resume", false, "Skip the documents already copied according to the --checkpoint file")
+	copyCmd.Flags().BoolP("quiet", "q", false, "Don't report progress")
+	copyCmd.Flags().Duration("timeout", 0, "The longest the copy may take, after which the documents not yet sent are dropped; 0 for no limit")
+	copyCmd.MarkFlagRequired("index")
+}
+
+// CopyOptions holds the settings for copying an index between clusters.
+type CopyOptions struct {
+	SourceURL string // The URL of the source cluster; the --url if empty
+	Index     string // The source index
+	DestURL   string // The URL of the destination cluster; the --url if empty
+	DestIndex string // The destination index; the source index if empty
+
+	Query     string        // A JSON file of a query selecting the documents
+	Sort      string        // A unique field to read the documents in order of
+	BatchSize int           // The number of documents to read in each request
+	KeepAlive time.Duration // How long the point in time is kept
+
+	Workers    int // The number of indexer worker goroutines
+	FlushBytes int // The flush threshold in bytes
+
+	Checkpoint         string        // A file to record progress in
+	CheckpointInterval time.Duration // How often to write the checkpoint file
+	Resume             bool          // Skip the documents already copied
+
+	Quiet bool // Don't report progress
+}
+
+// Copy copies the documents of an index from one cluster to another, and
+// returns the Stats of the load into the destination. If reading the source
+// fails, the documents read before the error are still copied. Once ctx is
+// done, the copy stops and the documents not yet sent are dropped.
+func Copy(ctx context.Context, opts CopyOptions) (osdoc.Stats, error) {
+	start := time.Now()
+	if opts.DestIndex == "" {
+		opts.DestIndex = opts.Index
+	}
+	scan := scanOptions{
+		Index:     opts.Index,
+		Sort:      opts.Sort,
+		PageSize:  opts.BatchSize,
+		KeepAlive: opts.KeepAlive,
+	}
+	if opts.Query != "" {
+		var err error
+		scan.Query, err = readJSONFile(opts.Query, "query")
+		if err != nil {
+			return osdoc.Stats{}, fmt.Errorf("reading the query: %w", err)
+		}
+	}
+	source, err := clientFor(opts.SourceURL)
+	if err != nil {
+		return osdoc.Stats{}, &connectionError{fmt.Errorf("creating the source client: %w", err)}
+	}
+	dest, err := clientFor(opts.DestURL)
+	if err != nil {
+		return osdoc.Stats{}, &connectionError{fmt.Errorf("creating the destination client: %w", err)}
+	}
+	loader, err := osdoc.NewBulkLoader(ctx, dest, osdoc.Options{
+		Index:              opts.DestIndex,
+		Action:             "index",
+		IDField:            "_id",
+		Format:             "json",
+		Workers:            opts.Workers,
+		FlushBytes:         opts.FlushBytes,
+		FlushInterval:      30 * time.Second,
+		Checkpoint:         opts.Checkpoint,
+		CheckpointInterval: opts.CheckpointInterval,
+		Resume:             opts.Resume,
+	})
+	if err != nil {
+		return osdoc.Stats{}, err
+	}
+	return load(loader, BulkOptions{Quiet: opts.Quiet, ProgressInterval: time.Second}, start, func(p *progress) error {
+		add := loader.Adder(opts.Index)
+		n := 0
+		err := scanIndex(loader.Context(), source, scan, func(hit searchHit) error {
+			n++
+			if hit.Source != nil {
+				hit.Source["_id"] = hit.ID
+			}
+			return add(n, hit.Source)
+		})
+		// a stopped or cancelled copy ends the scan; the loader reports why
+		if err != nil && err != osdoc.ErrStopped && loader.Context().Err() == nil {
+			return &connectionError{fmt.Errorf("reading the source index: %w", err)}
+		}
+		return nil
+	})
+}
+
+// clientFor creates a client for the cluster at url, or at the --url if it
+// is empty.
+func clientFor(url string) (*opensearch.Client, error) {
+	if url == "" {
+		return NewClient()
+	}
+	return newClient([]string{url})
+}
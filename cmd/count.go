@@ -0,0 +1,84 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// countCmd represents the count command
+var countCmd = &cobra.Command{
+	Use:   "count",
+	Short: "Count the documents in an index",
+	Long: `Print the number of documents in an index, or of those matching the query in a JSON
+	file with --query (- for stdin), which may wrap it in a "query" key. With --format json,
+	the count is printed as {"index": ..., "count": ...}. Scripts can check a bulk load:
+	$ test "$(opensearch-doc count -i my_index)" -eq "$(wc -l < docs.json)"`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, _ := cmd.Flags().GetString("index")
+		query, _ := cmd.Flags().GetString("query")
+		format, _ := cmd.Flags().GetString("format")
+		Count(index, query, format)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(countCmd)
+
+	countCmd.Flags().StringP("index", "i", "", "The index (or comma-separated indices or wildcard) to count")
+	countCmd.Flags().String("query", "", "A JSON file of a query selecting the documents to count; - for stdin")
+	countCmd.Flags().String("format", "text", "The output format: text or json")
+	countCmd.MarkFlagRequired("index")
+}
+
+// Count prints the number of documents in an index matching a query, read
+// from a file unless it is empty.
+func Count(index string, query string, format string) {
+	if format != "text" && format != "json" {
+		logFatalf("unknown format '%s'", format)
+	}
+	req := opensearchapi.CountRequest{Index: []string{index}}
+	if query != "" {
+		q, err := readJSONFile(query, "query")
+		if err != nil {
+			logFatalf("Error reading the query: %s", err)
+		}
+		body, err := json.Marshal(map[string]interface{}{"query": q})
+		if err != nil {
+			logFatalf("Error encoding the query: %s", err)
+		}
+		req.Body = bytes.NewReader(body)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := req.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error counting the documents: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error counting the documents: %s", err)
+	}
+	var result struct {
+		Count int64 `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		logFatalf("Error reading the count: %s", err)
+	}
+	if format == "json" {
+		data, _ := json.Marshal(map[string]interface{}{"index": index, "count": result.Count})
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Println(result.Count)
+}
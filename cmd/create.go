@@ -4,31 +4,139 @@ Copyright © 2022 Will Fitzgerald <willf@github.com>
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
 	"github.com/spf13/cobra"
 )
 
 // createCmd represents the create command
 var createCmd = &cobra.Command{
-	Use:   "create",
+	Use:   "create <index>",
 	Short: "Create an index",
-	Long:  `Create an opensearch index.`,
+	Long: `Create an opensearch index.
+
+	The index settings and mappings can be read from JSON files, with --settings and
+	--mappings; each file may hold just the settings or mappings, or wrap them in a
+	"settings" or "mappings" key. --shards and --replicas override the settings file.
+	If the index already exists, it is left as it is and reported.
+	$ opensearch-doc index create my_index --mappings mappings.json --shards 3 --replicas 1`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("create called")
+		settings, _ := cmd.Flags().GetString("settings")
+		mappings, _ := cmd.Flags().GetString("mappings")
+		shards, _ := cmd.Flags().GetInt("shards")
+		replicas, _ := cmd.Flags().GetInt("replicas")
+		CreateIndex(CreateIndexOptions{
+			Index:    args[0],
+			Settings: settings,
+			Mappings: mappings,
+			Shards:   shards,
+			Replicas: replicas,
+		})
 	},
 }
 
 func init() {
 	indexCmd.AddCommand(createCmd)
 
-	// Here you will define your flags and configuration settings.
+	createCmd.Flags().String("settings", "", "A JSON file of index settings")
+	createCmd.Flags().String("mappings", "", "A JSON file of index mappings")
+	createCmd.Flags().Int("shards", 0, "The number of primary shards (default from the cluster)")
+	createCmd.Flags().Int("replicas", -1, "The number of replicas of each shard (default from the cluster)")
+}
+
+// CreateIndexOptions holds the settings for creating an index.
+type CreateIndexOptions struct {
+	Index    string // The name of the index
+	Settings string // A JSON file of index settings
+	Mappings string // A JSON file of index mappings
+	Shards   int    // The number of primary shards, if positive
+	Replicas int    // The number of replicas, if not negative
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// createCmd.PersistentFlags().String("foo", "", "A help for foo")
+// CreateIndex creates an index, reporting whether it already existed.
+func CreateIndex(opts CreateIndexOptions) {
+	body, err := indexBody(opts)
+	if err != nil {
+		logFatalf("%s", err)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.IndicesCreateRequest{
+		Index: opts.Index,
+		Body:  bytes.NewReader(body),
+	}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error creating the index: %s", err)
+	}
+	defer res.Body.Close()
+	var apiErr *apiError
+	if err := responseError(res); errors.As(err, &apiErr) && apiErr.Type == "resource_already_exists_exception" {
+		fmt.Printf("Index [%s] already exists\n", opts.Index)
+		return
+	} else if err != nil {
+		logFatalf("Error creating the index: %s", err)
+	}
+	fmt.Printf("Created index [%s]\n", opts.Index)
+}
+
+// indexBody builds the body of an index creation request.
+func indexBody(opts CreateIndexOptions) ([]byte, error) {
+	settings := map[string]interface{}{}
+	if opts.Settings != "" {
+		var err error
+		settings, err = readJSONFile(opts.Settings, "settings")
+		if err != nil {
+			return nil, fmt.Errorf("reading the settings: %w", err)
+		}
+	}
+	// the file may nest the settings or not, and leave off their index.
+	// prefix, so they are flattened for the flags to replace its own
+	settings = flatSettings("", settings)
+	if opts.Shards > 0 {
+		settings["index.number_of_shards"] = opts.Shards
+	}
+	if opts.Replicas >= 0 {
+		settings["index.number_of_replicas"] = opts.Replicas
+	}
+	body := map[string]interface{}{}
+	if len(settings) > 0 {
+		body["settings"] = settings
+	}
+	if opts.Mappings != "" {
+		mappings, err := readJSONFile(opts.Mappings, "mappings")
+		if err != nil {
+			return nil, fmt.Errorf("reading the mappings: %w", err)
+		}
+		body["mappings"] = mappings
+	}
+	return json.Marshal(body)
+}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// createCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+// flatSettings returns index settings, which may be nested, as a map of
+// their full dotted names, such as index.number_of_shards, to their values.
+func flatSettings(prefix string, settings map[string]interface{}) map[string]interface{} {
+	flat := map[string]interface{}{}
+	for key, value := range settings {
+		name := prefix + key
+		if prefix == "" && name != "index" && !strings.HasPrefix(name, "index.") {
+			name = "index." + name
+		}
+		if object, ok := value.(map[string]interface{}); ok {
+			for k, v := range flatSettings(name+".", object) {
+				flat[k] = v
+			}
+		} else {
+			flat[name] = value
+		}
+	}
+	return flat
 }
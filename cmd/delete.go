@@ -4,31 +4,138 @@ Copyright © 2022 Will Fitzgerald <willf@github.com>
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 // deleteCmd represents the delete command
 var deleteCmd = &cobra.Command{
-	Use:   "delete",
+	Use:   "delete <index>",
 	Short: "Delete an index",
-	Long:  `Delete an opensearch index.`,
+	Long: `Delete an opensearch index.
+
+	The name may contain wildcards, as in logs-2022.*, and may list several patterns
+	separated by commas. The matching indices are listed and you are asked to confirm
+	before they are deleted; --yes skips the question, and --dry-run only lists them.
+	$ opensearch-doc index delete 'logs-2021.*' --dry-run`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("delete called")
+		yes, _ := cmd.Flags().GetBool("yes")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		DeleteIndex(DeleteIndexOptions{Index: args[0], Yes: yes, DryRun: dryRun})
 	},
 }
 
 func init() {
 	indexCmd.AddCommand(deleteCmd)
 
-	// Here you will define your flags and configuration settings.
+	deleteCmd.Flags().BoolP("yes", "y", false, "Delete without asking for confirmation")
+	deleteCmd.Flags().Bool("dry-run", false, "List the indices that would be deleted, without deleting them")
+}
+
+// DeleteIndexOptions holds the settings for deleting indices.
+type DeleteIndexOptions struct {
+	Index  string // The index name or wildcard pattern
+	Yes    bool   // Don't ask for confirmation
+	DryRun bool   // Only list the matching indices
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// deleteCmd.PersistentFlags().String("foo", "", "A help for foo")
+// DeleteIndex deletes the indices matching a name or pattern.
+func DeleteIndex(opts DeleteIndexOptions) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	indices, err := resolveIndices(client, opts.Index)
+	if err != nil {
+		logFatalf("Error finding the indices: %s", err)
+	}
+	if len(indices) == 0 {
+		fmt.Printf("No indices match [%s]\n", opts.Index)
+		return
+	}
+	if opts.DryRun {
+		fmt.Printf("Would delete [%d] indices:\n", len(indices))
+		for _, index := range indices {
+			fmt.Println(index)
+		}
+		return
+	}
+	if !opts.Yes {
+		ok, err := confirm(fmt.Sprintf("Delete [%d] indices: %s?", len(indices), strings.Join(indices, ", ")))
+		if err != nil {
+			logFatalf("%s", err)
+		}
+		if !ok {
+			fmt.Println("Nothing deleted")
+			return
+		}
+	}
+	// delete the concrete indices, since clusters may refuse wildcard deletes
+	res, err := opensearchapi.IndicesDeleteRequest{Index: indices}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error deleting the indices: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error deleting the indices: %s", err)
+	}
+	fmt.Printf("Deleted [%d] indices\n", len(indices))
+}
+
+// resolveIndices returns the names of the indices matching a name or
+// pattern, sorted.
+func resolveIndices(client *opensearch.Client, pattern string) ([]string, error) {
+	res, err := opensearchapi.CatIndicesRequest{
+		Index:  strings.Split(pattern, ","),
+		Format: "json",
+		H:      []string{"index"},
+		S:      []string{"index"},
+	}.Do(context.Background(), client)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return nil, nil
+	}
+	if err := responseError(res); err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		Index string `json:"index"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+		return nil, err
+	}
+	indices := make([]string, len(rows))
+	for i, row := range rows {
+		indices[i] = row.Index
+	}
+	return indices, nil
+}
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// deleteCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+// confirm asks a yes or no question on the terminal. It is an error if
+// stdin isn't a terminal.
+func confirm(question string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, errors.New("stdin isn't a terminal to confirm on; use --yes")
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
 }
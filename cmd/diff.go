@@ -0,0 +1,222 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare the documents of two indices",
+	Long: `Compare the documents of two indices, in the same cluster or in different ones, such as
+	after a migration. Each document ID only in the --left index is reported as missing, each
+	only in the --right index as extra, and each whose contents differ as different, followed
+	by a summary. The connection settings apply to both clusters; --left-url and --right-url
+	default to the --url.
+	$ opensearch-doc diff --left-url https://old:9200 --left products --right-url https://new:9200 --right products
+
+	The contents are compared by a hash of each document's source, or only of the --fields
+	given. With --query, only the documents matching the query in a JSON file (which may wrap
+	it in a "query" key) are compared. Both indices are read in order of _id with a point in
+	time, a page at a time, so any number of documents can be compared.
+
+	The exit code is 0 if the indices hold the same documents, 1 if they don't, and 2 if they
+	couldn't be read.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		left, _ := cmd.Flags().GetString("left")
+		leftURL, _ := cmd.Flags().GetString("left-url")
+		right, _ := cmd.Flags().GetString("right")
+		rightURL, _ := cmd.Flags().GetString("right-url")
+		fields, _ := cmd.Flags().GetStringSlice("fields")
+		query, _ := cmd.Flags().GetString("query")
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		keepAlive, _ := cmd.Flags().GetDuration("keep-alive")
+		result, err := Diff(DiffOptions{
+			Left:      left,
+			LeftURL:   leftURL,
+			Right:     right,
+			RightURL:  rightURL,
+			Fields:    fields,
+			Query:     query,
+			BatchSize: batchSize,
+			KeepAlive: keepAlive,
+		})
+		if err != nil {
+			logErrorf("%s", err)
+			exit(2)
+		}
+		if !result.Same() {
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().String("left", "", "The index to compare")
+	diffCmd.Flags().String("left-url", "", "The URL of the cluster of the left index (default the --url)")
+	diffCmd.Flags().String("right", "", "The index to compare it with")
+	diffCmd.Flags().String("right-url", "", "The URL of the cluster of the right index (default the --url)")
+	diffCmd.Flags().StringSlice("fields", nil, "The fields of each document to compare, separated by commas (default all)")
+	diffCmd.Flags().String("query", "", "A JSON file of a query selecting the documents to compare")
+	diffCmd.Flags().Int("batch-size", 1000, "The number of documents to read in each request")
+	diffCmd.Flags().Duration("keep-alive", 5*time.Minute, "How long each point in time is kept between requests")
+	diffCmd.MarkFlagRequired("left")
+	diffCmd.MarkFlagRequired("right")
+}
+
+// DiffOptions holds the settings for comparing two indices.
+type DiffOptions struct {
+	Left     string // The index to compare
+	LeftURL  string // The URL of the left index's cluster; the --url if empty
+	Right    string // The index to compare it with
+	RightURL string // The URL of the right index's cluster; the --url if empty
+
+	Fields    []string      // The fields to compare; all of them if empty
+	Query     string        // A JSON file of a query selecting the documents
+	BatchSize int           // The number of documents to read in each request
+	KeepAlive time.Duration // How long each point in time is kept
+}
+
+// DiffResult counts the documents of two indices by how they compare.
+type DiffResult struct {
+	Left      int // The documents in the left index
+	Right     int // The documents in the right index
+	Missing   int // The documents only in the left index
+	Extra     int // The documents only in the right index
+	Different int // The documents in both whose contents differ
+}
+
+// Same returns whether the indices hold the same documents.
+func (r DiffResult) Same() bool {
+	return r.Missing == 0 && r.Extra == 0 && r.Different == 0
+}
+
+// hashedDocument is the ID and a hash of the source of a document.
+type hashedDocument struct {
+	id   string
+	hash [sha256.Size]byte
+}
+
+// errDiffStopped stops reading an index once the comparison has ended.
+var errDiffStopped = errors.New("the comparison stopped")
+
+// Diff compares the documents of two indices, reports each one missing,
+// extra, or different, and returns the counts. Both indices are read in
+// order of _id at once, so the documents are compared as they are read.
+func Diff(opts DiffOptions) (DiffResult, error) {
+	scan := scanOptions{
+		Fields:    opts.Fields,
+		Sort:      "_id",
+		PageSize:  opts.BatchSize,
+		KeepAlive: opts.KeepAlive,
+	}
+	if opts.Query != "" {
+		var err error
+		scan.Query, err = readJSONFile(opts.Query, "query")
+		if err != nil {
+			return DiffResult{}, fmt.Errorf("reading the query: %w", err)
+		}
+	}
+	leftClient, err := clientFor(opts.LeftURL)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("creating the left client: %w", err)
+	}
+	rightClient, err := clientFor(opts.RightURL)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("creating the right client: %w", err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	leftScan, rightScan := scan, scan
+	leftScan.Index, rightScan.Index = opts.Left, opts.Right
+	left, leftErr := readHashes(leftClient, leftScan, stop)
+	right, rightErr := readHashes(rightClient, rightScan, stop)
+
+	// Merge the two lists of IDs, in order
+	//
+	var result DiffResult
+	l, lok := <-left
+	r, rok := <-right
+	for lok || rok {
+		// a list that ended with an error isn't compared further
+		if !lok && *leftErr != nil {
+			return result, *leftErr
+		}
+		if !rok && *rightErr != nil {
+			return result, *rightErr
+		}
+		switch {
+		case !rok || lok && l.id < r.id:
+			fmt.Printf("Missing [%s]: only in [%s]\n", l.id, opts.Left)
+			result.Left++
+			result.Missing++
+			l, lok = <-left
+		case !lok || r.id < l.id:
+			fmt.Printf("Extra [%s]: only in [%s]\n", r.id, opts.Right)
+			result.Right++
+			result.Extra++
+			r, rok = <-right
+		default:
+			if l.hash != r.hash {
+				fmt.Printf("Different [%s]\n", l.id)
+				result.Different++
+			}
+			result.Left++
+			result.Right++
+			l, lok = <-left
+			r, rok = <-right
+		}
+	}
+	if *leftErr != nil {
+		return result, *leftErr
+	}
+	if *rightErr != nil {
+		return result, *rightErr
+	}
+	fmt.Printf("Compared [%d] documents in [%s] with [%d] in [%s]: [%d] missing, [%d] extra, [%d] different\n",
+		result.Left, opts.Left, result.Right, opts.Right, result.Missing, result.Extra, result.Different)
+	return result, nil
+}
+
+// readHashes reads the documents of an index in order of _id into a
+// channel, hashing their sources, until the index ends or stop is closed.
+// The error reading the index, if any, is set before the channel is closed.
+func readHashes(client *opensearch.Client, scan scanOptions, stop <-chan struct{}) (<-chan hashedDocument, *error) {
+	documents := make(chan hashedDocument, scan.PageSize)
+	readErr := new(error)
+	go func() {
+		defer close(documents)
+		err := scanIndex(context.Background(), client, scan, func(hit searchHit) error {
+			// the keys of a map are marshaled in order, so equal sources
+			// have equal hashes
+			source, err := json.Marshal(hit.Source)
+			if err != nil {
+				return err
+			}
+			select {
+			case documents <- hashedDocument{hit.ID, sha256.Sum256(source)}:
+				return nil
+			case <-stop:
+				return errDiffStopped
+			}
+		})
+		if err != nil && err != errDiffStopped {
+			*readErr = fmt.Errorf("reading [%s]: %w", scan.Index, err)
+		}
+	}()
+	return documents, readErr
+}
@@ -0,0 +1,216 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// docCmd represents the doc command
+var docCmd = &cobra.Command{
+	Use:   "doc",
+	Short: "Get, put, or delete single documents",
+	Long: `Get, put, or delete single documents by ID, for one-off changes that don't call for
+	a bulk load. The exit status of get and delete is 1 if the document doesn't exist.
+	$ opensearch-doc doc get 42 -i my_index
+	$ opensearch-doc doc put 42 -i my_index --file doc.json
+	$ opensearch-doc doc delete 42 -i my_index`,
+}
+
+// docGetCmd represents the doc get command
+var docGetCmd = &cobra.Command{
+	Use:   "get <id>",
+	Short: "Print a document's source, as JSON",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		GetDocument(docOptionsFrom(cmd, args[0]))
+	},
+}
+
+// docPutCmd represents the doc put command
+var docPutCmd = &cobra.Command{
+	Use:   "put <id>",
+	Short: "Index a document from a JSON file, replacing any with the same ID",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		PutDocument(docOptionsFrom(cmd, args[0]))
+	},
+}
+
+// docDeleteCmd represents the doc delete command
+var docDeleteCmd = &cobra.Command{
+	Use:   "delete <id>",
+	Short: "Delete a document",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		DeleteDocument(docOptionsFrom(cmd, args[0]))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(docCmd)
+	docCmd.AddCommand(docGetCmd, docPutCmd, docDeleteCmd)
+
+	docCmd.PersistentFlags().StringP("index", "i", "", "The index of the document")
+	docCmd.PersistentFlags().String("routing", "", "The routing value of the document")
+	docCmd.MarkPersistentFlagRequired("index")
+	docPutCmd.Flags().String("file", "", "A JSON file of the document; - for stdin")
+	docPutCmd.Flags().String("pipeline", "", "An ingest pipeline to run the document through")
+	docPutCmd.MarkFlagRequired("file")
+	for _, cmd := range []*cobra.Command{docPutCmd, docDeleteCmd} {
+		cmd.Flags().String("refresh", "", "Make the change searchable: true to refresh now, or wait_for to wait for the next refresh")
+		cmd.Flags().String("wait-for-active-shards", "", "The number of active shard copies (or all) to wait for")
+	}
+}
+
+// DocOptions holds the settings for a single-document operation.
+type DocOptions struct {
+	Index    string // The index of the document
+	ID       string // The ID of the document
+	Routing  string // The routing value of the document
+	File     string // For put, a JSON file of the document, or - for stdin
+	Pipeline string // For put, an ingest pipeline
+	Refresh  string // For put and delete, true or wait_for to refresh
+
+	WaitForActiveShards string // For put and delete, the active shard copies to wait for
+}
+
+// docOptionsFrom reads the DocOptions for the document with the given ID
+// from a doc subcommand's flags.
+func docOptionsFrom(cmd *cobra.Command, id string) DocOptions {
+	opts := DocOptions{ID: id}
+	opts.Index, _ = cmd.Flags().GetString("index")
+	opts.Routing, _ = cmd.Flags().GetString("routing")
+	if cmd.Flags().Lookup("file") != nil {
+		opts.File, _ = cmd.Flags().GetString("file")
+		opts.Pipeline, _ = cmd.Flags().GetString("pipeline")
+	}
+	if cmd.Flags().Lookup("refresh") != nil {
+		opts.Refresh, _ = cmd.Flags().GetString("refresh")
+		opts.WaitForActiveShards, _ = cmd.Flags().GetString("wait-for-active-shards")
+		if err := checkRefresh(opts.Refresh); err != nil {
+			logFatalf("%s", err)
+		}
+	}
+	return opts
+}
+
+// GetDocument prints the source of a document.
+func GetDocument(opts DocOptions) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.GetRequest{
+		Index:      opts.Index,
+		DocumentID: opts.ID,
+		Routing:    opts.Routing,
+	}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error getting the document: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		logErrorf("Document [%s] not found in [%s]", opts.ID, opts.Index)
+		exit(1)
+	}
+	if err := responseError(res); err != nil {
+		logFatalf("Error getting the document: %s", err)
+	}
+	var result struct {
+		Source json.RawMessage `json:"_source"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		logFatalf("Error reading the document: %s", err)
+	}
+	if err := printJSON(bytes.NewReader(result.Source)); err != nil {
+		logFatalf("Error reading the document: %s", err)
+	}
+}
+
+// PutDocument indexes a document from a JSON file.
+func PutDocument(opts DocOptions) {
+	document, err := readJSONFile(opts.File, "")
+	if err != nil {
+		logFatalf("Error reading the document: %s", err)
+	}
+	body, err := json.Marshal(document)
+	if err != nil {
+		logFatalf("Error encoding the document: %s", err)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.IndexRequest{
+		Index:               opts.Index,
+		DocumentID:          opts.ID,
+		Body:                bytes.NewReader(body),
+		Routing:             opts.Routing,
+		Pipeline:            opts.Pipeline,
+		Refresh:             opts.Refresh,
+		WaitForActiveShards: opts.WaitForActiveShards,
+	}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error indexing the document: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error indexing the document: %s", err)
+	}
+	var result struct {
+		Result string `json:"result"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		logFatalf("Error reading the response: %s", err)
+	}
+	if result.Result == "created" {
+		fmt.Printf("Created document [%s] in [%s]\n", opts.ID, opts.Index)
+	} else {
+		fmt.Printf("Updated document [%s] in [%s]\n", opts.ID, opts.Index)
+	}
+}
+
+// DeleteDocument deletes a document.
+func DeleteDocument(opts DocOptions) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.DeleteRequest{
+		Index:               opts.Index,
+		DocumentID:          opts.ID,
+		Routing:             opts.Routing,
+		Refresh:             opts.Refresh,
+		WaitForActiveShards: opts.WaitForActiveShards,
+	}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error deleting the document: %s", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		logErrorf("Document [%s] not found in [%s]", opts.ID, opts.Index)
+		exit(1)
+	}
+	if err := responseError(res); err != nil {
+		logFatalf("Error deleting the document: %s", err)
+	}
+	fmt.Printf("Deleted document [%s] from [%s]\n", opts.ID, opts.Index)
+}
+
+// checkRefresh returns an error if refresh isn't a value of the refresh
+// parameter of write requests: true, false, or wait_for.
+func checkRefresh(refresh string) error {
+	switch refresh {
+	case "", "true", "false", "wait_for":
+		return nil
+	}
+	return fmt.Errorf("--refresh must be true, false, or wait_for, not '%s'", refresh)
+}
@@ -0,0 +1,58 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// existsCmd represents the exists command
+var existsCmd = &cobra.Command{
+	Use:   "exists <index>",
+	Short: "Check whether an index exists",
+	Long: `Check whether an opensearch index exists.
+
+	The exit status is 0 if the index exists and 1 if it doesn't, so scripts can guard
+	a bulk load with it; it is 2 if the cluster couldn't be asked.
+	$ opensearch-doc index exists my_index && opensearch-doc bulk -i my_index -F docs.json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		exit(IndexExists(args[0]))
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(existsCmd)
+}
+
+// IndexExists reports whether an index exists, returning the exit status:
+// 0 if it does, 1 if it doesn't, and exitConnectionFailure if the request
+// failed.
+func IndexExists(index string) int {
+	client, err := NewClient()
+	if err != nil {
+		logErrorf("Error creating the client: %s", err)
+		return exitConnectionFailure
+	}
+	res, err := opensearchapi.IndicesExistsRequest{Index: []string{index}}.Do(context.Background(), client)
+	if err != nil {
+		logErrorf("Error checking the index: %s", err)
+		return exitConnectionFailure
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case 200:
+		fmt.Printf("Index [%s] exists\n", index)
+		return 0
+	case 404:
+		fmt.Printf("Index [%s] does not exist\n", index)
+		return 1
+	}
+	logErrorf("Error checking the index: %s", responseError(res))
+	return exitConnectionFailure
+}
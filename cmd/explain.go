@@ -0,0 +1,214 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Explain how a document scores for a query",
+	Long: `Explain whether a document matches a query, and how its score is computed, as a tree
+	of the scores it is made of, each with the reason for it. The query is read from a JSON
+	file with --query (or stdin with --query -), which may hold just the query or wrap it in a
+	"query" key, or given as a query string with --q. The exit status is 1 if the document
+	doesn't match. With --format json, the response is printed as it is.
+	$ opensearch-doc explain -i products --id 42 --query q.json
+	$ opensearch-doc explain -i products --id 42 --q 'title:shoes'`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, _ := cmd.Flags().GetString("index")
+		id, _ := cmd.Flags().GetString("id")
+		query, _ := cmd.Flags().GetString("query")
+		q, _ := cmd.Flags().GetString("q")
+		format, _ := cmd.Flags().GetString("format")
+		Explain(ExplainOptions{
+			Index:  index,
+			ID:     id,
+			Query:  query,
+			Q:      q,
+			Format: format,
+		})
+	},
+}
+
+// validateQueryCmd represents the validate-query command
+var validateQueryCmd = &cobra.Command{
+	Use:   "validate-query",
+	Short: "Check that a query is valid",
+	Long: `Check that a query is valid against the mappings of an index, without running it, and
+	print why if it isn't, such as a malformed clause or a bad date on a date field. The query
+	is given as for explain. With --explain, the Lucene query it becomes on each index is
+	printed as well, which shows how it was analyzed. The exit status is 1 if it isn't valid.
+	$ opensearch-doc validate-query -i products --query q.json --explain`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, _ := cmd.Flags().GetString("index")
+		query, _ := cmd.Flags().GetString("query")
+		q, _ := cmd.Flags().GetString("q")
+		explain, _ := cmd.Flags().GetBool("explain")
+		ValidateQuery(index, query, q, explain)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd, validateQueryCmd)
+
+	explainCmd.Flags().StringP("index", "i", "", "The index of the document")
+	explainCmd.Flags().String("id", "", "The ID of the document")
+	explainCmd.Flags().String("query", "", "A JSON file of the query; - for stdin")
+	explainCmd.Flags().String("q", "", "A query string, as in 'title:foo AND status:active'")
+	explainCmd.Flags().String("format", "text", "The output format: text or json")
+	explainCmd.MarkFlagRequired("index")
+	explainCmd.MarkFlagRequired("id")
+	explainCmd.MarkFlagsMutuallyExclusive("query", "q")
+
+	validateQueryCmd.Flags().StringP("index", "i", "", "The index (or comma-separated indices or wildcard) to validate against")
+	validateQueryCmd.Flags().String("query", "", "A JSON file of the query; - for stdin")
+	validateQueryCmd.Flags().String("q", "", "A query string, as in 'title:foo AND status:active'")
+	validateQueryCmd.Flags().Bool("explain", false, "Print the Lucene query the query becomes")
+	validateQueryCmd.MarkFlagRequired("index")
+	validateQueryCmd.MarkFlagsMutuallyExclusive("query", "q")
+}
+
+// ExplainOptions holds the settings for explaining a document's score.
+type ExplainOptions struct {
+	Index  string // The index of the document
+	ID     string // The ID of the document
+	Query  string // A JSON file of the query, or - for stdin
+	Q      string // A query string
+	Format string // text or json
+}
+
+// explanation is a score, or part of one, and how it was computed.
+type explanation struct {
+	Value       float64       `json:"value"`
+	Description string        `json:"description"`
+	Details     []explanation `json:"details"`
+}
+
+// Explain prints how a document scores for a query.
+func Explain(opts ExplainOptions) {
+	if opts.Format != "text" && opts.Format != "json" {
+		logFatalf("unknown format '%s'", opts.Format)
+	}
+	path := fmt.Sprintf("/%s/_explain/%s", url.PathEscape(opts.Index), url.PathEscape(opts.ID))
+	var raw json.RawMessage
+	queryRequest(http.MethodPost, path, nil, opts.Query, opts.Q, &raw, "explaining the score")
+	var result struct {
+		Matched     bool         `json:"matched"`
+		Explanation *explanation `json:"explanation"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		logFatalf("Error reading the explanation: %s", err)
+	}
+	if opts.Format == "json" {
+		if err := printJSON(bytes.NewReader(raw)); err != nil {
+			logFatalf("Error reading the explanation: %s", err)
+		}
+	} else if result.Matched && result.Explanation != nil {
+		fmt.Printf("Document [%s] matches, with a score of [%g]\n", opts.ID, result.Explanation.Value)
+		printExplanation(result.Explanation, 0)
+	} else {
+		fmt.Printf("Document [%s] doesn't match\n", opts.ID)
+		if result.Explanation != nil {
+			printExplanation(result.Explanation, 0)
+		}
+	}
+	if !result.Matched {
+		exit(1)
+	}
+}
+
+// printExplanation prints an explanation as a tree, indented by depth.
+func printExplanation(e *explanation, depth int) {
+	fmt.Printf("%s%g %s\n", strings.Repeat("  ", depth), e.Value, e.Description)
+	for i := range e.Details {
+		printExplanation(&e.Details[i], depth+1)
+	}
+}
+
+// ValidateQuery checks a query from a JSON file, or a query string, against
+// an index, and prints whether it is valid, and with explain, the Lucene
+// query it becomes.
+func ValidateQuery(index string, query string, q string, explain bool) {
+	params := url.Values{}
+	if explain {
+		params.Set("explain", "true")
+	}
+	var result struct {
+		Valid        bool   `json:"valid"`
+		Error        string `json:"error"`
+		Explanations []struct {
+			Index       string `json:"index"`
+			Valid       bool   `json:"valid"`
+			Explanation string `json:"explanation"`
+			Error       string `json:"error"`
+		} `json:"explanations"`
+	}
+	path := fmt.Sprintf("/%s/_validate/query", url.PathEscape(index))
+	queryRequest(http.MethodPost, path, params, query, q, &result, "validating the query")
+	if result.Valid {
+		fmt.Println("Query is valid")
+	} else {
+		fmt.Println("Query is not valid")
+	}
+	for _, e := range result.Explanations {
+		switch {
+		case e.Error != "":
+			fmt.Printf("[%s] %s\n", e.Index, e.Error)
+		case e.Explanation != "":
+			fmt.Printf("[%s] %s\n", e.Index, e.Explanation)
+		}
+	}
+	// without explain, the reason is only given for the whole request
+	if result.Error != "" && len(result.Explanations) == 0 {
+		fmt.Println(result.Error)
+	}
+	if !result.Valid {
+		exit(1)
+	}
+}
+
+// queryRequest sends a request with a query, from a JSON file that may
+// wrap it in a "query" key, or as a query string, and decodes the response
+// into result. doing describes the request in errors.
+func queryRequest(method string, path string, params url.Values, query string, q string, result interface{}, doing string) {
+	if query == "" && q == "" {
+		logFatalf("give the query with --query or --q")
+	}
+	if params == nil {
+		params = url.Values{}
+	}
+	var body interface{}
+	if query != "" {
+		object, err := readJSONFile(query, "query")
+		if err != nil {
+			logFatalf("Error reading the query: %s", err)
+		}
+		body = map[string]interface{}{"query": object}
+	} else {
+		params.Set("q", q)
+	}
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	if err := jsonRequest(context.Background(), client, method, path, body, result); err != nil {
+		logFatalf("Error %s: %s", doing, err)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write the documents of an index as NDJSON",
+	Long: `Write the documents of an index to stdout, or to a file with -o, one JSON document
+	per line. The output is compressed if the file name ends in .gz or .zst. Each document's
+	ID is kept in the --id-field, _id by default, so the output can be loaded again with bulk:
+	$ opensearch-doc export -i my_index -o my_index.ndjson.gz
+	$ opensearch-doc bulk -i my_index_copy -F my_index.ndjson.gz
+
+	With --query, only the documents matching the query in a JSON file (which may wrap it in
+	a "query" key) are written, and with --fields, only the listed fields of each. Documents
+	are read with a point in time and search_after, a page at a time, in order of the --sort
+	field, which must have a different value for each document; the default, _id, always does.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, _ := cmd.Flags().GetString("index")
+		query, _ := cmd.Flags().GetString("query")
+		fields, _ := cmd.Flags().GetStringSlice("fields")
+		output, _ := cmd.Flags().GetString("output")
+		idField, _ := cmd.Flags().GetString("id-field")
+		sort, _ := cmd.Flags().GetString("sort")
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		keepAlive, _ := cmd.Flags().GetDuration("keep-alive")
+		Export(ExportOptions{
+			Index:     index,
+			Query:     query,
+			Fields:    fields,
+			Output:    output,
+			IDField:   idField,
+			Sort:      sort,
+			BatchSize: batchSize,
+			KeepAlive: keepAlive,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringP("index", "i", "", "The index to export")
+	exportCmd.Flags().String("query", "", "A JSON file of a query selecting the documents to export")
+	exportCmd.Flags().StringSlice("fields", nil, "The fields of each document to export, separated by commas (default all)")
+	exportCmd.Flags().StringP("output", "o", "", "The file to write to, compressed if it ends in .gz or .zst (default stdout)")
+	exportCmd.Flags().String("id-field", "_id", "The field to keep each document's ID in; empty to leave it out")
+	exportCmd.Flags().String("sort", "_id", "A field with a different value for each document, to read them in order of")
+	exportCmd.Flags().Int("batch-size", 1000, "The number of documents to read in each request")
+	exportCmd.Flags().Duration("keep-alive", 5*time.Minute, "How long the point in time is kept between requests")
+	exportCmd.MarkFlagRequired("index")
+}
+
+// ExportOptions holds the settings for exporting an index.
+type ExportOptions struct {
+	Index   string   // The index to export
+	Query   string   // A JSON file of a query selecting the documents
+	Fields  []string // The fields to export; all of them if empty
+	Output  string   // The file to write to; stdout if empty
+	IDField string   // The field to keep the document ID in, if not empty
+
+	Sort      string        // A unique field to read the documents in order of
+	BatchSize int           // The number of documents to read in each request
+	KeepAlive time.Duration // How long the point in time is kept
+}
+
+// Export writes the documents of an index as NDJSON.
+func Export(opts ExportOptions) {
+	scan := scanOptions{
+		Index:     opts.Index,
+		Fields:    opts.Fields,
+		Sort:      opts.Sort,
+		PageSize:  opts.BatchSize,
+		KeepAlive: opts.KeepAlive,
+	}
+	if opts.Query != "" {
+		var err error
+		scan.Query, err = readJSONFile(opts.Query, "query")
+		if err != nil {
+			logFatalf("Error reading the query: %s", err)
+		}
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	file := os.Stdout
+	if opts.Output != "" {
+		file, err = os.Create(opts.Output)
+		if err != nil {
+			logFatalf("Error creating the output file: %s", err)
+		}
+	}
+	w, err := compress(file, opts.Output)
+	if err != nil {
+		logFatalf("Error compressing the output: %s", err)
+	}
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	n := 0
+	scanErr := scanIndex(context.Background(), client, scan, func(hit searchHit) error {
+		document := hit.Source
+		if document == nil {
+			document = map[string]interface{}{}
+		}
+		if opts.IDField != "" {
+			osdoc.SetField(document, osdoc.SplitFieldPath(opts.IDField), hit.ID)
+		}
+		n++
+		return encoder.Encode(document)
+	})
+	if err := buffered.Flush(); err != nil && scanErr == nil {
+		scanErr = err
+	}
+	if err := w.Close(); err != nil && scanErr == nil {
+		scanErr = err
+	}
+	if err := file.Close(); err != nil && scanErr == nil {
+		scanErr = err
+	}
+	if scanErr != nil {
+		logFatalf("Error exporting the index after [%d] documents: %s", n, scanErr)
+	}
+	// stdout holds the documents, so the count goes to the log
+	if opts.Output == "" {
+		logInfof("Exported [%d] documents from [%s]", n, opts.Index)
+	} else {
+		fmt.Printf("Exported [%d] documents from [%s] to [%s]\n", n, opts.Index, opts.Output)
+	}
+}
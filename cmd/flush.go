@@ -0,0 +1,50 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// flushCmd represents the flush command
+var flushCmd = &cobra.Command{
+	Use:   "flush <index>",
+	Short: "Flush an index",
+	Long: `Flush an opensearch index, writing the documents in its transaction log to
+	disk so they needn't be replayed when a shard recovers. The name may contain wildcards.
+	$ opensearch-doc index flush my_index`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		FlushIndex(args[0])
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(flushCmd)
+}
+
+// FlushIndex flushes an index.
+func FlushIndex(index string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.IndicesFlushRequest{Index: []string{index}}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error flushing the index: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error flushing the index: %s", err)
+	}
+	shards, err := readShardResults(res.Body)
+	if err != nil {
+		logFatalf("Error reading the response: %s", err)
+	}
+	fmt.Printf("Flushed [%s] on [%d] of [%d] shards\n", index, shards.Successful, shards.Total)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// forcemergeCmd represents the forcemerge command
+var forcemergeCmd = &cobra.Command{
+	Use:   "forcemerge <index>",
+	Short: "Merge an index's segments",
+	Long: `Merge the segments of an opensearch index, which makes searches of an index
+	that is no longer written to faster. The name may contain wildcards. With
+	--max-segments, each shard is merged down to at most that many segments; with
+	--only-expunge-deletes, only segments holding deleted documents are merged.
+	A merge can take a long time on a large index, and the command waits for it.
+	$ opensearch-doc index forcemerge logs-2022.01 --max-segments 1`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		maxSegments, _ := cmd.Flags().GetInt("max-segments")
+		onlyExpungeDeletes, _ := cmd.Flags().GetBool("only-expunge-deletes")
+		ForcemergeIndex(args[0], maxSegments, onlyExpungeDeletes)
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(forcemergeCmd)
+
+	forcemergeCmd.Flags().Int("max-segments", 0, "The number of segments to merge each shard down to (default from the cluster)")
+	forcemergeCmd.Flags().Bool("only-expunge-deletes", false, "Only merge segments holding deleted documents")
+}
+
+// ForcemergeIndex merges the segments of an index, down to maxSegments if
+// it is positive.
+func ForcemergeIndex(index string, maxSegments int, onlyExpungeDeletes bool) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	req := opensearchapi.IndicesForcemergeRequest{Index: []string{index}}
+	if maxSegments > 0 {
+		req.MaxNumSegments = &maxSegments
+	}
+	if onlyExpungeDeletes {
+		req.OnlyExpungeDeletes = &onlyExpungeDeletes
+	}
+	res, err := req.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error merging the index: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error merging the index: %s", err)
+	}
+	shards, err := readShardResults(res.Body)
+	if err != nil {
+		logFatalf("Error reading the response: %s", err)
+	}
+	fmt.Printf("Merged [%s] on [%d] of [%d] shards\n", index, shards.Successful, shards.Total)
+}
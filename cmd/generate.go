@@ -0,0 +1,180 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// generateCmd represents the generate command
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate synthetic documents from a template",
+	Long: `Generate --count documents from a JSON template, for demos and tests, and write them as
+	NDJSON to stdout, or to a file with -o (compressed if it ends in .gz or .zst), or load them
+	into an index with -i, through the same bulk indexer as the bulk command.
+	$ opensearch-doc generate --template template.json --count 1000 -o people.ndjson
+	$ opensearch-doc generate --template template.json --count 1000000 -i people
+
+	Strings in the template may hold placeholders, which are replaced in each document:
+	{{seq}} (1, 2, ...), {{uuid}}, {{name}}, {{first_name}}, {{last_name}}, {{email}},
+	{{ip}}, {{ipv6}}, {{word}}, {{lorem 20}} (words), {{int 1 100}}, {{float 0 1}},
+	{{bool}}, {{choice red green blue}}, {{now}}, and {{timestamp 2022-01-01 2022-12-31}}
+	(by default, in the last thirty days). A string that is just one placeholder takes its
+	value, so {{int 1 100}} is a number; otherwise the values are put in the text:
+	{"_id": "user-{{seq}}", "name": "{{name}}", "age": "{{int 18 90}}", "ip": "{{ip}}"}
+
+	Loaded documents keep the _id of the template, if it has one, and are otherwise given
+	IDs by OpenSearch. Use --seed to generate the same documents again, apart from {{now}}
+	and timestamps without a range.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		template, _ := cmd.Flags().GetString("template")
+		count, _ := cmd.Flags().GetInt("count")
+		output, _ := cmd.Flags().GetString("output")
+		index, _ := cmd.Flags().GetString("index")
+		seed, _ := cmd.Flags().GetInt64("seed")
+		workers, _ := cmd.Flags().GetInt("workers")
+		flushBytes, _ := cmd.Flags().GetInt("flush-bytes")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		if !cmd.Flags().Changed("seed") {
+			seed = time.Now().UnixNano()
+		}
+		stats, err := Generate(GenerateOptions{
+			Template:   template,
+			Count:      count,
+			Output:     output,
+			Index:      index,
+			Seed:       seed,
+			Workers:    workers,
+			FlushBytes: flushBytes,
+			Quiet:      quiet,
+		})
+		if err != nil {
+			logErrorf("%s", err)
+		}
+		if code := bulkExitCode(false, stats, err); code != 0 {
+			exit(code)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(generateCmd)
+
+	generateCmd.Flags().String("template", "", "A JSON file of the template of the documents")
+	generateCmd.Flags().Int("count", 10, "The number of documents to generate")
+	generateCmd.Flags().StringP("output", "o", "", "The file to write to, compressed if it ends in .gz or .zst (default stdout)")
+	generateCmd.Flags().StringP("index", "i", "", "An index to load the documents into, instead of writing them")
+	generateCmd.Flags().Int64("seed", 0, "The seed of the random values (default from the time)")
+	generateCmd.Flags().Int("workers", 4, "With --index, the number of indexer worker goroutines")
+	generateCmd.Flags().Int("flush-bytes", 5e+6, "With --index, the flush threshold in bytes")
+	generateCmd.Flags().BoolP("quiet", "q", false, "With --index, don't report progress")
+	generateCmd.MarkFlagRequired("template")
+	generateCmd.MarkFlagsMutuallyExclusive("output", "index")
+}
+
+// GenerateOptions holds the settings for generating documents.
+type GenerateOptions struct {
+	Template string // A JSON file of the template
+	Count    int    // The number of documents
+	Output   string // The file to write to; stdout if empty
+	Index    string // The index to load the documents into, instead of writing them
+	Seed     int64  // The seed of the random values
+
+	Workers    int  // With Index, the number of indexer worker goroutines
+	FlushBytes int  // With Index, the flush threshold in bytes
+	Quiet      bool // With Index, don't report progress
+}
+
+// Generate makes documents from a template and writes them, or loads them
+// into an index. It returns the Stats of the load, if there is one.
+func Generate(opts GenerateOptions) (osdoc.Stats, error) {
+	template, err := readJSONFile(opts.Template, "")
+	if err != nil {
+		return osdoc.Stats{}, fmt.Errorf("reading the template: %w", err)
+	}
+	generator, err := osdoc.NewGenerator(template, opts.Seed)
+	if err != nil {
+		return osdoc.Stats{}, fmt.Errorf("in the template: %w", err)
+	}
+	if opts.Index == "" {
+		return osdoc.Stats{}, writeGenerated(generator, opts)
+	}
+	client, err := NewClient()
+	if err != nil {
+		return osdoc.Stats{}, &connectionError{fmt.Errorf("creating the client: %w", err)}
+	}
+	loader, err := osdoc.NewBulkLoader(context.Background(), client, osdoc.Options{
+		Index:         opts.Index,
+		Action:        "index",
+		IDField:       "_id",
+		AutoID:        true,
+		Format:        "json",
+		Workers:       opts.Workers,
+		FlushBytes:    opts.FlushBytes,
+		FlushInterval: 30 * time.Second,
+	})
+	if err != nil {
+		return osdoc.Stats{}, err
+	}
+	return load(loader, BulkOptions{Quiet: opts.Quiet, ProgressInterval: time.Second}, time.Now(), func(p *progress) error {
+		add := loader.Adder("generate")
+		for i := 1; i <= opts.Count; i++ {
+			err := add(i, generator.Next())
+			if err == osdoc.ErrStopped {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeGenerated writes the generated documents as NDJSON.
+func writeGenerated(generator *osdoc.Generator, opts GenerateOptions) error {
+	file := os.Stdout
+	if opts.Output != "" {
+		var err error
+		file, err = os.Create(opts.Output)
+		if err != nil {
+			return fmt.Errorf("creating the output file: %w", err)
+		}
+	}
+	w, err := compress(file, opts.Output)
+	if err != nil {
+		return fmt.Errorf("compressing the output: %w", err)
+	}
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	for i := 0; i < opts.Count && err == nil; i++ {
+		err = encoder.Encode(generator.Next())
+	}
+	if flushErr := buffered.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing the documents: %w", err)
+	}
+	if opts.Output != "" {
+		fmt.Printf("Generated [%d] documents in [%s]\n", opts.Count, opts.Output)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// writeHits writes search hits to w: as JSON, one per line, or as a table
+// or CSV with a row per hit. The columns are field paths in each hit's
+// _source, or _id, _index, or _score; by default they are _id and every
+// field of the hits, with nested fields flattened to dotted paths.
+func writeHits(w io.Writer, hits []json.RawMessage, format string, columns []string) error {
+	if format == "json" {
+		var out bytes.Buffer
+		for _, hit := range hits {
+			// one hit per line, even from a pretty-printed response
+			json.Compact(&out, hit)
+			out.WriteByte('\n')
+		}
+		_, err := out.WriteTo(w)
+		return err
+	}
+	parsed := make([]map[string]interface{}, len(hits))
+	for i, hit := range hits {
+		if err := json.Unmarshal(hit, &parsed[i]); err != nil {
+			return err
+		}
+	}
+	if len(columns) == 0 {
+		columns = hitColumns(parsed)
+	}
+	paths := make([][]string, len(columns))
+	for i, column := range columns {
+		paths[i] = osdoc.SplitFieldPath(column)
+	}
+	rows := make([][]string, len(parsed))
+	for i, hit := range parsed {
+		source, _ := hit["_source"].(map[string]interface{})
+		row := make([]string, len(columns))
+		for j, column := range columns {
+			switch column {
+			case "_id", "_index", "_score", "_routing":
+				row[j] = cellValue(hit[column])
+			default:
+				row[j] = cellValue(osdoc.LookupField(source, paths[j]))
+			}
+		}
+		rows[i] = row
+	}
+	return writeRows(w, format, columns, rows)
+}
+
+// writeRows writes rows of cells to w as a table or CSV, with a header of
+// the column names.
+func writeRows(w io.Writer, format string, columns []string, rows [][]string) error {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write(columns)
+		cw.WriteAll(rows)
+		return cw.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(columns, "\t"))
+		for _, row := range rows {
+			// a tab or newline in a value would break the table
+			for j, cell := range row {
+				row[j] = strings.NewReplacer("\t", " ", "\n", " ").Replace(cell)
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown format '%s'", format)
+}
+
+// hitColumns returns _id and the dotted paths of the fields in the hits'
+// sources, sorted within each hit, in the order they first appear.
+func hitColumns(hits []map[string]interface{}) []string {
+	columns := []string{"_id"}
+	seen := map[string]bool{}
+	for _, hit := range hits {
+		source, _ := hit["_source"].(map[string]interface{})
+		flattenFields("", source, seen, &columns)
+	}
+	return columns
+}
+
+func flattenFields(prefix string, object map[string]interface{}, seen map[string]bool, columns *[]string) {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		path := prefix + strings.ReplaceAll(key, ".", `\.`)
+		if nested, ok := object[key].(map[string]interface{}); ok && len(nested) > 0 {
+			flattenFields(path+".", nested, seen, columns)
+			continue
+		}
+		if !seen[path] {
+			seen[path] = true
+			*columns = append(*columns, path)
+		}
+	}
+}
+
+// cellValue formats a field value for a table or CSV cell: strings as they
+// are, missing values as nothing, and anything else as JSON.
+func cellValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
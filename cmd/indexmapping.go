@@ -0,0 +1,309 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// mappingCmd represents the mapping command
+var mappingCmd = &cobra.Command{
+	Use:   "mapping",
+	Short: "Get or update an index's mapping",
+}
+
+// mappingGetCmd represents the mapping get command
+var mappingGetCmd = &cobra.Command{
+	Use:   "get <index>",
+	Short: "Show an index's mapping",
+	Long: `Show the mapping of an opensearch index, as JSON.
+	$ opensearch-doc index mapping get my_index`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		GetMapping(args[0])
+	},
+}
+
+// mappingPutCmd represents the mapping put command
+var mappingPutCmd = &cobra.Command{
+	Use:   "put <index>",
+	Short: "Add fields to an index's mapping",
+	Long: `Update the mapping of an opensearch index from a JSON file.
+
+	The file may hold just the mapping or wrap it in a "mappings" key. New fields are
+	added to the mapping; OpenSearch refuses to change the type of an existing field,
+	which needs a new index and a reindex.
+	$ opensearch-doc index mapping put my_index --file mapping.json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		PutMapping(args[0], file)
+	},
+}
+
+// mappingInferCmd represents the mapping infer command
+var mappingInferCmd = &cobra.Command{
+	Use:   "infer",
+	Short: "Propose a mapping from sample documents",
+	Long: `Propose a mapping for an index from the first --samples documents of the input,
+	read as bulk reads it, and print it as JSON, ready for index create --mappings.
+	$ opensearch-doc index mapping infer --file sample.ndjson > mappings.json
+	$ opensearch-doc index create my_index --mappings mappings.json
+
+	Numbers are mapped as long or double, true and false as boolean, and strings in ISO 8601
+	form (or as "2006-01-02 15:04:05") as date. Other strings are mapped as keyword, or as
+	text with a keyword sub-field if some have several words. Objects are mapped by their
+	fields, and arrays of objects as nested. A field holding values of different types is
+	reported, and fields that are always null are left out. Review the mapping before using
+	it: a sample can't tell an identifier that happens to be numeric from a number.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		files, _ := cmd.Flags().GetStringArray("file")
+		format, _ := cmd.Flags().GetString("format")
+		inferTypes, _ := cmd.Flags().GetBool("infer-types")
+		samples, _ := cmd.Flags().GetInt("samples")
+		InferMapping(files, format, inferTypes, samples)
+	},
+}
+
+// mappingCheckCmd represents the mapping check command
+var mappingCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check documents against an index's mapping before loading them",
+	Long: `Compare the fields of the input documents, read as bulk reads them, with the live
+	mapping of an index, and report each field that doesn't fit: values of the wrong type,
+	which would fail their documents, and fields that aren't mapped, which dynamic mapping
+	would add, or which would fail their documents if the mapping is strict. Each field is
+	reported once, with the number of documents and the first of them.
+	$ opensearch-doc index mapping check -i my_index --file data.ndjson
+
+	The exit code is 1 if some documents would fail, and 0 otherwise, even if dynamic
+	mapping would add fields, so it can gate a load in a script.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, _ := cmd.Flags().GetString("index")
+		files, _ := cmd.Flags().GetStringArray("file")
+		format, _ := cmd.Flags().GetString("format")
+		types, _ := cmd.Flags().GetStringToString("types")
+		inferTypes, _ := cmd.Flags().GetBool("infer-types")
+		samples, _ := cmd.Flags().GetInt("samples")
+		if !CheckMapping(index, files, format, types, inferTypes, samples) {
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(mappingCmd)
+	mappingCmd.AddCommand(mappingGetCmd)
+	mappingCmd.AddCommand(mappingPutCmd)
+	mappingCmd.AddCommand(mappingInferCmd)
+	mappingCmd.AddCommand(mappingCheckCmd)
+
+	mappingPutCmd.Flags().String("file", "", "A JSON file of the mapping")
+	mappingPutCmd.MarkFlagRequired("file")
+
+	mappingInferCmd.Flags().StringArrayP("file", "F", nil, "A file (or glob pattern) of sample documents, instead of stdin; may be repeated")
+	mappingInferCmd.Flags().String("format", "json", "The input format: json, csv, tsv, parquet, avro, xml, or yaml")
+	mappingInferCmd.Flags().Bool("infer-types", false, "Infer int, float, and bool values for csv/tsv columns")
+	mappingInferCmd.Flags().Int("samples", 10000, "The most documents to read")
+
+	mappingCheckCmd.Flags().StringP("index", "i", "", "The index whose mapping to check against")
+	mappingCheckCmd.Flags().StringArrayP("file", "F", nil, "A file (or glob pattern) of documents, instead of stdin; may be repeated")
+	mappingCheckCmd.Flags().String("format", "json", "The input format: json, csv, tsv, parquet, avro, xml, or yaml")
+	mappingCheckCmd.Flags().StringToString("types", nil, "Column types for csv/tsv input, e.g. age=int,price=float,active=bool")
+	mappingCheckCmd.Flags().Bool("infer-types", false, "Infer int, float, and bool values for csv/tsv columns without a type")
+	mappingCheckCmd.Flags().Int("samples", 0, "The most documents to read; 0 for all of them")
+	mappingCheckCmd.MarkFlagRequired("index")
+}
+
+// GetMapping prints the mapping of an index.
+func GetMapping(index string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.IndicesGetMappingRequest{Index: []string{index}}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error getting the mapping: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error getting the mapping: %s", err)
+	}
+	if err := printJSON(res.Body); err != nil {
+		logFatalf("Error reading the mapping: %s", err)
+	}
+}
+
+// PutMapping updates the mapping of an index from a JSON file.
+func PutMapping(index string, file string) {
+	mapping, err := readJSONFile(file, "mappings")
+	if err != nil {
+		logFatalf("Error reading the mapping: %s", err)
+	}
+	body, err := json.Marshal(mapping)
+	if err != nil {
+		logFatalf("Error encoding the mapping: %s", err)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.IndicesPutMappingRequest{
+		Index: []string{index},
+		Body:  bytes.NewReader(body),
+	}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error updating the mapping: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error updating the mapping: %s", err)
+	}
+	fmt.Printf("Updated the mapping of [%s]\n", index)
+}
+
+// InferMapping prints a mapping proposed from up to samples documents of
+// the files, or of stdin if there are none.
+func InferMapping(files []string, format string, inferTypes bool, samples int) {
+	if samples <= 0 {
+		logFatalf("--samples must be positive")
+	}
+	src := sampleSource(files, format, nil, inferTypes)
+	defer src.Close()
+	inferrer := osdoc.NewMappingInferrer()
+	for inferrer.Documents() < samples {
+		doc, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logFatalf("Error reading the input: %s", err)
+		}
+		if doc.Fields == nil {
+			logWarnf("%s:%d: skipping a record that couldn't be parsed", doc.Source, doc.Line)
+			continue
+		}
+		inferrer.Add(doc.Fields)
+	}
+	mapping, conflicts := inferrer.Mapping()
+	for _, conflict := range conflicts {
+		logWarnf("%s", conflict)
+	}
+	data, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		logFatalf("Error encoding the mapping: %s", err)
+	}
+	fmt.Println(string(data))
+	logInfof("Proposed a mapping from [%d] documents", inferrer.Documents())
+}
+
+// mappingFinding is a problem of a field found in some documents.
+type mappingFinding struct {
+	osdoc.MappingProblem
+	documents int    // The documents with the problem
+	first     string // Where the first of them was read
+}
+
+// CheckMapping checks up to samples documents of the files, or of stdin if
+// there are none, against the mapping of index, reports the fields that
+// don't fit it, and returns whether all the documents would be indexed.
+func CheckMapping(index string, files []string, format string, types map[string]string, inferTypes bool, samples int) bool {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	checker, err := osdoc.NewMappingChecker(context.Background(), client, index)
+	if err != nil {
+		logFatalf("Error getting the mapping: %s", err)
+	}
+	src := sampleSource(files, format, types, inferTypes)
+	defer src.Close()
+	findings := map[string]*mappingFinding{}
+	documents, failing := 0, 0
+	for samples <= 0 || documents < samples {
+		doc, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logFatalf("Error reading the input: %s", err)
+		}
+		if doc.Fields == nil {
+			logWarnf("%s:%d: skipping a record that couldn't be parsed", doc.Source, doc.Line)
+			continue
+		}
+		documents++
+		fails := false
+		seen := map[string]bool{}
+		for _, problem := range checker.Check(doc.Fields) {
+			fails = fails || problem.Fails()
+			// a field is counted once per document, however many values
+			// it has
+			key := problem.Kind + " " + problem.Field
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			finding, ok := findings[key]
+			if !ok {
+				finding = &mappingFinding{MappingProblem: problem, first: fmt.Sprintf("%s:%d", doc.Source, doc.Line)}
+				findings[key] = finding
+			}
+			finding.documents++
+		}
+		if fails {
+			failing++
+		}
+	}
+	sorted := make([]*mappingFinding, 0, len(findings))
+	for _, finding := range findings {
+		sorted = append(sorted, finding)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Field != sorted[j].Field {
+			return sorted[i].Field < sorted[j].Field
+		}
+		return sorted[i].Kind < sorted[j].Kind
+	})
+	for _, finding := range sorted {
+		fmt.Printf("Field [%s] %s, in [%d] documents, first at %s\n", finding.Field, finding.Detail, finding.documents, finding.first)
+	}
+	fmt.Printf("Checked [%d] documents against the mapping of [%s] (dynamic: %s): [%d] would fail\n",
+		documents, index, checker.Dynamic(), failing)
+	return failing == 0
+}
+
+// sampleSource returns the documents of the files, or of stdin if there
+// are none, parsed as bulk parses them.
+func sampleSource(files []string, format string, types map[string]string, inferTypes bool) osdoc.DocumentSource {
+	// a dry-run loader, for its parser of the input formats
+	loader, err := osdoc.NewBulkLoader(context.Background(), nil, osdoc.Options{
+		Action:       "index",
+		IDField:      "_id",
+		Format:       format,
+		Types:        types,
+		InferTypes:   inferTypes,
+		MaxLineBytes: 100 << 20,
+		DryRun:       true,
+	})
+	if err != nil {
+		logFatalf("%s", err)
+	}
+	if len(files) == 0 {
+		return osdoc.NewReaderSource("stdin", os.Stdin, loader.Parse)
+	}
+	return osdoc.NewGlobSource(files, loader.Parse)
+}
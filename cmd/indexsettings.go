@@ -0,0 +1,135 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// settingsCmd represents the settings command
+var settingsCmd = &cobra.Command{
+	Use:   "settings",
+	Short: "Get or update an index's settings",
+}
+
+// settingsGetCmd represents the settings get command
+var settingsGetCmd = &cobra.Command{
+	Use:   "get <index>",
+	Short: "Show an index's settings",
+	Long: `Show the settings of an opensearch index, as JSON with flat keys such as
+	index.refresh_interval, which are the keys --set takes.
+	$ opensearch-doc index settings get my_index --include-defaults`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		defaults, _ := cmd.Flags().GetBool("include-defaults")
+		GetSettings(args[0], defaults)
+	},
+}
+
+// settingsPutCmd represents the settings put command
+var settingsPutCmd = &cobra.Command{
+	Use:   "put <index>",
+	Short: "Update an index's dynamic settings",
+	Long: `Update the dynamic settings of an opensearch index.
+
+	Settings are read from a JSON file with --file, which may wrap them in a "settings"
+	key, and from --set key=value, which may be repeated and overrides the file. A value
+	of null restores the setting's default. A big bulk load is faster with refresh and
+	replicas turned off, and turned back on afterwards:
+	$ opensearch-doc index settings put my_index --set index.refresh_interval=-1 --set index.number_of_replicas=0
+	$ opensearch-doc index settings put my_index --set index.refresh_interval=null --set index.number_of_replicas=1`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		set, _ := cmd.Flags().GetStringArray("set")
+		PutSettings(args[0], file, set)
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(settingsCmd)
+	settingsCmd.AddCommand(settingsGetCmd)
+	settingsCmd.AddCommand(settingsPutCmd)
+
+	settingsGetCmd.Flags().Bool("include-defaults", false, "Include the settings left at their defaults")
+	settingsPutCmd.Flags().String("file", "", "A JSON file of settings")
+	settingsPutCmd.Flags().StringArray("set", nil, "Set a setting, as key=value (may be repeated)")
+}
+
+// GetSettings prints the settings of an index.
+func GetSettings(index string, includeDefaults bool) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	flat := true
+	res, err := opensearchapi.IndicesGetSettingsRequest{
+		Index:           []string{index},
+		FlatSettings:    &flat,
+		IncludeDefaults: &includeDefaults,
+	}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error getting the settings: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error getting the settings: %s", err)
+	}
+	if err := printJSON(res.Body); err != nil {
+		logFatalf("Error reading the settings: %s", err)
+	}
+}
+
+// PutSettings updates the settings of an index from a JSON file and from
+// key=value pairs.
+func PutSettings(index string, file string, set []string) {
+	settings, err := settingsBody(file, set)
+	if err != nil {
+		logFatalf("%s", err)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	if err := osdoc.PutIndexSettings(context.Background(), client, []string{index}, settings); err != nil {
+		logFatalf("Error updating the settings: %s", err)
+	}
+	fmt.Printf("Updated the settings of [%s]\n", index)
+}
+
+// settingsBody builds the body of a settings update from a file and from
+// key=value pairs. Values are sent as strings, which OpenSearch converts to
+// the setting's type, except null, which resets the setting.
+func settingsBody(file string, set []string) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	if file != "" {
+		var err error
+		settings, err = readJSONFile(file, "settings")
+		if err != nil {
+			return nil, fmt.Errorf("reading the settings: %w", err)
+		}
+	}
+	for _, pair := range set {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("--set %q isn't key=value", pair)
+		}
+		if value == "null" {
+			settings[key] = nil
+		} else {
+			settings[key] = value
+		}
+	}
+	if len(settings) == 0 {
+		return nil, errors.New("no settings to update; use --file or --set")
+	}
+	return settings, nil
+}
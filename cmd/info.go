@@ -0,0 +1,48 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// infoCmd represents the info command
+var infoCmd = &cobra.Command{
+	Use:   "info <index>",
+	Short: "Show an index's settings, mappings, and aliases",
+	Long: `Show the settings, mappings, and aliases of an opensearch index, as JSON.
+
+	The name may contain wildcards, to show several indices at once.
+	$ opensearch-doc index info my_index`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		IndexInfo(args[0])
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(infoCmd)
+}
+
+// IndexInfo prints the settings, mappings, and aliases of an index.
+func IndexInfo(index string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.IndicesGetRequest{Index: []string{index}}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error getting the index: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error getting the index: %s", err)
+	}
+	if err := printJSON(res.Body); err != nil {
+		logFatalf("Error reading the index: %s", err)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// ismCmd represents the ism command
+var ismCmd = &cobra.Command{
+	Use:   "ism",
+	Short: "Manage Index State Management policies",
+	Long: `Manage Index State Management (ISM) policies, which move indices through states
+	such as hot, warm, and deleted as they age, for example to roll them over or to enforce
+	retention. Policies are attached to the indices they manage.`,
+}
+
+// ismPolicyCmd represents the ism policy command
+var ismPolicyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Manage ISM policies",
+}
+
+// ismPolicyPutCmd represents the ism policy put command
+var ismPolicyPutCmd = &cobra.Command{
+	Use:   "put <policy>",
+	Short: "Create or replace an ISM policy from a JSON file",
+	Long: `Create or replace an ISM policy from a JSON file, which may hold the policy or wrap
+	it in a "policy" key. Indices the policy is already attached to keep the version they
+	started with.
+	$ opensearch-doc ism policy put logs-retention --file retention.json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		PutISMPolicy(args[0], file)
+	},
+}
+
+// ismPolicyGetCmd represents the ism policy get command
+var ismPolicyGetCmd = &cobra.Command{
+	Use:   "get <policy>",
+	Short: "Show an ISM policy, as JSON",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		GetISMPolicy(args[0])
+	},
+}
+
+// ismPolicyDeleteCmd represents the ism policy delete command
+var ismPolicyDeleteCmd = &cobra.Command{
+	Use:   "delete <policy>",
+	Short: "Delete an ISM policy",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		DeleteISMPolicy(args[0])
+	},
+}
+
+// ismPolicyListCmd represents the ism policy list command
+var ismPolicyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List ISM policies",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ListISMPolicies()
+	},
+}
+
+// ismAttachCmd represents the ism attach command
+var ismAttachCmd = &cobra.Command{
+	Use:   "attach <policy> <index>",
+	Short: "Attach an ISM policy to indices",
+	Long: `Attach an ISM policy to the existing indices matching a name, which may contain
+	wildcards. To attach a policy to indices created later, give it an ism_template.
+	$ opensearch-doc ism attach logs-retention 'logs-*'`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		AttachISMPolicy(args[0], args[1])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ismCmd)
+	ismCmd.AddCommand(ismPolicyCmd)
+	ismCmd.AddCommand(ismAttachCmd)
+	ismPolicyCmd.AddCommand(ismPolicyPutCmd, ismPolicyGetCmd, ismPolicyDeleteCmd, ismPolicyListCmd)
+
+	ismPolicyPutCmd.Flags().String("file", "", "A JSON file of the policy")
+	ismPolicyPutCmd.MarkFlagRequired("file")
+}
+
+// ismPoliciesPath is the path of the ISM policies API.
+const ismPoliciesPath = "/_plugins/_ism/policies/"
+
+// ismPolicy is a policy as the ISM API returns it.
+type ismPolicy struct {
+	ID          string                 `json:"_id"`
+	SeqNo       int64                  `json:"_seq_no"`
+	PrimaryTerm int64                  `json:"_primary_term"`
+	Policy      map[string]interface{} `json:"policy"`
+}
+
+// PutISMPolicy creates or replaces a policy from a JSON file.
+func PutISMPolicy(name string, file string) {
+	policy, err := readJSONFile(file, "policy")
+	if err != nil {
+		logFatalf("Error reading the policy: %s", err)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	// replacing a policy requires the sequence number of the current one
+	path := ismPoliciesPath + url.PathEscape(name)
+	var current ismPolicy
+	var apiErr *apiError
+	err = jsonRequest(context.Background(), client, http.MethodGet, path, nil, &current)
+	if err == nil {
+		path += fmt.Sprintf("?if_seq_no=%d&if_primary_term=%d", current.SeqNo, current.PrimaryTerm)
+	} else if !errors.As(err, &apiErr) || apiErr.Status != 404 {
+		logFatalf("Error getting the policy: %s", err)
+	}
+	if err := jsonRequest(context.Background(), client, http.MethodPut, path, map[string]interface{}{"policy": policy}, nil); err != nil {
+		logFatalf("Error putting the policy: %s", err)
+	}
+	fmt.Printf("Put ISM policy [%s]\n", name)
+}
+
+// GetISMPolicy prints a policy.
+func GetISMPolicy(name string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := performRequest(context.Background(), client, http.MethodGet, ismPoliciesPath+url.PathEscape(name), nil)
+	if err != nil {
+		logFatalf("Error getting the policy: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error getting the policy: %s", err)
+	}
+	if err := printJSON(res.Body); err != nil {
+		logFatalf("Error reading the policy: %s", err)
+	}
+}
+
+// DeleteISMPolicy deletes a policy.
+func DeleteISMPolicy(name string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	if err := jsonRequest(context.Background(), client, http.MethodDelete, ismPoliciesPath+url.PathEscape(name), nil, nil); err != nil {
+		logFatalf("Error deleting the policy: %s", err)
+	}
+	fmt.Printf("Deleted ISM policy [%s]\n", name)
+}
+
+// ListISMPolicies prints the name and description of each policy.
+func ListISMPolicies() {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	var result struct {
+		Policies []ismPolicy `json:"policies"`
+	}
+	if err := jsonRequest(context.Background(), client, http.MethodGet, ismPoliciesPath+"?size=1000", nil, &result); err != nil {
+		logFatalf("Error listing the policies: %s", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, policy := range result.Policies {
+		fmt.Fprintf(w, "%s\t%v\n", policy.ID, policy.Policy["description"])
+	}
+	w.Flush()
+}
+
+// AttachISMPolicy attaches a policy to the indices matching index.
+func AttachISMPolicy(policy string, index string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	var result struct {
+		UpdatedIndices int  `json:"updated_indices"`
+		Failures       bool `json:"failures"`
+		FailedIndices  []struct {
+			IndexName string `json:"index_name"`
+			Reason    string `json:"reason"`
+		} `json:"failed_indices"`
+	}
+	path := "/_plugins/_ism/add/" + url.PathEscape(index)
+	if err := jsonRequest(context.Background(), client, http.MethodPost, path, map[string]string{"policy_id": policy}, &result); err != nil {
+		logFatalf("Error attaching the policy: %s", err)
+	}
+	for _, failed := range result.FailedIndices {
+		logErrorf("Error attaching the policy to [%s]: %s", failed.IndexName, failed.Reason)
+	}
+	fmt.Printf("Attached ISM policy [%s] to [%d] indices\n", policy, result.UpdatedIndices)
+	if result.Failures {
+		exit(1)
+	}
+}
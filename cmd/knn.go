@@ -0,0 +1,154 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// knnSearchCmd represents the knn-search command
+var knnSearchCmd = &cobra.Command{
+	Use:   "knn-search",
+	Short: "Find the nearest neighbors of a vector",
+	Long: `Search a k-NN vector field of an index for the --k documents nearest to a vector, with
+	the k-NN plugin, and write the hits as search does. The vector is read from a JSON file
+	with --vector-file, or from stdin with --vector-file -, as an array of numbers, or as an
+	object with the array in a "vector" key.
+	$ opensearch-doc knn-search -i products --field embedding --vector-file vec.json --k 10
+
+	--filter narrows the neighbors to the documents matching the query in a JSON file (which
+	may wrap it in a "query" key); the filter is applied during the search, which needs a
+	field using the lucene or faiss engine. The vector field is left out of the hits, unless
+	--include-vector is given.
+
+	With --format table or --format csv, each hit is a row; --columns picks the columns, as
+	for search:
+	$ opensearch-doc knn-search -i products --field embedding --vector-file vec.json --format table --columns _id,_score,name`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, _ := cmd.Flags().GetString("index")
+		field, _ := cmd.Flags().GetString("field")
+		vectorFile, _ := cmd.Flags().GetString("vector-file")
+		k, _ := cmd.Flags().GetInt("k")
+		filter, _ := cmd.Flags().GetString("filter")
+		includeVector, _ := cmd.Flags().GetBool("include-vector")
+		format, _ := cmd.Flags().GetString("format")
+		columns, _ := cmd.Flags().GetStringSlice("columns")
+		KNNSearch(KNNSearchOptions{
+			Index:         index,
+			Field:         field,
+			VectorFile:    vectorFile,
+			K:             k,
+			Filter:        filter,
+			IncludeVector: includeVector,
+			Format:        format,
+			Columns:       columns,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(knnSearchCmd)
+
+	knnSearchCmd.Flags().StringP("index", "i", "", "The index (or comma-separated indices or wildcard) to search")
+	knnSearchCmd.Flags().String("field", "", "The k-NN vector field to search")
+	knnSearchCmd.Flags().String("vector-file", "", "A JSON file of the vector to find the neighbors of; - for stdin")
+	knnSearchCmd.Flags().Int("k", 10, "The number of neighbors to return")
+	knnSearchCmd.Flags().String("filter", "", "A JSON file of a query the neighbors must match")
+	knnSearchCmd.Flags().Bool("include-vector", false, "Keep the vector field in the hits")
+	knnSearchCmd.Flags().String("format", "json", "The output format: json, table, or csv")
+	knnSearchCmd.Flags().StringSlice("columns", nil, "The fields to show as columns with --format table or csv, separated by commas")
+	knnSearchCmd.MarkFlagRequired("index")
+	knnSearchCmd.MarkFlagRequired("field")
+	knnSearchCmd.MarkFlagRequired("vector-file")
+}
+
+// KNNSearchOptions holds the settings for a k-NN search.
+type KNNSearchOptions struct {
+	Index         string // The index to search
+	Field         string // The k-NN vector field
+	VectorFile    string // A JSON file of the vector, or - for stdin
+	K             int    // The number of neighbors
+	Filter        string // A JSON file of a query the neighbors must match
+	IncludeVector bool   // Keep the vector field in the hits
+
+	Format  string   // json, table, or csv
+	Columns []string // The fields to show as table or CSV columns
+}
+
+// KNNSearch searches a vector field for the nearest neighbors of a vector
+// and prints the hits.
+func KNNSearch(opts KNNSearchOptions) {
+	switch opts.Format {
+	case "json", "table", "csv":
+	default:
+		logFatalf("unknown format '%s'", opts.Format)
+	}
+	if opts.K <= 0 {
+		logFatalf("--k must be positive")
+	}
+	vector, err := readVector(opts.VectorFile)
+	if err != nil {
+		logFatalf("Error reading the vector: %s", err)
+	}
+	knn := map[string]interface{}{"vector": vector, "k": opts.K}
+	if opts.Filter != "" {
+		filter, err := readJSONFile(opts.Filter, "query")
+		if err != nil {
+			logFatalf("Error reading the filter: %s", err)
+		}
+		knn["filter"] = filter
+	}
+	body := map[string]interface{}{
+		"size":  opts.K,
+		"query": map[string]interface{}{"knn": map[string]interface{}{opts.Field: knn}},
+	}
+	if !opts.IncludeVector {
+		body["_source"] = map[string]interface{}{"excludes": []string{opts.Field}}
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		logFatalf("Error encoding the query: %s", err)
+	}
+	runSearch(opensearchapi.SearchRequest{
+		Index: []string{opts.Index},
+		Body:  bytes.NewReader(data),
+	}, opts.Format, opts.Columns)
+}
+
+// readVector reads a vector from a JSON file, or from stdin if path is
+// "-": an array of numbers, or an object with one in a "vector" key.
+func readVector(path string) ([]float64, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var vector []float64
+	if err := json.Unmarshal(data, &vector); err == nil {
+		if len(vector) == 0 {
+			return nil, fmt.Errorf("%s: the vector is empty", path)
+		}
+		return vector, nil
+	}
+	var object struct {
+		Vector []float64 `json:"vector"`
+	}
+	if err := json.Unmarshal(data, &object); err != nil || len(object.Vector) == 0 {
+		return nil, fmt.Errorf("%s: not an array of numbers, or an object with one in a \"vector\" key", path)
+	}
+	return object.Vector, nil
+}
@@ -0,0 +1,122 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// logLevel is the severity of a log message.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (level logLevel) String() string {
+	return logLevelNames[level]
+}
+
+// leveledLogger writes log messages at or above a level, as text or as
+// JSON lines. It is safe for concurrent use.
+type leveledLogger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level logLevel
+	json  bool
+}
+
+// logger is the logger used by all of the commands, set up from the
+// --log-level, --log-format, and --log-file flags.
+var logger = &leveledLogger{out: os.Stderr, level: levelInfo}
+
+func init() {
+	osdoc.SetLogger(logger)
+}
+
+// setupLogging configures the logger. The level is debug, info, warn, or
+// error, and the format text or json. If file isn't empty, messages are
+// appended to it instead of written to stderr.
+func setupLogging(level, format, file string) error {
+	l := &leveledLogger{out: os.Stderr, level: -1}
+	for i, name := range logLevelNames {
+		if strings.EqualFold(level, name) {
+			l.level = logLevel(i)
+		}
+	}
+	if l.level < 0 {
+		return fmt.Errorf("unknown log level '%s'", level)
+	}
+	switch format {
+	case "text":
+	case "json":
+		l.json = true
+	default:
+		return fmt.Errorf("unknown log format '%s'", format)
+	}
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		l.out = f
+	}
+	logger = l
+	osdoc.SetLogger(l)
+	return nil
+}
+
+func (l *leveledLogger) logf(level logLevel, format string, args ...interface{}) {
+	if level < l.level {
+		return
+	}
+	message := fmt.Sprintf(format, args...)
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.json {
+		line, _ := json.Marshal(struct {
+			Time    string `json:"time"`
+			Level   string `json:"level"`
+			Message string `json:"msg"`
+		}{now.UTC().Format(time.RFC3339Nano), level.String(), message})
+		l.out.Write(append(line, '\n'))
+		return
+	}
+	fmt.Fprintf(l.out, "%s %-5s %s\n", now.Format("2006/01/02 15:04:05"), strings.ToUpper(level.String()), message)
+}
+
+// Debugf, Infof, Warnf, and Errorf make a leveledLogger an osdoc.Logger.
+func (l *leveledLogger) Debugf(format string, args ...interface{}) {
+	l.logf(levelDebug, format, args...)
+}
+func (l *leveledLogger) Infof(format string, args ...interface{}) { l.logf(levelInfo, format, args...) }
+func (l *leveledLogger) Warnf(format string, args ...interface{}) { l.logf(levelWarn, format, args...) }
+func (l *leveledLogger) Errorf(format string, args ...interface{}) {
+	l.logf(levelError, format, args...)
+}
+
+func logDebugf(format string, args ...interface{}) { logger.logf(levelDebug, format, args...) }
+func logInfof(format string, args ...interface{})  { logger.logf(levelInfo, format, args...) }
+func logWarnf(format string, args ...interface{})  { logger.logf(levelWarn, format, args...) }
+func logErrorf(format string, args ...interface{}) { logger.logf(levelError, format, args...) }
+
+// logFatalf logs an error and exits with status 1.
+func logFatalf(format string, args ...interface{}) {
+	logger.logf(levelError, format, args...)
+	exit(1)
+}
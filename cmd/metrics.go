@@ -0,0 +1,133 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// The counts, besides those of the load and requestRetries, that are
+// exposed as metrics, updated by clients from NewClient and by scanIndex
+var (
+	bulkInFlight  atomic.Int64 // Bulk requests being sent
+	bulkBytesSent atomic.Int64 // Bytes of bulk request bodies sent, including retries
+	scanRead      atomic.Int64 // Documents read by scans
+	scanTotal     atomic.Int64 // Documents the scans will read, or 0 if unknown
+)
+
+// currentLoad is the bulk load in progress, whose Stats are exposed as
+// metrics, or nil if there is none.
+var currentLoad atomic.Pointer[osdoc.BulkLoader]
+
+// serveMetrics serves Prometheus metrics at /metrics on addr, such as
+// :9090, until the process exits. It returns an error if it can't listen
+// on addr.
+func serveMetrics(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("serving metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w)
+	})
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logErrorf("Error serving metrics: %s", err)
+		}
+	}()
+	logInfof("Serving metrics at http://%s/metrics", listener.Addr())
+	return nil
+}
+
+// metric is a sample of a metric, with its labels, if any.
+type metric struct {
+	labels string
+	value  float64
+}
+
+// writeMetrics writes the metrics in the Prometheus text format.
+func writeMetrics(w io.Writer) {
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+	write := func(name string, kind string, help string, samples ...metric) {
+		fmt.Fprintf(out, "# HELP opensearch_doc_%s %s\n", name, help)
+		fmt.Fprintf(out, "# TYPE opensearch_doc_%s %s\n", name, kind)
+		for _, sample := range samples {
+			fmt.Fprintf(out, "opensearch_doc_%s%s %g\n", name, sample.labels, sample.value)
+		}
+	}
+	var stats osdoc.Stats
+	if loader := currentLoad.Load(); loader != nil {
+		stats = loader.Stats()
+	}
+	write("documents_flushed_total", "counter", "Documents the cluster indexed, created, updated, or deleted successfully; failures are not counted.",
+		metric{value: float64(stats.Flushed)})
+	write("documents_succeeded_total", "counter", "Documents indexed, created, updated, or deleted, by action.",
+		metric{`{action="index"}`, float64(stats.Indexed)},
+		metric{`{action="create"}`, float64(stats.Created)},
+		metric{`{action="update"}`, float64(stats.Updated)},
+		metric{`{action="delete"}`, float64(stats.Deleted)})
+	write("documents_failed_total", "counter", "Documents that failed, including those rejected before being sent.",
+		metric{value: float64(stats.Failed)})
+	write("documents_skipped_total", "counter", "Documents left out by --skip, --sample, --where, --transform, or --dedupe.",
+		metric{value: float64(stats.Skipped + stats.Duplicates)})
+	types := make([]string, 0, len(stats.Errors))
+	for errorType := range stats.Errors {
+		types = append(types, errorType)
+	}
+	sort.Strings(types)
+	failures := make([]metric, 0, len(types))
+	for _, errorType := range types {
+		failures = append(failures, metric{fmt.Sprintf(`{type="%s"}`, labelValue(errorType)), float64(stats.Errors[errorType])})
+	}
+	write("failures_total", "counter", "Failed documents, by error type.", failures...)
+	write("bulk_requests_total", "counter", "Bulk requests sent.",
+		metric{value: float64(stats.Requests)})
+	write("bulk_request_errors_total", "counter", "Bulk requests that failed outright.",
+		metric{value: float64(stats.RequestErrors)})
+	write("bulk_requests_in_flight", "gauge", "Bulk requests being sent.",
+		metric{value: float64(bulkInFlight.Load())})
+	write("bulk_bytes_sent_total", "counter", "Bytes of bulk request bodies sent, including retries.",
+		metric{value: float64(bulkBytesSent.Load())})
+	write("request_retries_total", "counter", "Requests retried.",
+		metric{value: float64(requestRetries.Load())})
+	write("scan_documents_read_total", "counter", "Documents read from an index by export or copy.",
+		metric{value: float64(scanRead.Load())})
+	write("scan_documents", "gauge", "Documents export or copy will read, or 0 if unknown.",
+		metric{value: float64(scanTotal.Load())})
+}
+
+// labelValue escapes a label value for the Prometheus text format.
+func labelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// metricsTransport counts the bulk requests in flight and the bytes of
+// their bodies.
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/_bulk") {
+		return t.next.RoundTrip(req)
+	}
+	bulkInFlight.Add(1)
+	defer bulkInFlight.Add(-1)
+	if req.ContentLength > 0 {
+		bulkBytesSent.Add(req.ContentLength)
+	}
+	return t.next.RoundTrip(req)
+}
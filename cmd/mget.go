@@ -0,0 +1,182 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// docMgetCmd represents the doc mget command
+var docMgetCmd = &cobra.Command{
+	Use:   "mget",
+	Short: "Get many documents by ID",
+	Long: `Get the documents whose IDs are read from a file with --ids-file, or from stdin, one
+	per line, and write them to stdout as NDJSON. Each document's ID is kept in the
+	--id-field, _id by default, as export does. The IDs are looked up --batch-size at a time.
+	IDs with no document are logged, or written to the --missing-file.
+	$ opensearch-doc doc mget -i users --ids-file ids.txt --missing-file missing.txt > users.json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, _ := cmd.Flags().GetString("index")
+		routing, _ := cmd.Flags().GetString("routing")
+		idsFile, _ := cmd.Flags().GetString("ids-file")
+		missingFile, _ := cmd.Flags().GetString("missing-file")
+		idField, _ := cmd.Flags().GetString("id-field")
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		MultiGet(MultiGetOptions{
+			Index:       index,
+			Routing:     routing,
+			IDsFile:     idsFile,
+			MissingFile: missingFile,
+			IDField:     idField,
+			BatchSize:   batchSize,
+		})
+	},
+}
+
+func init() {
+	docCmd.AddCommand(docMgetCmd)
+
+	docMgetCmd.Flags().String("ids-file", "", "A file of IDs, one per line (default stdin)")
+	docMgetCmd.Flags().String("missing-file", "", "A file to write the IDs with no document to, one per line")
+	docMgetCmd.Flags().String("id-field", "_id", "The field to keep each document's ID in; empty to leave it out")
+	docMgetCmd.Flags().Int("batch-size", 1000, "The number of IDs to look up in each request")
+}
+
+// MultiGetOptions holds the settings for getting documents by ID.
+type MultiGetOptions struct {
+	Index       string // The index of the documents
+	Routing     string // The routing value of the documents
+	IDsFile     string // A file of IDs; stdin if empty
+	MissingFile string // A file to write missing IDs to; logged if empty
+	IDField     string // The field to keep the ID in, if not empty
+	BatchSize   int    // The number of IDs in each request
+}
+
+// MultiGet writes the documents with the IDs read from a file as NDJSON,
+// and reports the IDs with no document.
+func MultiGet(opts MultiGetOptions) {
+	if opts.BatchSize < 1 {
+		logFatalf("--batch-size must be positive")
+	}
+	var input io.Reader = os.Stdin
+	if opts.IDsFile != "" {
+		file, err := os.Open(opts.IDsFile)
+		if err != nil {
+			logFatalf("Error opening the IDs file: %s", err)
+		}
+		defer file.Close()
+		input = file
+	}
+	var missing io.Writer
+	if opts.MissingFile != "" {
+		file, err := os.Create(opts.MissingFile)
+		if err != nil {
+			logFatalf("Error creating the missing file: %s", err)
+		}
+		defer file.Close()
+		missing = file
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	encoder := json.NewEncoder(out)
+	found, notFound := 0, 0
+	var batch []string
+	flush := func() {
+		docs, err := multiGet(client, opts, batch)
+		if err != nil {
+			logFatalf("Error getting the documents: %s", err)
+		}
+		for _, doc := range docs {
+			if !doc.Found {
+				notFound++
+				if missing != nil {
+					fmt.Fprintln(missing, doc.ID)
+				} else {
+					logWarnf("Document [%s] not found", doc.ID)
+				}
+				continue
+			}
+			found++
+			if doc.Source == nil {
+				doc.Source = map[string]interface{}{}
+			}
+			if opts.IDField != "" {
+				osdoc.SetField(doc.Source, osdoc.SplitFieldPath(opts.IDField), doc.ID)
+			}
+			if err := encoder.Encode(doc.Source); err != nil {
+				logFatalf("Error writing the documents: %s", err)
+			}
+		}
+		batch = batch[:0]
+	}
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		id := strings.TrimSpace(scanner.Text())
+		if id == "" {
+			continue
+		}
+		batch = append(batch, id)
+		if len(batch) == opts.BatchSize {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		logFatalf("Error reading the IDs: %s", err)
+	}
+	if len(batch) > 0 {
+		flush()
+	}
+	logInfof("Found [%d] documents; [%d] missing", found, notFound)
+}
+
+// mgetDoc is a document in an _mget response.
+type mgetDoc struct {
+	ID     string                 `json:"_id"`
+	Found  bool                   `json:"found"`
+	Source map[string]interface{} `json:"_source"`
+}
+
+// multiGet gets the documents with the given IDs, in the same order.
+func multiGet(client *opensearch.Client, opts MultiGetOptions, ids []string) ([]mgetDoc, error) {
+	body, err := json.Marshal(map[string]interface{}{"ids": ids})
+	if err != nil {
+		return nil, err
+	}
+	res, err := opensearchapi.MgetRequest{
+		Index:   opts.Index,
+		Body:    bytes.NewReader(body),
+		Routing: opts.Routing,
+	}.Do(context.Background(), client)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		return nil, err
+	}
+	var result struct {
+		Docs []mgetDoc `json:"docs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Docs, nil
+}
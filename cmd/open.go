@@ -0,0 +1,78 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// openCmd represents the open command
+var openCmd = &cobra.Command{
+	Use:   "open <index>",
+	Short: "Open a closed index",
+	Long: `Open a closed opensearch index, so it can be searched and written to again.
+	The name may contain wildcards.
+	$ opensearch-doc index open my_index`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		OpenIndex(args[0])
+	},
+}
+
+// closeCmd represents the close command
+var closeCmd = &cobra.Command{
+	Use:   "close <index>",
+	Short: "Close an index",
+	Long: `Close an opensearch index. A closed index keeps its data on disk but can't be
+	searched or written to, and uses almost no cluster resources, until it is opened
+	again. The name may contain wildcards.
+	$ opensearch-doc index close 'logs-2021.*'`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		CloseIndex(args[0])
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(openCmd)
+	indexCmd.AddCommand(closeCmd)
+}
+
+// OpenIndex opens a closed index.
+func OpenIndex(index string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.IndicesOpenRequest{Index: []string{index}}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error opening the index: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error opening the index: %s", err)
+	}
+	fmt.Printf("Opened [%s]\n", index)
+}
+
+// CloseIndex closes an index.
+func CloseIndex(index string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.IndicesCloseRequest{Index: []string{index}}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error closing the index: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error closing the index: %s", err)
+	}
+	fmt.Printf("Closed [%s]\n", index)
+}
@@ -0,0 +1,253 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// pipelineCmd represents the pipeline command
+var pipelineCmd = &cobra.Command{
+	Use:   "pipeline",
+	Short: "Manage and test ingest pipelines",
+	Long: `Manage ingest pipelines, which enrich or reshape documents on the server as they are
+	indexed, and test them with the documents that will later be bulk-loaded with --pipeline.
+	$ opensearch-doc pipeline put geoip --file geoip-pipeline.json
+	$ head -10 docs.json | opensearch-doc pipeline simulate geoip
+	$ opensearch-doc bulk -i my_index -f id --pipeline geoip -F docs.json`,
+}
+
+// pipelinePutCmd represents the pipeline put command
+var pipelinePutCmd = &cobra.Command{
+	Use:   "put <name>",
+	Short: "Create or replace an ingest pipeline from a JSON file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		PutPipeline(args[0], file)
+	},
+}
+
+// pipelineGetCmd represents the pipeline get command
+var pipelineGetCmd = &cobra.Command{
+	Use:   "get <name>",
+	Short: "Show an ingest pipeline, as JSON",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		GetPipeline(args[0])
+	},
+}
+
+// pipelineDeleteCmd represents the pipeline delete command
+var pipelineDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete an ingest pipeline",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		DeletePipeline(args[0])
+	},
+}
+
+// pipelineListCmd represents the pipeline list command
+var pipelineListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List ingest pipelines",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ListPipelines()
+	},
+}
+
+// pipelineSimulateCmd represents the pipeline simulate command
+var pipelineSimulateCmd = &cobra.Command{
+	Use:   "simulate <name>",
+	Short: "Run documents through an ingest pipeline without indexing them",
+	Long: `Run documents, read one JSON object per line from --docs or from stdin, through an
+	ingest pipeline, and print each resulting document, one per line. Documents the pipeline
+	fails on are logged, and the exit status is 3. With --verbose, the whole response is
+	printed, with the result of each processor.
+	$ opensearch-doc pipeline simulate geoip --docs sample.json`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		docs, _ := cmd.Flags().GetString("docs")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		SimulatePipeline(args[0], docs, verbose)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pipelineCmd)
+	pipelineCmd.AddCommand(pipelinePutCmd, pipelineGetCmd, pipelineDeleteCmd, pipelineListCmd, pipelineSimulateCmd)
+
+	pipelinePutCmd.Flags().String("file", "", "A JSON file of the pipeline; - for stdin")
+	pipelinePutCmd.MarkFlagRequired("file")
+	pipelineSimulateCmd.Flags().String("docs", "", "A file of documents, one JSON object per line (default stdin)")
+	pipelineSimulateCmd.Flags().Bool("verbose", false, "Print the result of each processor")
+}
+
+// doPipelineRequest sends an ingest pipeline request, and returns the
+// response if it succeeded.
+func doPipelineRequest(req apiRequest) *opensearchapi.Response {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := req.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error sending the pipeline request: %s", err)
+	}
+	if err := responseError(res); err != nil {
+		res.Body.Close()
+		logFatalf("Error in the pipeline request: %s", err)
+	}
+	return res
+}
+
+// PutPipeline creates or replaces a pipeline from a JSON file.
+func PutPipeline(name string, file string) {
+	pipeline, err := readJSONFile(file, "")
+	if err != nil {
+		logFatalf("Error reading the pipeline: %s", err)
+	}
+	body, err := json.Marshal(pipeline)
+	if err != nil {
+		logFatalf("Error encoding the pipeline: %s", err)
+	}
+	res := doPipelineRequest(opensearchapi.IngestPutPipelineRequest{PipelineID: name, Body: bytes.NewReader(body)})
+	res.Body.Close()
+	fmt.Printf("Put pipeline [%s]\n", name)
+}
+
+// GetPipeline prints a pipeline.
+func GetPipeline(name string) {
+	res := doPipelineRequest(opensearchapi.IngestGetPipelineRequest{PipelineID: name})
+	defer res.Body.Close()
+	// the response is {name: pipeline}
+	var result map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		logFatalf("Error reading the pipeline: %s", err)
+	}
+	if err := printJSON(bytes.NewReader(result[name])); err != nil {
+		logFatalf("Error reading the pipeline: %s", err)
+	}
+}
+
+// DeletePipeline deletes a pipeline.
+func DeletePipeline(name string) {
+	res := doPipelineRequest(opensearchapi.IngestDeletePipelineRequest{PipelineID: name})
+	res.Body.Close()
+	fmt.Printf("Deleted pipeline [%s]\n", name)
+}
+
+// ListPipelines prints the name and description of each pipeline.
+func ListPipelines() {
+	res := doPipelineRequest(opensearchapi.IngestGetPipelineRequest{})
+	defer res.Body.Close()
+	var result map[string]struct {
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		logFatalf("Error reading the pipelines: %s", err)
+	}
+	names := make([]string, 0, len(result))
+	for name := range result {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%s\n", name, result[name].Description)
+	}
+	w.Flush()
+}
+
+// SimulatePipeline runs the documents in a file, or stdin if file is empty,
+// through a pipeline, and prints the results.
+func SimulatePipeline(name string, file string, verbose bool) {
+	var input io.Reader = os.Stdin
+	inputName := "stdin"
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			logFatalf("Error opening the documents: %s", err)
+		}
+		defer f.Close()
+		input, inputName = f, file
+	}
+	var docs []map[string]interface{}
+	var lines []int
+	err := osdoc.ReadJSONLines(input, 100<<20, inputName, func(line int, document map[string]interface{}) error {
+		if document != nil {
+			docs = append(docs, map[string]interface{}{"_source": document})
+			lines = append(lines, line)
+		}
+		return nil
+	})
+	if err != nil {
+		logFatalf("Error reading the documents: %s", err)
+	}
+	if len(docs) == 0 {
+		logFatalf("No documents to simulate")
+	}
+	body, err := json.Marshal(map[string]interface{}{"docs": docs})
+	if err != nil {
+		logFatalf("Error encoding the documents: %s", err)
+	}
+	res := doPipelineRequest(opensearchapi.IngestSimulateRequest{
+		PipelineID: name,
+		Body:       bytes.NewReader(body),
+		Verbose:    &verbose,
+	})
+	defer res.Body.Close()
+	if verbose {
+		if err := printJSON(res.Body); err != nil {
+			logFatalf("Error reading the results: %s", err)
+		}
+		return
+	}
+	var result struct {
+		Docs []struct {
+			Doc struct {
+				Source json.RawMessage `json:"_source"`
+			} `json:"doc"`
+			Error *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		logFatalf("Error reading the results: %s", err)
+	}
+	failed := 0
+	for i, doc := range result.Docs {
+		if doc.Error != nil {
+			logErrorf("%s:%d: %s: %s", inputName, lines[i], doc.Error.Type, doc.Error.Reason)
+			failed++
+			continue
+		}
+		// a document dropped by the pipeline has no source
+		if doc.Doc.Source == nil {
+			continue
+		}
+		var out bytes.Buffer
+		json.Compact(&out, doc.Doc.Source)
+		fmt.Println(out.String())
+	}
+	if failed > 0 {
+		logWarnf("The pipeline failed on [%d] of [%d] documents", failed, len(result.Docs))
+		exit(exitPartialFailure)
+	}
+}
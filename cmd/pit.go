@@ -0,0 +1,201 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// pitCmd represents the pit command
+var pitCmd = &cobra.Command{
+	Use:   "pit",
+	Short: "Open, list, or close points in time",
+	Long: `Open, list, or close points in time, which hold a view of an index for paging through
+	it, as export and copy do. A point in time left open, such as by an export that crashed,
+	keeps its search contexts, and the segments they use, until its keep-alive runs out;
+	list and close free them sooner.
+	$ opensearch-doc pit list
+	$ opensearch-doc pit close --all`,
+}
+
+// pitOpenCmd represents the pit open command
+var pitOpenCmd = &cobra.Command{
+	Use:   "open <index>",
+	Short: "Open a point in time and print its ID",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		keepAlive, _ := cmd.Flags().GetDuration("keep-alive")
+		OpenPIT(args[0], keepAlive)
+	},
+}
+
+// pitListCmd represents the pit list command
+var pitListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the open points in time",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ListPITs()
+	},
+}
+
+// pitCloseCmd represents the pit close command
+var pitCloseCmd = &cobra.Command{
+	Use:   "close [id...]",
+	Short: "Close points in time",
+	Long: `Close the points in time with the given IDs, or all of them with --all.
+	$ opensearch-doc pit close o463QQEPbXktaW5kZXg...
+	$ opensearch-doc pit close --all`,
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+		if all == (len(args) > 0) {
+			logFatalf("give the IDs of the points in time to close, or --all")
+		}
+		ClosePITs(args)
+	},
+}
+
+// scrollCmd represents the scroll command
+var scrollCmd = &cobra.Command{
+	Use:   "scroll",
+	Short: "Clear scroll contexts",
+}
+
+// scrollClearCmd represents the scroll clear command
+var scrollClearCmd = &cobra.Command{
+	Use:   "clear [id...]",
+	Short: "Clear scroll contexts",
+	Long: `Clear the scroll contexts with the given scroll IDs, or all of them with --all, freeing
+	the resources they hold on the cluster until their scroll timeout runs out.
+	$ opensearch-doc scroll clear --all`,
+	Run: func(cmd *cobra.Command, args []string) {
+		all, _ := cmd.Flags().GetBool("all")
+		if all == (len(args) > 0) {
+			logFatalf("give the scroll IDs to clear, or --all")
+		}
+		ClearScrolls(args)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pitCmd)
+	pitCmd.AddCommand(pitOpenCmd, pitListCmd, pitCloseCmd)
+	rootCmd.AddCommand(scrollCmd)
+	scrollCmd.AddCommand(scrollClearCmd)
+
+	pitOpenCmd.Flags().Duration("keep-alive", 5*time.Minute, "How long the point in time is kept without being used")
+	pitCloseCmd.Flags().Bool("all", false, "Close all the points in time")
+	scrollClearCmd.Flags().Bool("all", false, "Clear all the scroll contexts")
+}
+
+// OpenPIT opens a point in time on an index and prints its ID.
+func OpenPIT(index string, keepAlive time.Duration) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	var pit struct {
+		ID string `json:"pit_id"`
+	}
+	path := fmt.Sprintf("/%s/_search/point_in_time?keep_alive=%dms", url.PathEscape(index), keepAlive.Milliseconds())
+	if err := jsonRequest(context.Background(), client, http.MethodPost, path, nil, &pit); err != nil {
+		logFatalf("Error opening a point in time: %s", err)
+	}
+	fmt.Println(pit.ID)
+}
+
+// ListPITs prints a table of the open points in time, oldest first.
+func ListPITs() {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	var result struct {
+		PITs []struct {
+			ID        string `json:"pit_id"`
+			Created   int64  `json:"creation_time"`
+			KeepAlive int64  `json:"keep_alive"`
+		} `json:"pits"`
+	}
+	if err := jsonRequest(context.Background(), client, http.MethodGet, "/_search/point_in_time/_all", nil, &result); err != nil {
+		logFatalf("Error listing the points in time: %s", err)
+	}
+	pits := result.PITs
+	sort.Slice(pits, func(i, j int) bool { return pits[i].Created < pits[j].Created })
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CREATED\tAGE\tKEEP ALIVE\tPIT ID")
+	for _, pit := range pits {
+		created := time.UnixMilli(pit.Created)
+		age := time.Since(created).Truncate(time.Second)
+		keepAlive := time.Duration(pit.KeepAlive) * time.Millisecond
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", created.UTC().Format(time.RFC3339), age, keepAlive, pit.ID)
+	}
+	w.Flush()
+}
+
+// ClosePITs closes the points in time with the IDs, or all of them if
+// there are none.
+func ClosePITs(ids []string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	var result struct {
+		PITs []struct {
+			ID         string `json:"pit_id"`
+			Successful bool   `json:"successful"`
+		} `json:"pits"`
+	}
+	if len(ids) == 0 {
+		err = jsonRequest(context.Background(), client, http.MethodDelete, "/_search/point_in_time/_all", nil, &result)
+	} else {
+		err = jsonRequest(context.Background(), client, http.MethodDelete, "/_search/point_in_time", map[string]interface{}{"pit_id": ids}, &result)
+	}
+	if err != nil {
+		logFatalf("Error closing the points in time: %s", err)
+	}
+	closed := 0
+	for _, pit := range result.PITs {
+		if pit.Successful {
+			closed++
+		} else {
+			logWarnf("Couldn't close the point in time [%s]", pit.ID)
+		}
+	}
+	fmt.Printf("Closed [%d] points in time\n", closed)
+	if closed < len(result.PITs) {
+		exit(1)
+	}
+}
+
+// ClearScrolls clears the scroll contexts with the IDs, or all of them if
+// there are none.
+func ClearScrolls(ids []string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	var result struct {
+		Succeeded bool `json:"succeeded"`
+		NumFreed  int  `json:"num_freed"`
+	}
+	if len(ids) == 0 {
+		err = jsonRequest(context.Background(), client, http.MethodDelete, "/_search/scroll/_all", nil, &result)
+	} else {
+		err = jsonRequest(context.Background(), client, http.MethodDelete, "/_search/scroll", map[string]interface{}{"scroll_id": ids}, &result)
+	}
+	if err != nil {
+		logFatalf("Error clearing the scroll contexts: %s", err)
+	}
+	fmt.Printf("Freed [%d] search contexts\n", result.NumFreed)
+}
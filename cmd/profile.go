@@ -0,0 +1,146 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// searchProfile is the profile section of a search response.
+type searchProfile struct {
+	Shards []struct {
+		ID       string `json:"id"`
+		Searches []struct {
+			Query       []profiledQuery     `json:"query"`
+			RewriteTime int64               `json:"rewrite_time"`
+			Collector   []profiledCollector `json:"collector"`
+		} `json:"searches"`
+		Aggregations []profiledQuery `json:"aggregations"`
+	} `json:"shards"`
+}
+
+// profiledQuery is the timing of a query, or of an aggregation, and of the
+// queries or aggregations it is made of.
+type profiledQuery struct {
+	Type        string           `json:"type"`
+	Description string           `json:"description"`
+	TimeInNanos int64            `json:"time_in_nanos"`
+	Breakdown   map[string]int64 `json:"breakdown"`
+	Children    []profiledQuery  `json:"children"`
+}
+
+// profiledCollector is the timing of a collector, and of those it wraps.
+type profiledCollector struct {
+	Name        string              `json:"name"`
+	Reason      string              `json:"reason"`
+	TimeInNanos int64               `json:"time_in_nanos"`
+	Children    []profiledCollector `json:"children"`
+}
+
+// maxProfileDescription is the longest query description shown; those of
+// large boolean queries run on for pages.
+const maxProfileDescription = 60
+
+// writeProfile writes a readable breakdown of a search profile: for each
+// shard, the time of each query and its parts, with where the time of each
+// went, the rewrite time, and the time of each collector and aggregation.
+func writeProfile(w io.Writer, raw json.RawMessage) error {
+	var profile searchProfile
+	if err := json.Unmarshal(raw, &profile); err != nil {
+		return err
+	}
+	shards := profile.Shards
+	sort.Slice(shards, func(i, j int) bool { return shards[i].ID < shards[j].ID })
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, shard := range shards {
+		fmt.Fprintf(tw, "Shard %s\n", shard.ID)
+		fmt.Fprintln(tw, "  TYPE\tTIME\tBREAKDOWN\tDESCRIPTION")
+		for _, search := range shard.Searches {
+			for _, query := range search.Query {
+				writeProfiledQuery(tw, query, 1)
+			}
+			fmt.Fprintf(tw, "  rewrite\t%s\t\t\n", formatNanos(search.RewriteTime))
+			for _, collector := range search.Collector {
+				writeProfiledCollector(tw, collector, 1)
+			}
+		}
+		for _, agg := range shard.Aggregations {
+			writeProfiledQuery(tw, agg, 1)
+		}
+	}
+	return tw.Flush()
+}
+
+// writeProfiledQuery writes a row for a query, and those for its children,
+// indented by depth.
+func writeProfiledQuery(w io.Writer, query profiledQuery, depth int) {
+	fmt.Fprintf(w, "%s%s\t%s\t%s\t%s\n", strings.Repeat("  ", depth), query.Type,
+		formatNanos(query.TimeInNanos), profileBreakdown(query.Breakdown), shorten(query.Description, maxProfileDescription))
+	for _, child := range query.Children {
+		writeProfiledQuery(w, child, depth+1)
+	}
+}
+
+// writeProfiledCollector writes a row for a collector, and those for the
+// collectors it wraps, indented by depth.
+func writeProfiledCollector(w io.Writer, collector profiledCollector, depth int) {
+	fmt.Fprintf(w, "%s%s\t%s\t\t%s\n", strings.Repeat("  ", depth), collector.Name,
+		formatNanos(collector.TimeInNanos), collector.Reason)
+	for _, child := range collector.Children {
+		writeProfiledCollector(w, child, depth+1)
+	}
+}
+
+// profileBreakdown summarizes where the time of a query went: its three
+// longest parts, such as score or build_scorer, as percentages.
+func profileBreakdown(breakdown map[string]int64) string {
+	var total int64
+	var parts []string
+	for part, nanos := range breakdown {
+		// the breakdown also counts the calls of each part
+		if strings.HasSuffix(part, "_count") || nanos == 0 {
+			continue
+		}
+		total += nanos
+		parts = append(parts, part)
+	}
+	sort.Slice(parts, func(i, j int) bool {
+		if breakdown[parts[i]] != breakdown[parts[j]] {
+			return breakdown[parts[i]] > breakdown[parts[j]]
+		}
+		return parts[i] < parts[j]
+	})
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	for i, part := range parts {
+		parts[i] = fmt.Sprintf("%s %d%%", part, breakdown[part]*100/total)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatNanos formats a time in nanoseconds, to the microsecond once it is
+// a millisecond or more.
+func formatNanos(nanos int64) string {
+	d := time.Duration(nanos)
+	if d >= time.Millisecond {
+		d = d.Round(time.Microsecond)
+	}
+	return d.String()
+}
+
+// shorten cuts s to at most n runes, marking that it was cut.
+func shorten(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
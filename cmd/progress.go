@@ -0,0 +1,131 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+	"golang.org/x/term"
+)
+
+// progress reports the throughput of a bulk load on stderr. A nil
+// *progress reports nothing.
+type progress struct {
+	start time.Time
+	total int64 // The size of the input in bytes, or 0 if unknown
+	read  int64 // Bytes read so far, updated atomically
+	stats func() osdoc.Stats
+
+	// On a terminal, each report overwrites the last one.
+	terminal bool
+}
+
+func newProgress(total int64, stats func() osdoc.Stats) *progress {
+	return &progress{
+		start:    time.Now(),
+		total:    total,
+		stats:    stats,
+		terminal: term.IsTerminal(int(os.Stderr.Fd())),
+	}
+}
+
+// reader counts the bytes read from r toward the progress.
+func (p *progress) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &countingReader{r: r, n: &p.read}
+}
+
+// reportEvery reports progress at each interval until the returned
+// function is called, which makes a final report.
+func (p *progress) reportEvery(interval time.Duration) (stop func()) {
+	if p == nil {
+		return func() {}
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				p.report()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		p.report()
+		if p.terminal {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+func (p *progress) report() {
+	stats := p.stats()
+	elapsed := time.Since(p.start).Seconds()
+	read := atomic.LoadInt64(&p.read)
+	line := fmt.Sprintf("%d docs (%.0f docs/s), %.1f MB (%.2f MB/s), %d errors",
+		stats.Flushed, float64(stats.Flushed)/elapsed,
+		float64(read)/1e6, float64(read)/1e6/elapsed, stats.Failed)
+	if p.total > 0 && read > 0 {
+		remaining := time.Duration(float64(p.total-read) / float64(read) * elapsed * float64(time.Second))
+		line += fmt.Sprintf(", %.0f%%, ETA %s", 100*float64(read)/float64(p.total), remaining.Round(time.Second))
+	}
+	if p.terminal {
+		fmt.Fprintf(os.Stderr, "\r\033[K%s", line)
+	} else {
+		fmt.Fprintln(os.Stderr, line)
+	}
+}
+
+// countingReader adds the number of bytes read to n.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(c.n, int64(n))
+	return n, err
+}
+
+// inputSize returns the total size of the named inputs, or of stdin if
+// there are none, or 0 if the size can't be known, as for URLs.
+func inputSize(inputs []string) int64 {
+	files := []*os.File{os.Stdin}
+	if len(inputs) > 0 {
+		files = nil
+	}
+	var total int64
+	for _, name := range osdoc.ExpandGlobs(inputs) {
+		if isURL(name) || strings.HasPrefix(name, "s3://") {
+			return 0
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+		total += info.Size()
+	}
+	for _, file := range files {
+		info, err := file.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0
+		}
+		total += info.Size()
+	}
+	return total
+}
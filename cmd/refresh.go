@@ -0,0 +1,50 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// refreshCmd represents the refresh command
+var refreshCmd = &cobra.Command{
+	Use:   "refresh <index>",
+	Short: "Refresh an index",
+	Long: `Refresh an opensearch index, making the documents added to it since the last
+	refresh searchable. The name may contain wildcards.
+	$ opensearch-doc index refresh my_index`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		RefreshIndex(args[0])
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(refreshCmd)
+}
+
+// RefreshIndex refreshes an index.
+func RefreshIndex(index string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.IndicesRefreshRequest{Index: []string{index}}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error refreshing the index: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error refreshing the index: %s", err)
+	}
+	shards, err := readShardResults(res.Body)
+	if err != nil {
+		logFatalf("Error reading the response: %s", err)
+	}
+	fmt.Printf("Refreshed [%s] on [%d] of [%d] shards\n", index, shards.Successful, shards.Total)
+}
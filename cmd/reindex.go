@@ -0,0 +1,170 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// reindexCmd represents the reindex command
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Copy documents from one index to another",
+	Long: `Copy the documents of one or more indices into another with the _reindex API, for
+	example to change a mapping, which needs a new index. The copy runs in the cluster as a
+	task, whose progress is reported until it finishes; interrupting the command doesn't
+	stop the task.
+
+	--source may list several indices separated by commas. With --query, only the documents
+	matching the query in a JSON file (which may wrap it in a "query" key) are copied.
+	$ opensearch-doc reindex --source products-v1 --dest products-v2 --query in-stock.json
+
+	To copy from another cluster, give its URL with --remote-url, and its credentials
+	with --remote-user and --remote-password. The destination cluster must list the remote
+	host in its reindex.remote.allowlist setting.
+	$ opensearch-doc reindex --source logs --dest logs --remote-url https://old-cluster:9200 --remote-user admin`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		source, _ := cmd.Flags().GetString("source")
+		dest, _ := cmd.Flags().GetString("dest")
+		query, _ := cmd.Flags().GetString("query")
+		remoteURL, _ := cmd.Flags().GetString("remote-url")
+		remoteUser, _ := cmd.Flags().GetString("remote-user")
+		remotePassword, _ := cmd.Flags().GetString("remote-password")
+		slices, _ := cmd.Flags().GetInt("slices")
+		requestsPerSecond, _ := cmd.Flags().GetInt("requests-per-second")
+		pollInterval, _ := cmd.Flags().GetDuration("poll-interval")
+		Reindex(ReindexOptions{
+			Source:            source,
+			Dest:              dest,
+			Query:             query,
+			RemoteURL:         remoteURL,
+			RemoteUser:        remoteUser,
+			RemotePassword:    remotePassword,
+			Slices:            slices,
+			RequestsPerSecond: requestsPerSecond,
+			PollInterval:      pollInterval,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reindexCmd)
+
+	reindexCmd.Flags().String("source", "", "The index (or comma-separated indices) to copy from")
+	reindexCmd.Flags().String("dest", "", "The index to copy to")
+	reindexCmd.Flags().String("query", "", "A JSON file of a query selecting the documents to copy")
+	reindexCmd.Flags().String("remote-url", "", "The URL of a remote cluster to copy from")
+	reindexCmd.Flags().String("remote-user", "", "The username for the remote cluster")
+	reindexCmd.Flags().String("remote-password", "", "The password for the remote cluster; prompted for if not set")
+	reindexCmd.Flags().Int("slices", 1, "The number of slices to split the copy into, to run in parallel")
+	reindexCmd.Flags().Int("requests-per-second", 0, "The most batches to copy per second; 0 for no limit")
+	reindexCmd.Flags().Duration("poll-interval", 5*time.Second, "How often to report the progress of the copy")
+	reindexCmd.MarkFlagRequired("source")
+	reindexCmd.MarkFlagRequired("dest")
+}
+
+// ReindexOptions holds the settings for a reindex.
+type ReindexOptions struct {
+	Source string // The indices to copy from, separated by commas
+	Dest   string // The index to copy to
+	Query  string // A JSON file of a query selecting the documents
+
+	RemoteURL      string // The URL of a remote cluster to copy from
+	RemoteUser     string // The username for the remote cluster
+	RemotePassword string // The password for the remote cluster
+
+	Slices            int           // The number of slices to run in parallel
+	RequestsPerSecond int           // The most batches per second, if positive
+	PollInterval      time.Duration // How often to report progress
+}
+
+// Reindex copies documents from one index to another, waiting for the copy
+// to finish.
+func Reindex(opts ReindexOptions) {
+	body, err := reindexBody(opts)
+	if err != nil {
+		logFatalf("%s", err)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	wait := false
+	req := opensearchapi.ReindexRequest{
+		Body:              bytes.NewReader(body),
+		WaitForCompletion: &wait,
+		Slices:            opts.Slices,
+	}
+	if opts.RequestsPerSecond > 0 {
+		req.RequestsPerSecond = &opts.RequestsPerSecond
+	}
+	res, err := req.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error starting the reindex: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error starting the reindex: %s", err)
+	}
+	var started struct {
+		Task string `json:"task"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&started); err != nil {
+		logFatalf("Error reading the response: %s", err)
+	}
+	logInfof("Started reindex task [%s]", started.Task)
+	status, failures, err := waitForTask(client, started.Task, opts.PollInterval)
+	if err != nil {
+		logFatalf("Error in reindex task [%s]: %s", started.Task, err)
+	}
+	for _, failure := range failures {
+		logErrorf("Error copying a document: %s", failure)
+	}
+	fmt.Printf("Reindexed [%d] documents from [%s] to [%s]: [%d] created, [%d] updated, [%d] conflicts, [%d] failures\n",
+		status.Created+status.Updated, opts.Source, opts.Dest, status.Created, status.Updated, status.VersionConflicts, len(failures))
+	if len(failures) > 0 {
+		exit(exitPartialFailure)
+	}
+}
+
+// reindexBody builds the body of a reindex request.
+func reindexBody(opts ReindexOptions) ([]byte, error) {
+	source := map[string]interface{}{"index": strings.Split(opts.Source, ",")}
+	if opts.Query != "" {
+		query, err := readJSONFile(opts.Query, "query")
+		if err != nil {
+			return nil, fmt.Errorf("reading the query: %w", err)
+		}
+		source["query"] = query
+	}
+	if opts.RemoteURL != "" {
+		remote := map[string]interface{}{"host": opts.RemoteURL}
+		if opts.RemoteUser != "" {
+			password := opts.RemotePassword
+			if password == "" {
+				var err error
+				password, err = promptPassword(opts.RemoteUser)
+				if err != nil {
+					return nil, fmt.Errorf("a password is required for --remote-user; set --remote-password")
+				}
+			}
+			remote["username"] = opts.RemoteUser
+			remote["password"] = password
+		}
+		source["remote"] = remote
+	}
+	return json.Marshal(map[string]interface{}{
+		"source": source,
+		"dest":   map[string]interface{}{"index": opts.Dest},
+	})
+}
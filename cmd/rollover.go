@@ -0,0 +1,125 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// rolloverCmd represents the rollover command
+var rolloverCmd = &cobra.Command{
+	Use:   "rollover <alias>",
+	Short: "Roll a write alias over to a new index",
+	Long: `Roll a write alias over to a new index, if its current index meets any of the
+	conditions: --max-size (such as 50gb), --max-age (such as 7d), or --max-docs. Without
+	conditions, it is rolled over unconditionally. The new index is named by incrementing
+	the number at the end of the old one, unless --new-index is given. With --dry-run,
+	the conditions are checked and reported but nothing is changed.
+	$ opensearch-doc index rollover logs --max-size 50gb --max-age 7d --max-docs 100000000`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		newIndex, _ := cmd.Flags().GetString("new-index")
+		maxSize, _ := cmd.Flags().GetString("max-size")
+		maxAge, _ := cmd.Flags().GetString("max-age")
+		maxDocs, _ := cmd.Flags().GetInt64("max-docs")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		Rollover(RolloverOptions{
+			Alias:    args[0],
+			NewIndex: newIndex,
+			MaxSize:  maxSize,
+			MaxAge:   maxAge,
+			MaxDocs:  maxDocs,
+			DryRun:   dryRun,
+		})
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(rolloverCmd)
+
+	rolloverCmd.Flags().String("new-index", "", "The name of the new index (default the old name, incremented)")
+	rolloverCmd.Flags().String("max-size", "", "Roll over once the primary shards hold this much, e.g. 50gb")
+	rolloverCmd.Flags().String("max-age", "", "Roll over once the index is this old, e.g. 7d")
+	rolloverCmd.Flags().Int64("max-docs", 0, "Roll over once the index holds this many documents")
+	rolloverCmd.Flags().Bool("dry-run", false, "Check the conditions without rolling over")
+}
+
+// RolloverOptions holds the settings for rolling an alias over.
+type RolloverOptions struct {
+	Alias    string // The write alias
+	NewIndex string // The name of the new index, if not the default
+	MaxSize  string // The size condition, if not empty
+	MaxAge   string // The age condition, if not empty
+	MaxDocs  int64  // The document count condition, if positive
+	DryRun   bool   // Only check the conditions
+}
+
+// Rollover rolls an alias over to a new index if it meets the conditions.
+func Rollover(opts RolloverOptions) {
+	conditions := map[string]interface{}{}
+	if opts.MaxSize != "" {
+		conditions["max_size"] = opts.MaxSize
+	}
+	if opts.MaxAge != "" {
+		conditions["max_age"] = opts.MaxAge
+	}
+	if opts.MaxDocs > 0 {
+		conditions["max_docs"] = opts.MaxDocs
+	}
+	body, err := json.Marshal(map[string]interface{}{"conditions": conditions})
+	if err != nil {
+		logFatalf("Error encoding the conditions: %s", err)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.IndicesRolloverRequest{
+		Alias:    opts.Alias,
+		NewIndex: opts.NewIndex,
+		Body:     bytes.NewReader(body),
+		DryRun:   &opts.DryRun,
+	}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error rolling over the alias: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error rolling over the alias: %s", err)
+	}
+	var result struct {
+		OldIndex   string          `json:"old_index"`
+		NewIndex   string          `json:"new_index"`
+		RolledOver bool            `json:"rolled_over"`
+		Conditions map[string]bool `json:"conditions"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		logFatalf("Error reading the response: %s", err)
+	}
+	// conditions are reported as {"[max_docs: 100]": true}
+	var met []string
+	for condition, ok := range result.Conditions {
+		if ok {
+			met = append(met, condition)
+		}
+	}
+	sort.Strings(met)
+	switch {
+	case opts.DryRun && (len(met) > 0 || len(conditions) == 0):
+		fmt.Printf("Would roll [%s] over from [%s] to [%s]; conditions met: %v\n", opts.Alias, result.OldIndex, result.NewIndex, met)
+	case opts.DryRun:
+		fmt.Printf("Would not roll [%s] over from [%s]; no conditions met\n", opts.Alias, result.OldIndex)
+	case result.RolledOver:
+		fmt.Printf("Rolled [%s] over from [%s] to [%s]; conditions met: %v\n", opts.Alias, result.OldIndex, result.NewIndex, met)
+	default:
+		fmt.Printf("Did not roll [%s] over from [%s]; no conditions met\n", opts.Alias, result.OldIndex)
+	}
+}
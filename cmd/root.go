@@ -4,8 +4,9 @@ Copyright © 2022 Will Fitzgerald <willf@github.com>
 package cmd
 
 import (
-	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -18,17 +19,33 @@ var rootCmd = &cobra.Command{
 	Use:   "opensearch-doc",
 	Short: "A command line interface for managing documents in opensearch indexes",
 	Long:  `A command line interface for managing documents in opensearch indexes`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// the command's span is named for it, so tracing starts here
+		// rather than in initConfig
+		if endpoint := viper.GetString("otlp-endpoint"); endpoint != "" {
+			startTracing(endpoint, cmd.CommandPath())
+		}
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
 	err := rootCmd.Execute()
+	stopTracing()
 	if err != nil {
 		os.Exit(1)
 	}
 }
 
+// exit exports the trace spans not yet exported, if traces are being
+// exported, and exits with the code. Commands exit with it rather than
+// os.Exit, which would drop them.
+func exit(code int) {
+	stopTracing()
+	os.Exit(code)
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
 
@@ -37,6 +54,37 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.opensearch-doc.yaml)")
+	rootCmd.PersistentFlags().StringSlice("url", []string{"http://localhost:9200"}, "The OpenSearch URL; may be repeated or comma-separated for several nodes (env OPENSEARCH_URL)")
+	rootCmd.PersistentFlags().Bool("sniff", false, "Discover the cluster's other nodes and spread requests across them")
+	rootCmd.PersistentFlags().Duration("sniff-interval", 5*time.Minute, "How often to rediscover nodes with --sniff")
+	rootCmd.PersistentFlags().String("username", "", "The username for basic authentication (env OPENSEARCH_USERNAME)")
+	rootCmd.PersistentFlags().String("password", "", "The password for basic authentication (env OPENSEARCH_PASSWORD); prompted for if not set")
+	rootCmd.PersistentFlags().String("api-key", "", "A base64-encoded API key (env OPENSEARCH_API_KEY)")
+	rootCmd.PersistentFlags().Bool("aws-sigv4", false, "Sign requests with AWS SigV4 for Amazon OpenSearch Service (env OPENSEARCH_AWS_SIGV4)")
+	rootCmd.PersistentFlags().String("aws-region", "", "The AWS region for --aws-sigv4 (default from the AWS environment)")
+	rootCmd.PersistentFlags().String("aws-profile", "", "The AWS shared config profile for --aws-sigv4")
+	rootCmd.PersistentFlags().String("aws-role-arn", "", "An IAM role to assume for --aws-sigv4")
+	rootCmd.PersistentFlags().String("aws-service", "es", "The AWS service to sign for: es, or aoss for OpenSearch Serverless")
+	rootCmd.PersistentFlags().String("ca-cert", "", "A PEM file of CA certificates to trust (env OPENSEARCH_CA_CERT)")
+	rootCmd.PersistentFlags().String("client-cert", "", "A PEM client certificate for mutual TLS (env OPENSEARCH_CLIENT_CERT)")
+	rootCmd.PersistentFlags().String("client-key", "", "The PEM private key for --client-cert (env OPENSEARCH_CLIENT_KEY)")
+	rootCmd.PersistentFlags().Bool("insecure", false, "Skip TLS certificate verification (env OPENSEARCH_INSECURE)")
+	rootCmd.PersistentFlags().Bool("compress", false, "Gzip request bodies, such as bulk payloads")
+	rootCmd.PersistentFlags().Int("max-retries", 5, "The most times to retry a failed request; 0 to disable retries")
+	rootCmd.PersistentFlags().IntSlice("retry-on-status", []int{502, 503, 504, 429}, "The HTTP statuses to retry a request on")
+	rootCmd.PersistentFlags().Duration("retry-backoff", 100*time.Millisecond, "The base delay before retrying; it doubles, with jitter, on each retry")
+	rootCmd.PersistentFlags().String("log-level", "info", "The least severe messages to log: debug, info, warn, or error")
+	rootCmd.PersistentFlags().String("log-format", "text", "The log format: text, or json for one JSON object per line")
+	rootCmd.PersistentFlags().String("log-file", "", "A file to append log messages to instead of stderr")
+	rootCmd.PersistentFlags().String("metrics-addr", "", "An address, such as :9090, to serve Prometheus metrics on at /metrics while the command runs")
+	rootCmd.PersistentFlags().String("otlp-endpoint", "", "An OTLP/HTTP collector, such as http://localhost:4318, to export traces of bulk and search requests to")
+	for _, name := range []string{"url", "sniff", "sniff-interval", "username", "password", "api-key",
+		"aws-sigv4", "aws-region", "aws-profile", "aws-role-arn", "aws-service",
+		"ca-cert", "client-cert", "client-key", "insecure",
+		"compress", "max-retries", "retry-on-status", "retry-backoff",
+		"log-level", "log-format", "log-file", "metrics-addr", "otlp-endpoint"} {
+		viper.BindPFlag(name, rootCmd.PersistentFlags().Lookup(name))
+	}
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -59,10 +107,20 @@ func initConfig() {
 		viper.SetConfigName(".opensearch-doc")
 	}
 
+	// Connection settings can be given as OPENSEARCH_* environment variables,
+	// e.g. OPENSEARCH_URL for --url.
+	viper.SetEnvPrefix("opensearch")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	configErr := viper.ReadInConfig()
+
+	cobra.CheckErr(setupLogging(viper.GetString("log-level"), viper.GetString("log-format"), viper.GetString("log-file")))
+	if configErr == nil {
+		logInfof("Using config file: %s", viper.ConfigFileUsed())
+	}
+	if addr := viper.GetString("metrics-addr"); addr != "" {
+		cobra.CheckErr(serveMetrics(addr))
 	}
 }
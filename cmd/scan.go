@@ -0,0 +1,107 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go"
+)
+
+// searchHit is a document found by a search.
+type searchHit struct {
+	Index  string                 `json:"_index"`
+	ID     string                 `json:"_id"`
+	Source map[string]interface{} `json:"_source"`
+	Sort   []interface{}          `json:"sort"`
+}
+
+// scanOptions holds the settings for reading every document of an index.
+type scanOptions struct {
+	Index     string                 // The index to read
+	Query     map[string]interface{} // The query documents must match; all of them if nil
+	Fields    []string               // The source fields to read; all of them if empty
+	Sort      string                 // A field unique to each document, to page by
+	PageSize  int                    // The number of documents to read in each request
+	KeepAlive time.Duration          // How long the point in time is kept between requests
+}
+
+// scanIndex calls fn with each document of an index matching a query, in
+// the order of the sort field. The documents are read a page at a time
+// from a point in time, so changes made to the index during the scan
+// aren't seen, and each page starts after the last document of the one
+// before (search_after), so no more than a page is held at once. The
+// requests are made with ctx. It stops and returns the error if fn returns
+// one.
+func scanIndex(ctx context.Context, client *opensearch.Client, opts scanOptions, fn func(hit searchHit) error) error {
+	keepAlive := fmt.Sprintf("%dms", opts.KeepAlive.Milliseconds())
+	var pit struct {
+		ID string `json:"pit_id"`
+	}
+	path := fmt.Sprintf("/%s/_search/point_in_time?keep_alive=%s", url.PathEscape(opts.Index), keepAlive)
+	if err := jsonRequest(ctx, client, http.MethodPost, path, nil, &pit); err != nil {
+		return fmt.Errorf("creating a point in time: %w", err)
+	}
+	defer func() {
+		body := map[string]interface{}{"pit_id": []string{pit.ID}}
+		if err := jsonRequest(context.Background(), client, http.MethodDelete, "/_search/point_in_time", body, nil); err != nil {
+			logWarnf("Error deleting the point in time: %s", err)
+		}
+	}()
+	query := opts.Query
+	if query == nil {
+		query = map[string]interface{}{"match_all": map[string]interface{}{}}
+	}
+	var after []interface{}
+	for {
+		body := map[string]interface{}{
+			"size":  opts.PageSize,
+			"query": query,
+			"pit":   map[string]interface{}{"id": pit.ID, "keep_alive": keepAlive},
+			"sort":  []interface{}{map[string]interface{}{opts.Sort: "asc"}},
+		}
+		if len(opts.Fields) > 0 {
+			body["_source"] = opts.Fields
+		}
+		if after != nil {
+			body["search_after"] = after
+		} else {
+			// the total is only counted once, for the metrics
+			body["track_total_hits"] = true
+		}
+		var page struct {
+			PitID string `json:"pit_id"`
+			Hits  struct {
+				Total struct {
+					Value int64 `json:"value"`
+				} `json:"total"`
+				Hits []searchHit `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := jsonRequest(ctx, client, http.MethodPost, "/_search", body, &page); err != nil {
+			return err
+		}
+		// the point in time's ID may change from page to page
+		if page.PitID != "" {
+			pit.ID = page.PitID
+		}
+		if after == nil {
+			scanTotal.Add(page.Hits.Total.Value)
+		}
+		for _, hit := range page.Hits.Hits {
+			scanRead.Add(1)
+			if err := fn(hit); err != nil {
+				return err
+			}
+		}
+		if len(page.Hits.Hits) < opts.PageSize {
+			return nil
+		}
+		after = page.Hits.Hits[len(page.Hits.Hits)-1].Sort
+	}
+}
@@ -0,0 +1,302 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// searchCmd represents the search command
+var searchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Search an index",
+	Long: `Search an index and write the hits to stdout, one JSON object per line, with their
+	_index, _id, _score, and _source. The number of hits found is logged on stderr.
+
+	The query is read as JSON from a file with --query, or from stdin with --query -. The
+	file may hold just the query, or a whole search body with a "query" key, such as one
+	with aggregations. For quick searches, --q takes a query string instead:
+	$ opensearch-doc search -i my_index --q 'title:foo AND status:active' --size 20
+	$ echo '{"match": {"title": "foo"}}' | opensearch-doc search -i my_index --query -
+
+	--size and --from page through the hits, --sort orders them by fields, as in
+	--sort date:desc,_score, and --source-includes limits the fields of each _source.
+
+	With --format table or --format csv, each hit is a row, with a column for each field of
+	the hits, nested fields named by dotted paths. --columns picks the columns instead, from
+	the _source fields and _id, _index, and _score:
+	$ opensearch-doc search -i users --q 'status:active' --format table --columns _id,name,address.city
+
+	For semantic search with the neural-search plugin, --query-text is embedded by the ML
+	Commons model --model-id, and the --neural-k nearest documents are found in the vector
+	field --neural-field (which is left out of the hits, unless --source-includes asks for it):
+	$ opensearch-doc search -i passages --neural-field passage_embedding --model-id aVeif4oB5Vm0Tdw8zYO2 --query-text "wild west"
+
+	With --template, the search is made by a stored search template (see search-template),
+	filled in with the parameters in the JSON file --params; the template decides the size,
+	sort, and fields of the hits:
+	$ opensearch-doc search -i products --template product-search --params params.json --format table
+
+	With --profile, the search is profiled, and a breakdown of where its time went is written
+	to stderr after the hits: for each shard, the time of each query and of the queries it is
+	made of, with the parts of it that took longest, the rewrite time, and the time of each
+	collector and aggregation:
+	$ opensearch-doc search -i logs --query slow-query.json --size 0 --profile`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, _ := cmd.Flags().GetString("index")
+		query, _ := cmd.Flags().GetString("query")
+		q, _ := cmd.Flags().GetString("q")
+		size, _ := cmd.Flags().GetInt("size")
+		from, _ := cmd.Flags().GetInt("from")
+		sort, _ := cmd.Flags().GetStringSlice("sort")
+		sourceIncludes, _ := cmd.Flags().GetStringSlice("source-includes")
+		format, _ := cmd.Flags().GetString("format")
+		columns, _ := cmd.Flags().GetStringSlice("columns")
+		neuralField, _ := cmd.Flags().GetString("neural-field")
+		modelID, _ := cmd.Flags().GetString("model-id")
+		queryText, _ := cmd.Flags().GetString("query-text")
+		neuralK, _ := cmd.Flags().GetInt("neural-k")
+		template, _ := cmd.Flags().GetString("template")
+		params, _ := cmd.Flags().GetString("params")
+		profile, _ := cmd.Flags().GetBool("profile")
+		if !cmd.Flags().Changed("neural-k") {
+			neuralK = size
+		}
+		Search(SearchOptions{
+			Index:          index,
+			Query:          query,
+			Q:              q,
+			Size:           size,
+			From:           from,
+			Sort:           sort,
+			SourceIncludes: sourceIncludes,
+			Format:         format,
+			Columns:        columns,
+			NeuralField:    neuralField,
+			ModelID:        modelID,
+			QueryText:      queryText,
+			NeuralK:        neuralK,
+			Template:       template,
+			Params:         params,
+			Profile:        profile,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+
+	searchCmd.Flags().StringP("index", "i", "", "The index (or comma-separated indices or wildcard) to search")
+	searchCmd.Flags().String("query", "", "A JSON file of the query or search body; - for stdin")
+	searchCmd.Flags().String("q", "", "A query string, as in 'title:foo AND status:active'")
+	searchCmd.Flags().Int("size", 10, "The number of hits to return")
+	searchCmd.Flags().Int("from", 0, "The number of hits to skip")
+	searchCmd.Flags().StringSlice("sort", nil, "Fields to sort by, as field:asc or field:desc, separated by commas")
+	searchCmd.Flags().StringSlice("source-includes", nil, "The source fields to return, separated by commas")
+	searchCmd.Flags().String("format", "json", "The output format: json, table, or csv")
+	searchCmd.Flags().StringSlice("columns", nil, "The fields to show as columns with --format table or csv, separated by commas")
+	searchCmd.Flags().String("neural-field", "", "The vector field of a neural search")
+	searchCmd.Flags().String("model-id", "", "The ID of the ML Commons model that embeds --query-text")
+	searchCmd.Flags().String("query-text", "", "The text of a neural search")
+	searchCmd.Flags().Int("neural-k", 0, "The number of nearest documents a neural search finds (default --size)")
+	searchCmd.Flags().String("template", "", "A stored search template to search with")
+	searchCmd.Flags().String("params", "", "A JSON file of the parameters of the --template; - for stdin")
+	searchCmd.Flags().Bool("profile", false, "Profile the search, and write a breakdown of its timings to stderr")
+	searchCmd.MarkFlagRequired("index")
+	searchCmd.MarkFlagsRequiredTogether("neural-field", "model-id", "query-text")
+	searchCmd.MarkFlagsMutuallyExclusive("query-text", "query")
+	searchCmd.MarkFlagsMutuallyExclusive("query-text", "q")
+	searchCmd.MarkFlagsMutuallyExclusive("template", "query")
+	searchCmd.MarkFlagsMutuallyExclusive("template", "q")
+	searchCmd.MarkFlagsMutuallyExclusive("template", "query-text")
+}
+
+// SearchOptions holds the settings for a search.
+type SearchOptions struct {
+	Index          string   // The index to search
+	Query          string   // A JSON file of the query or search body, or - for stdin
+	Q              string   // A query string
+	Size           int      // The number of hits to return
+	From           int      // The number of hits to skip
+	Sort           []string // field:order sorts
+	SourceIncludes []string // The source fields to return
+
+	Format  string   // json, table, or csv
+	Columns []string // The fields to show as table or CSV columns
+
+	NeuralField string // The vector field of a neural search
+	ModelID     string // The ML Commons model that embeds QueryText
+	QueryText   string // The text of a neural search
+	NeuralK     int    // The number of nearest documents a neural search finds
+
+	Template string // A stored search template to search with
+	Params   string // A JSON file of the parameters of the Template
+
+	Profile bool // Profile the search, and write a breakdown of its timings to stderr
+}
+
+// Search searches an index and prints the hits as NDJSON.
+func Search(opts SearchOptions) {
+	if opts.Query != "" && opts.Q != "" {
+		logFatalf("--query and --q can't be used together")
+	}
+	switch opts.Format {
+	case "json", "table", "csv":
+	default:
+		logFatalf("unknown format '%s'", opts.Format)
+	}
+	if opts.Params != "" && opts.Template == "" {
+		logFatalf("--params needs a --template")
+	}
+	if opts.Template != "" {
+		if opts.Query != "" || opts.Q != "" || opts.QueryText != "" {
+			logFatalf("--template can't be used with --query, --q, or --query-text")
+		}
+		body, err := templateSearchBody(opts.Template, opts.Params)
+		if err != nil {
+			logFatalf("Error reading the parameters: %s", err)
+		}
+		if opts.Profile {
+			body = profiledBody(body)
+		}
+		runSearch(opensearchapi.SearchTemplateRequest{
+			Index: []string{opts.Index},
+			Body:  bytes.NewReader(body),
+		}, opts.Format, opts.Columns)
+		return
+	}
+	req := opensearchapi.SearchRequest{
+		Index:          []string{opts.Index},
+		Query:          opts.Q,
+		Size:           &opts.Size,
+		From:           &opts.From,
+		Sort:           opts.Sort,
+		SourceIncludes: opts.SourceIncludes,
+	}
+	var body []byte
+	if opts.Query != "" {
+		var err error
+		body, err = searchBody(opts.Query)
+		if err != nil {
+			logFatalf("Error reading the query: %s", err)
+		}
+	}
+	if opts.QueryText != "" {
+		if opts.Query != "" || opts.Q != "" {
+			logFatalf("--query-text can't be used with --query or --q")
+		}
+		if opts.NeuralK <= 0 {
+			logFatalf("--neural-k must be positive")
+		}
+		var err error
+		body, err = json.Marshal(neuralBody(opts))
+		if err != nil {
+			logFatalf("Error encoding the query: %s", err)
+		}
+		if len(opts.SourceIncludes) == 0 {
+			// embeddings are long, and of no use in the output
+			req.SourceExcludes = []string{opts.NeuralField}
+		}
+	}
+	if opts.Profile {
+		body = profiledBody(body)
+	}
+	if body != nil {
+		req.Body = bytes.NewReader(body)
+	}
+	runSearch(req, opts.Format, opts.Columns)
+}
+
+// profiledBody returns a search body, or an empty one if body is nil, that
+// asks for the search to be profiled.
+func profiledBody(body []byte) []byte {
+	object := map[string]interface{}{}
+	if body != nil {
+		// the bodies are built by this file, so they are JSON objects
+		json.Unmarshal(body, &object)
+	}
+	object["profile"] = true
+	profiled, _ := json.Marshal(object)
+	return profiled
+}
+
+// neuralBody builds the search body of a neural search.
+func neuralBody(opts SearchOptions) map[string]interface{} {
+	return map[string]interface{}{
+		"query": map[string]interface{}{
+			"neural": map[string]interface{}{
+				opts.NeuralField: map[string]interface{}{
+					"query_text": opts.QueryText,
+					"model_id":   opts.ModelID,
+					"k":          opts.NeuralK,
+				},
+			},
+		},
+	}
+}
+
+// runSearch sends a search request, or a search template request, and
+// prints the hits in the format, with the columns of a table or CSV,
+// logging the number found.
+func runSearch(req apiRequest, format string, columns []string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := req.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error searching: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error searching: %s", err)
+	}
+	var result struct {
+		Hits struct {
+			Total struct {
+				Value    int    `json:"value"`
+				Relation string `json:"relation"`
+			} `json:"total"`
+			Hits []json.RawMessage `json:"hits"`
+		} `json:"hits"`
+		Profile json.RawMessage `json:"profile"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		logFatalf("Error reading the hits: %s", err)
+	}
+	if err := writeHits(os.Stdout, result.Hits.Hits, format, columns); err != nil {
+		logFatalf("Error writing the hits: %s", err)
+	}
+	total := result.Hits.Total
+	if total.Relation == "gte" {
+		logInfof("Returned [%d] of at least [%d] hits", len(result.Hits.Hits), total.Value)
+	} else {
+		logInfof("Returned [%d] of [%d] hits", len(result.Hits.Hits), total.Value)
+	}
+	if result.Profile != nil {
+		if err := writeProfile(os.Stderr, result.Profile); err != nil {
+			logFatalf("Error reading the profile: %s", err)
+		}
+	}
+}
+
+// searchBody reads a search body from a file: a whole body if it has a
+// query key, and otherwise a query to wrap in one.
+func searchBody(path string) ([]byte, error) {
+	object, err := readJSONFile(path, "")
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := object["query"]; ok {
+		return json.Marshal(object)
+	}
+	return json.Marshal(map[string]interface{}{"query": object})
+}
@@ -0,0 +1,182 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// searchTemplateCmd represents the search-template command
+var searchTemplateCmd = &cobra.Command{
+	Use:   "search-template",
+	Short: "Manage and render search templates",
+	Long: `Manage search templates: stored mustache scripts that build a search body from
+	parameters, such as those a frontend sends, so the query itself lives on the cluster.
+	Render a template to see the body its parameters make, and run it with search --template.
+	$ opensearch-doc search-template put product-search --file product-search.json
+	$ opensearch-doc search-template render product-search --params params.json
+	$ opensearch-doc search -i products --template product-search --params params.json`,
+}
+
+// searchTemplatePutCmd represents the search-template put command
+var searchTemplatePutCmd = &cobra.Command{
+	Use:   "put <name>",
+	Short: "Create or replace a search template from a JSON file",
+	Long: `Create or replace a search template from a JSON file, which holds the search body to
+	fill in, with {{placeholders}} for the parameters:
+	{"query": {"match": {"title": "{{query}}"}}, "size": "{{size}}"}
+	The file may also hold the script itself, as {"lang": "mustache", "source": ...}, whose
+	source may be a string for templates that aren't valid JSON, or wrap that in a "script"
+	key, as search-template get prints it.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		PutSearchTemplate(args[0], file)
+	},
+}
+
+// searchTemplateGetCmd represents the search-template get command
+var searchTemplateGetCmd = &cobra.Command{
+	Use:   "get <name>",
+	Short: "Show a search template, as JSON",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		GetSearchTemplate(args[0])
+	},
+}
+
+// searchTemplateDeleteCmd represents the search-template delete command
+var searchTemplateDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a search template",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		DeleteSearchTemplate(args[0])
+	},
+}
+
+// searchTemplateRenderCmd represents the search-template render command
+var searchTemplateRenderCmd = &cobra.Command{
+	Use:   "render <name>",
+	Short: "Print the search body a search template makes from parameters",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		params, _ := cmd.Flags().GetString("params")
+		RenderSearchTemplate(args[0], params)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(searchTemplateCmd)
+	searchTemplateCmd.AddCommand(searchTemplatePutCmd, searchTemplateGetCmd, searchTemplateDeleteCmd, searchTemplateRenderCmd)
+
+	searchTemplatePutCmd.Flags().String("file", "", "A JSON file of the template; - for stdin")
+	searchTemplatePutCmd.MarkFlagRequired("file")
+	searchTemplateRenderCmd.Flags().String("params", "", "A JSON file of the parameters; - for stdin")
+}
+
+// doSearchTemplateRequest sends a search template request, and returns the
+// response if it succeeded.
+func doSearchTemplateRequest(req apiRequest) *opensearchapi.Response {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := req.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error sending the search template request: %s", err)
+	}
+	if err := responseError(res); err != nil {
+		res.Body.Close()
+		logFatalf("Error in the search template request: %s", err)
+	}
+	return res
+}
+
+// PutSearchTemplate creates or replaces a search template from a JSON file.
+func PutSearchTemplate(name string, file string) {
+	template, err := readJSONFile(file, "script")
+	if err != nil {
+		logFatalf("Error reading the search template: %s", err)
+	}
+	// a file of just the search body is the source of a mustache script
+	script := template
+	if _, ok := template["source"]; !ok {
+		script = map[string]interface{}{"source": template}
+	}
+	if _, ok := script["lang"]; !ok {
+		script["lang"] = "mustache"
+	}
+	body, err := json.Marshal(map[string]interface{}{"script": script})
+	if err != nil {
+		logFatalf("Error encoding the search template: %s", err)
+	}
+	res := doSearchTemplateRequest(opensearchapi.PutScriptRequest{ScriptID: name, Body: bytes.NewReader(body)})
+	res.Body.Close()
+	fmt.Printf("Put search template [%s]\n", name)
+}
+
+// GetSearchTemplate prints a search template.
+func GetSearchTemplate(name string) {
+	res := doSearchTemplateRequest(opensearchapi.GetScriptRequest{ScriptID: name})
+	defer res.Body.Close()
+	// the response is {"_id": name, "found": true, "script": script}
+	var result struct {
+		Script json.RawMessage `json:"script"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		logFatalf("Error reading the search template: %s", err)
+	}
+	if err := printJSON(bytes.NewReader(result.Script)); err != nil {
+		logFatalf("Error reading the search template: %s", err)
+	}
+}
+
+// DeleteSearchTemplate deletes a search template.
+func DeleteSearchTemplate(name string) {
+	res := doSearchTemplateRequest(opensearchapi.DeleteScriptRequest{ScriptID: name})
+	res.Body.Close()
+	fmt.Printf("Deleted search template [%s]\n", name)
+}
+
+// RenderSearchTemplate prints the search body a search template makes from
+// the parameters in a JSON file, or from none if params is empty.
+func RenderSearchTemplate(name string, params string) {
+	body, err := templateSearchBody(name, params)
+	if err != nil {
+		logFatalf("Error reading the parameters: %s", err)
+	}
+	res := doSearchTemplateRequest(opensearchapi.RenderSearchTemplateRequest{TemplateID: name, Body: bytes.NewReader(body)})
+	defer res.Body.Close()
+	var result struct {
+		TemplateOutput json.RawMessage `json:"template_output"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		logFatalf("Error reading the rendered search: %s", err)
+	}
+	if err := printJSON(bytes.NewReader(result.TemplateOutput)); err != nil {
+		logFatalf("Error reading the rendered search: %s", err)
+	}
+}
+
+// templateSearchBody returns the body of a request to run or render the
+// named search template with the parameters in a JSON file, which may wrap
+// them in a "params" key; without a file, there are no parameters.
+func templateSearchBody(name string, params string) ([]byte, error) {
+	values := map[string]interface{}{}
+	if params != "" {
+		var err error
+		values, err = readJSONFile(params, "params")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(map[string]interface{}{"id": name, "params": values})
+}
@@ -0,0 +1,189 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/spf13/cobra"
+)
+
+// sqlCmd represents the sql command
+var sqlCmd = &cobra.Command{
+	Use:   "sql <query>",
+	Short: "Query indices with SQL",
+	Long: `Run a SQL query with the OpenSearch SQL plugin and write the rows to stdout, as a table,
+	as CSV, or as JSON, one object per row.
+	$ opensearch-doc sql "SELECT name, age FROM users WHERE age > 30 ORDER BY age" --format csv
+
+	Large results are read a page of --fetch-size rows at a time, with the plugin's cursor,
+	so they aren't limited to the plugin's default of 200 rows; --limit stops after a number
+	of rows. CSV and JSON rows are written as each page is read, and a table once all of
+	them have been. The plugin only pages simple queries, without aggregations or joins.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		fetchSize, _ := cmd.Flags().GetInt("fetch-size")
+		limit, _ := cmd.Flags().GetInt("limit")
+		SQL(SQLOptions{
+			Query:     args[0],
+			Format:    format,
+			FetchSize: fetchSize,
+			Limit:     limit,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(sqlCmd)
+
+	sqlCmd.Flags().String("format", "table", "The output format: table, csv, or json")
+	sqlCmd.Flags().Int("fetch-size", 1000, "The number of rows to read in each request")
+	sqlCmd.Flags().Int("limit", 0, "The most rows to write; 0 for all of them")
+}
+
+// SQLOptions holds the settings for a SQL query.
+type SQLOptions struct {
+	Query     string // The SQL query
+	Format    string // table, csv, or json
+	FetchSize int    // The number of rows to read in each request
+	Limit     int    // The most rows to write, if positive
+}
+
+// sqlPage is a page of the results of a SQL query. Only the first page
+// has the schema.
+type sqlPage struct {
+	Schema []struct {
+		Name  string `json:"name"`
+		Alias string `json:"alias"`
+	} `json:"schema"`
+	DataRows [][]json.RawMessage `json:"datarows"`
+	Cursor   string              `json:"cursor"`
+}
+
+// SQL runs a SQL query and prints the rows.
+func SQL(opts SQLOptions) {
+	switch opts.Format {
+	case "table", "csv", "json":
+	default:
+		logFatalf("unknown format '%s'", opts.Format)
+	}
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	var page sqlPage
+	body := map[string]interface{}{"query": opts.Query, "fetch_size": opts.FetchSize}
+	if err := jsonRequest(context.Background(), client, http.MethodPost, "/_plugins/_sql?format=jdbc", body, &page); err != nil {
+		logFatalf("Error running the query: %s", err)
+	}
+	columns := make([]string, len(page.Schema))
+	for i, column := range page.Schema {
+		columns[i] = column.Name
+		if column.Alias != "" {
+			columns[i] = column.Alias
+		}
+	}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	cw := csv.NewWriter(out)
+	if opts.Format == "csv" {
+		cw.Write(columns)
+	}
+	var table [][]string
+	n := 0
+	for {
+		for _, row := range page.DataRows {
+			if opts.Limit > 0 && n == opts.Limit {
+				break
+			}
+			n++
+			switch opts.Format {
+			case "json":
+				writeSQLObject(out, columns, row)
+			case "csv":
+				cw.Write(sqlCells(row))
+			case "table":
+				table = append(table, sqlCells(row))
+			}
+		}
+		cw.Flush()
+		out.Flush()
+		if page.Cursor == "" || opts.Limit > 0 && n == opts.Limit {
+			break
+		}
+		cursor := page.Cursor
+		page = sqlPage{}
+		if err := jsonRequest(context.Background(), client, http.MethodPost, "/_plugins/_sql?format=jdbc", map[string]string{"cursor": cursor}, &page); err != nil {
+			logFatalf("Error reading the rows after [%d]: %s", n, err)
+		}
+	}
+	// a cursor left open holds resources on the cluster until it expires
+	if page.Cursor != "" {
+		closeSQLCursor(client, page.Cursor)
+	}
+	if opts.Format == "table" {
+		if err := writeRows(out, "table", columns, table); err != nil {
+			logFatalf("Error writing the rows: %s", err)
+		}
+	}
+	if err := cw.Error(); err != nil {
+		logFatalf("Error writing the rows: %s", err)
+	}
+	logInfof("Read [%d] rows", n)
+}
+
+// closeSQLCursor closes the cursor of a SQL query that wasn't read to the
+// end.
+func closeSQLCursor(client *opensearch.Client, cursor string) {
+	if err := jsonRequest(context.Background(), client, http.MethodPost, "/_plugins/_sql/close", map[string]string{"cursor": cursor}, nil); err != nil {
+		logWarnf("Error closing the cursor: %s", err)
+	}
+}
+
+// sqlCells formats the values of a row for a table or CSV.
+func sqlCells(row []json.RawMessage) []string {
+	cells := make([]string, len(row))
+	for i, value := range row {
+		var s string
+		switch {
+		case string(value) == "null":
+		case json.Unmarshal(value, &s) == nil:
+			cells[i] = s
+		default:
+			// numbers are kept as they were written, however long
+			cells[i] = string(value)
+		}
+	}
+	return cells
+}
+
+// writeSQLObject writes a row as a JSON object, with its fields in the
+// order of the columns.
+func writeSQLObject(out *bufio.Writer, columns []string, row []json.RawMessage) {
+	var object bytes.Buffer
+	object.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			object.WriteByte(',')
+		}
+		name, _ := json.Marshal(column)
+		object.Write(name)
+		object.WriteByte(':')
+		if i < len(row) {
+			json.Compact(&object, row[i])
+		} else {
+			object.WriteString("null")
+		}
+	}
+	object.WriteString("}\n")
+	object.WriteTo(out)
+}
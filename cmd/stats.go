@@ -0,0 +1,76 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// bulkSummary is the machine-readable summary of a bulk run written with
+// --stats-output json.
+type bulkSummary struct {
+	Flushed       uint64         `json:"flushed"`
+	Failed        uint64         `json:"failed"`
+	Indexed       uint64         `json:"indexed"`
+	Created       uint64         `json:"created"`
+	Updated       uint64         `json:"updated"`
+	Deleted       uint64         `json:"deleted"`
+	Rejected      int64          `json:"rejected"`
+	Skipped       int64          `json:"skipped"`
+	Duplicates    int64          `json:"duplicates"`
+	Conflicts     int64          `json:"conflicts"`
+	Existing      int64          `json:"existing"`
+	Requests      uint64         `json:"requests"`
+	Retries       int64          `json:"retries"`
+	Duration      float64        `json:"duration_seconds"`
+	DocsPerSecond float64        `json:"docs_per_second"`
+	Errors        map[string]int `json:"errors"`
+	ExitCode      int            `json:"exit_code"`
+}
+
+// newBulkSummary summarizes a run that started at start.
+func newBulkSummary(stats osdoc.Stats, start time.Time, exitCode int) bulkSummary {
+	duration := time.Since(start).Seconds()
+	summary := bulkSummary{
+		Flushed:    stats.Flushed,
+		Failed:     stats.Failed,
+		Indexed:    stats.Indexed,
+		Created:    stats.Created,
+		Updated:    stats.Updated,
+		Deleted:    stats.Deleted,
+		Rejected:   stats.Rejected,
+		Skipped:    stats.Skipped,
+		Duplicates: stats.Duplicates,
+		Conflicts:  stats.Conflicts,
+		Existing:   stats.Existing,
+		Requests:   stats.Requests,
+		Retries:    requestRetries.Load(),
+		Duration:   duration,
+		Errors:     stats.Errors,
+		ExitCode:   exitCode,
+	}
+	if duration > 0 {
+		summary.DocsPerSecond = float64(stats.Flushed) / duration
+	}
+	return summary
+}
+
+// writeSummary writes summary as JSON to the named file, or to stdout if
+// path is empty or -.
+func writeSummary(summary bulkSummary, path string) error {
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "" || path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,249 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// taskCmd represents the task command
+var taskCmd = &cobra.Command{
+	Use:   "task",
+	Short: "List, show, or cancel running tasks",
+	Long: `List, show, or cancel the tasks running on the cluster, such as the reindex and
+	update-by-query tasks this tool starts, whose IDs it logs.
+	$ opensearch-doc task list --actions '*reindex*'
+	$ opensearch-doc task get oTUltX4IQMOUUVeiohTt8A:12345 --watch
+	$ opensearch-doc task cancel oTUltX4IQMOUUVeiohTt8A:12345`,
+}
+
+// taskListCmd represents the task list command
+var taskListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the running tasks",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		actions, _ := cmd.Flags().GetStringSlice("actions")
+		ListTasks(actions)
+	},
+}
+
+// taskGetCmd represents the task get command
+var taskGetCmd = &cobra.Command{
+	Use:   "get <id>",
+	Short: "Show a task, as JSON, optionally waiting for it to complete",
+	Long: `Show a task, as JSON. With --watch, the task's progress is logged until it completes,
+	and then its final state is shown; the exit status is 1 if it failed.
+	$ opensearch-doc task get oTUltX4IQMOUUVeiohTt8A:12345 --watch`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		watch, _ := cmd.Flags().GetBool("watch")
+		pollInterval, _ := cmd.Flags().GetDuration("poll-interval")
+		GetTask(args[0], watch, pollInterval)
+	},
+}
+
+// taskCancelCmd represents the task cancel command
+var taskCancelCmd = &cobra.Command{
+	Use:   "cancel <id>",
+	Short: "Cancel a task",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		CancelTask(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(taskCmd)
+	taskCmd.AddCommand(taskListCmd, taskGetCmd, taskCancelCmd)
+
+	taskListCmd.Flags().StringSlice("actions", nil, "Only list tasks whose actions match these wildcards, e.g. '*reindex*'")
+	taskGetCmd.Flags().Bool("watch", false, "Log the task's progress until it completes")
+	taskGetCmd.Flags().Duration("poll-interval", 5*time.Second, "With --watch, how often to check the task")
+}
+
+// ListTasks prints a table of the running tasks, optionally only those
+// whose actions match some wildcards.
+func ListTasks(actions []string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	detailed := true
+	res, err := opensearchapi.TasksListRequest{
+		Actions:  actions,
+		Detailed: &detailed,
+		GroupBy:  "none",
+	}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error listing the tasks: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error listing the tasks: %s", err)
+	}
+	var result struct {
+		Tasks []struct {
+			Node        string `json:"node"`
+			ID          int64  `json:"id"`
+			Action      string `json:"action"`
+			Description string `json:"description"`
+			StartTime   int64  `json:"start_time_in_millis"`
+			RunningTime int64  `json:"running_time_in_nanos"`
+			Cancellable bool   `json:"cancellable"`
+		} `json:"tasks"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		logFatalf("Error reading the tasks: %s", err)
+	}
+	tasks := result.Tasks
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].StartTime < tasks[j].StartTime })
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tACTION\tRUNNING\tCANCELLABLE\tDESCRIPTION")
+	for _, task := range tasks {
+		running := time.Duration(task.RunningTime).Truncate(time.Second)
+		description := strings.NewReplacer("\t", " ", "\n", " ").Replace(task.Description)
+		fmt.Fprintf(w, "%s:%d\t%s\t%s\t%t\t%s\n", task.Node, task.ID, task.Action, running, task.Cancellable, description)
+	}
+	w.Flush()
+}
+
+// GetTask prints a task, first waiting for it to complete if watch is set.
+func GetTask(task string, watch bool, pollInterval time.Duration) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	failed := false
+	if watch {
+		_, failures, err := waitForTask(client, task, pollInterval)
+		if err != nil {
+			logErrorf("Task [%s] failed: %s", task, err)
+			failed = true
+		}
+		for _, failure := range failures {
+			logErrorf("Error in task [%s]: %s", task, failure)
+			failed = true
+		}
+	}
+	res, err := opensearchapi.TasksGetRequest{TaskID: task}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error getting the task: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error getting the task: %s", err)
+	}
+	if err := printJSON(res.Body); err != nil {
+		logFatalf("Error reading the task: %s", err)
+	}
+	if failed {
+		exit(1)
+	}
+}
+
+// CancelTask cancels a task.
+func CancelTask(task string) {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := opensearchapi.TasksCancelRequest{TaskID: task}.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error cancelling the task: %s", err)
+	}
+	defer res.Body.Close()
+	if err := responseError(res); err != nil {
+		logFatalf("Error cancelling the task: %s", err)
+	}
+	// a task that can't be cancelled is reported in the body
+	type failure struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	var result struct {
+		NodeFailures []failure `json:"node_failures"`
+		TaskFailures []struct {
+			Reason failure `json:"reason"`
+		} `json:"task_failures"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		logFatalf("Error reading the response: %s", err)
+	}
+	for _, f := range result.TaskFailures {
+		logFatalf("Error cancelling the task: %s: %s", f.Reason.Type, f.Reason.Reason)
+	}
+	for _, f := range result.NodeFailures {
+		logFatalf("Error cancelling the task: %s: %s", f.Type, f.Reason)
+	}
+	fmt.Printf("Cancelled task [%s]\n", task)
+}
+
+// taskStatus is the status of a task that changes documents, such as a
+// reindex.
+type taskStatus struct {
+	Total            int64 `json:"total"`
+	Created          int64 `json:"created"`
+	Updated          int64 `json:"updated"`
+	Deleted          int64 `json:"deleted"`
+	VersionConflicts int64 `json:"version_conflicts"`
+	Noops            int64 `json:"noops"`
+}
+
+// waitForTask polls a task that changes documents until it completes,
+// reporting its progress, and returns its final status and the reasons for
+// any documents that failed.
+func waitForTask(client *opensearch.Client, task string, interval time.Duration) (taskStatus, []string, error) {
+	for {
+		res, err := opensearchapi.TasksGetRequest{TaskID: task}.Do(context.Background(), client)
+		if err != nil {
+			return taskStatus{}, nil, err
+		}
+		var result struct {
+			Completed bool `json:"completed"`
+			Task      struct {
+				Status taskStatus `json:"status"`
+			} `json:"task"`
+			Response struct {
+				Failures []json.RawMessage `json:"failures"`
+			} `json:"response"`
+			Error json.RawMessage `json:"error"`
+		}
+		err = responseError(res)
+		if err == nil {
+			err = json.NewDecoder(res.Body).Decode(&result)
+		}
+		res.Body.Close()
+		if err != nil {
+			return taskStatus{}, nil, err
+		}
+		status := result.Task.Status
+		if result.Completed {
+			if result.Error != nil {
+				return status, nil, fmt.Errorf("%s", result.Error)
+			}
+			failures := make([]string, len(result.Response.Failures))
+			for i, failure := range result.Response.Failures {
+				failures[i] = string(failure)
+			}
+			return status, failures, nil
+		}
+		done := status.Created + status.Updated + status.Deleted + status.VersionConflicts + status.Noops
+		if status.Total > 0 {
+			logInfof("Handled [%d] of [%d] documents (%.0f%%)", done, status.Total, 100*float64(done)/float64(status.Total))
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/spf13/cobra"
+)
+
+// apiRequest is any opensearchapi request.
+type apiRequest interface {
+	Do(ctx context.Context, transport opensearchapi.Transport) (*opensearchapi.Response, error)
+}
+
+// templateAPI is the API for a kind of template: index templates, which
+// apply to new indices whose names match their patterns, or component
+// templates, which index templates are composed of.
+type templateAPI struct {
+	kind    string // as in messages, e.g. "index template"
+	wrapper string // the key of one template in a get response, e.g. index_template
+	put     func(name string, body []byte) apiRequest
+	get     func(name string) apiRequest
+	delete  func(name string) apiRequest
+}
+
+var indexTemplateAPI = templateAPI{
+	kind:    "index template",
+	wrapper: "index_template",
+	put: func(name string, body []byte) apiRequest {
+		return opensearchapi.IndicesPutIndexTemplateRequest{Name: name, Body: bytes.NewReader(body)}
+	},
+	get: func(name string) apiRequest {
+		req := opensearchapi.IndicesGetIndexTemplateRequest{}
+		if name != "" {
+			req.Name = []string{name}
+		}
+		return req
+	},
+	delete: func(name string) apiRequest {
+		return opensearchapi.IndicesDeleteIndexTemplateRequest{Name: name}
+	},
+}
+
+// templateCmd represents the template command
+var templateCmd = newTemplateCmd(indexTemplateAPI, "template", `Manage index templates, which give new indices whose names match their patterns
+	their settings, mappings, and aliases. An index created by a bulk load into a date
+	pattern, such as logs-{yyyy.MM.dd}, gets the right mappings from a template:
+	$ opensearch-doc template put logs --file logs-template.json`)
+
+func init() {
+	rootCmd.AddCommand(templateCmd)
+}
+
+// newTemplateCmd returns a command named use, with put, get, delete, and
+// list subcommands for a kind of template.
+func newTemplateCmd(api templateAPI, use string, long string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: fmt.Sprintf("Manage %ss", api.kind),
+		Long:  long,
+	}
+	put := &cobra.Command{
+		Use:   "put <name>",
+		Short: "Create or replace a template from a JSON file",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			file, _ := cmd.Flags().GetString("file")
+			PutTemplate(api, args[0], file)
+		},
+	}
+	put.Flags().String("file", "", "A JSON file of the template")
+	put.MarkFlagRequired("file")
+	get := &cobra.Command{
+		Use:   "get <name>",
+		Short: "Show a template, as JSON",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			GetTemplate(api, args[0])
+		},
+	}
+	delete := &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete a template",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			DeleteTemplate(api, args[0])
+		},
+	}
+	list := &cobra.Command{
+		Use:   "list [name]",
+		Short: "List templates, optionally those matching a wildcard name",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+			ListTemplates(api, name)
+		},
+	}
+	cmd.AddCommand(put, get, delete, list)
+	return cmd
+}
+
+// doTemplateRequest sends a template request, and returns the response if
+// it succeeded.
+func doTemplateRequest(api templateAPI, req apiRequest) *opensearchapi.Response {
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	res, err := req.Do(context.Background(), client)
+	if err != nil {
+		logFatalf("Error sending the %s request: %s", api.kind, err)
+	}
+	if err := responseError(res); err != nil {
+		res.Body.Close()
+		logFatalf("Error in the %s request: %s", api.kind, err)
+	}
+	return res
+}
+
+// PutTemplate creates or replaces a template from a JSON file, which may
+// hold the template or wrap it as a get response does.
+func PutTemplate(api templateAPI, name string, file string) {
+	template, err := readJSONFile(file, api.wrapper)
+	if err != nil {
+		logFatalf("Error reading the %s: %s", api.kind, err)
+	}
+	body, err := json.Marshal(template)
+	if err != nil {
+		logFatalf("Error encoding the %s: %s", api.kind, err)
+	}
+	res := doTemplateRequest(api, api.put(name, body))
+	res.Body.Close()
+	fmt.Printf("Put %s [%s]\n", api.kind, name)
+}
+
+// GetTemplate prints a template.
+func GetTemplate(api templateAPI, name string) {
+	res := doTemplateRequest(api, api.get(name))
+	defer res.Body.Close()
+	if err := printJSON(res.Body); err != nil {
+		logFatalf("Error reading the %s: %s", api.kind, err)
+	}
+}
+
+// DeleteTemplate deletes a template.
+func DeleteTemplate(api templateAPI, name string) {
+	res := doTemplateRequest(api, api.delete(name))
+	res.Body.Close()
+	fmt.Printf("Deleted %s [%s]\n", api.kind, name)
+}
+
+// ListTemplates prints the names of the templates matching name, or of all
+// of them if name is empty, with the index patterns of index templates.
+func ListTemplates(api templateAPI, name string) {
+	res := doTemplateRequest(api, api.get(name))
+	defer res.Body.Close()
+	// the response is {"index_templates": [{"name": ..., "index_template": ...}]}
+	var body map[string][]map[string]json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		logFatalf("Error reading the %ss: %s", api.kind, err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, template := range body[api.wrapper+"s"] {
+		var name string
+		json.Unmarshal(template["name"], &name)
+		var spec struct {
+			IndexPatterns []string `json:"index_patterns"`
+		}
+		json.Unmarshal(template[api.wrapper], &spec)
+		fmt.Fprintf(w, "%s\t%s\n", name, strings.Join(spec.IndexPatterns, ","))
+	}
+	w.Flush()
+}
@@ -0,0 +1,55 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// newHTTPTransport returns the base HTTP transport for the client,
+// configured with any custom CA bundle, client certificate, or insecure
+// mode from the connection settings.
+func newHTTPTransport() (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	config := &tls.Config{
+		InsecureSkipVerify: viper.GetBool("insecure"),
+	}
+
+	if caCert := viper.GetString("ca-cert"); caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+		config.RootCAs = pool
+	}
+
+	clientCert, clientKey := viper.GetString("client-cert"), viper.GetString("client-key")
+	if (clientCert == "") != (clientKey == "") {
+		return nil, errors.New("--client-cert and --client-key must be given together")
+	}
+	if clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	transport.TLSClientConfig = config
+	return transport, nil
+}
@@ -0,0 +1,299 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tracing exports the spans of the command's bulk and search requests, or
+// holds nil if traces aren't being exported.
+var tracing atomic.Pointer[tracer]
+
+// The most spans held before they are exported, and how often they are
+// exported otherwise
+const (
+	traceBatchSize     = 512
+	traceFlushInterval = 2 * time.Second
+	traceExportTimeout = 10 * time.Second
+)
+
+// tracer exports spans to an OTLP collector over HTTP, in the JSON
+// encoding, in batches. The spans of a command are in one trace, under a
+// span for the whole command.
+type tracer struct {
+	url     string
+	client  *http.Client
+	traceID string
+	root    span
+
+	mu    sync.Mutex
+	spans []span
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// span is a span of an OTLP trace.
+type span struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        string          `json:"startTimeUnixNano"`
+	End          string          `json:"endTimeUnixNano"`
+	Attributes   []spanAttribute `json:"attributes,omitempty"`
+	Status       spanStatus      `json:"status"`
+}
+
+// The kinds of spans, and the status code of a span that failed
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+	spanStatusError  = 2
+)
+
+type spanAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type spanStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// startTracing starts exporting the spans of the command to the OTLP
+// collector at endpoint, such as http://localhost:4318.
+func startTracing(endpoint string, command string) {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	t := &tracer{
+		url:     url,
+		client:  &http.Client{Timeout: traceExportTimeout},
+		traceID: randomID(16),
+		done:    make(chan struct{}),
+	}
+	t.root = span{
+		TraceID: t.traceID,
+		SpanID:  randomID(8),
+		Name:    command,
+		Kind:    spanKindInternal,
+		Start:   unixNano(time.Now()),
+	}
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(traceFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.flush()
+			case <-t.done:
+				return
+			}
+		}
+	}()
+	tracing.Store(t)
+}
+
+// stopTracing ends the command's span and exports the spans not yet
+// exported, if traces are being exported.
+func stopTracing() {
+	t := tracing.Swap(nil)
+	if t == nil {
+		return
+	}
+	close(t.done)
+	t.wg.Wait()
+	t.root.End = unixNano(time.Now())
+	t.add(t.root)
+	t.flush()
+}
+
+// add queues a finished span for export, exporting the queue once it is
+// full.
+func (t *tracer) add(s span) {
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	full := len(t.spans) >= traceBatchSize
+	t.mu.Unlock()
+	if full {
+		go t.flush()
+	}
+}
+
+// flush exports the queued spans.
+func (t *tracer) flush() {
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.export(spans); err != nil {
+		logWarnf("Error exporting %d trace spans: %s", len(spans), err)
+	}
+}
+
+// export sends spans to the collector.
+func (t *tracer) export(spans []span) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []spanAttribute{stringAttribute("service.name", "opensearch-doc")},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "opensearch-doc"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	res, err := t.client.Post(t.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// tracingTransport records a span for each bulk and search request, and
+// passes the span on to the cluster in a traceparent header, so its own
+// traces of the request can be found.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (tr *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t := tracing.Load()
+	name := requestSpanName(req.URL.Path)
+	if t == nil || name == "" {
+		return tr.next.RoundTrip(req)
+	}
+	s := span{
+		TraceID:      t.traceID,
+		SpanID:       randomID(8),
+		ParentSpanID: t.root.SpanID,
+		Name:         name,
+		Kind:         spanKindClient,
+		Start:        unixNano(time.Now()),
+		Attributes: []spanAttribute{
+			stringAttribute("db.system", "opensearch"),
+			stringAttribute("http.method", req.Method),
+			stringAttribute("http.target", req.URL.Path),
+		},
+	}
+	if index := requestIndex(req.URL.Path); index != "" {
+		s.Attributes = append(s.Attributes, stringAttribute("opensearch.index", index))
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", s.TraceID, s.SpanID))
+	res, err := tr.next.RoundTrip(req)
+	if err != nil {
+		s.Status = spanStatus{Code: spanStatusError, Message: err.Error()}
+	} else {
+		s.Attributes = append(s.Attributes, intAttribute("http.status_code", int64(res.StatusCode)))
+		if res.StatusCode >= 400 {
+			s.Status = spanStatus{Code: spanStatusError, Message: res.Status}
+		} else if documents, ok := responseDocuments(res, name); ok {
+			s.Attributes = append(s.Attributes, intAttribute("opensearch.documents", documents))
+		}
+	}
+	s.End = unixNano(time.Now())
+	t.add(s)
+	return res, err
+}
+
+// requestSpanName returns the name of the span for a request to path, or
+// "" if it isn't traced.
+func requestSpanName(path string) string {
+	switch {
+	case strings.HasSuffix(path, "/_bulk"):
+		return "bulk"
+	case strings.Contains(path, "/_search"):
+		return "search"
+	}
+	return ""
+}
+
+// requestIndex returns the index (or indices) a request to path is for, or
+// "" if it isn't for any.
+func requestIndex(path string) string {
+	first := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	if strings.HasPrefix(first, "_") {
+		return ""
+	}
+	return first
+}
+
+// responseDocuments returns the number of documents in a bulk or search
+// response: the items of a bulk request, or the hits of a page of search
+// results. It reads the body, and replaces it for the client to read.
+func responseDocuments(res *http.Response, name string) (int64, bool) {
+	if res.Header.Get("Content-Encoding") != "" {
+		return 0, false
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return 0, false
+	}
+	var parsed struct {
+		Items []json.RawMessage `json:"items"`
+		Hits  struct {
+			Hits []json.RawMessage `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return 0, false
+	}
+	if name == "bulk" {
+		return int64(len(parsed.Items)), true
+	}
+	return int64(len(parsed.Hits.Hits)), true
+}
+
+func stringAttribute(key string, value string) spanAttribute {
+	return spanAttribute{Key: key, Value: map[string]interface{}{"stringValue": value}}
+}
+
+// intAttribute returns an integer attribute, which OTLP's JSON encoding
+// writes as a string.
+func intAttribute(key string, value int64) spanAttribute {
+	return spanAttribute{Key: key, Value: map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}}
+}
+
+// randomID returns n random bytes in hex, for trace and span IDs.
+func randomID(n int) string {
+	id := make([]byte, n)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
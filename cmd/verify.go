@@ -0,0 +1,343 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/willf/opensearch-doc/pkg/osdoc"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that an index holds the documents of its input",
+	Long: `Check a bulk load: that the number of documents in the index matches the number of
+	distinct IDs in the input, read as bulk reads it, and that a random --sample of the input
+	documents are in the index with the same contents. Each difference is reported, followed
+	by PASS or FAIL; the exit code is 1 if the check fails, for data-quality gates in scripts.
+	$ opensearch-doc bulk -i my_index -f id -F data.ndjson --refresh true
+	$ opensearch-doc verify -i my_index -f id -F data.ndjson --sample 500
+
+	The documents are compared as bulk would have indexed them, without the ID field unless
+	--keep-id is given, so a load that changed them, such as with --transform, won't match.
+	The index count only includes documents that have been refreshed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		index, _ := cmd.Flags().GetString("index")
+		files, _ := cmd.Flags().GetStringArray("file")
+		idField, _ := cmd.Flags().GetString("id-field")
+		idSeparator, _ := cmd.Flags().GetString("id-separator")
+		keepID, _ := cmd.Flags().GetBool("keep-id")
+		format, _ := cmd.Flags().GetString("format")
+		types, _ := cmd.Flags().GetStringToString("types")
+		inferTypes, _ := cmd.Flags().GetBool("infer-types")
+		sample, _ := cmd.Flags().GetInt("sample")
+		if !Verify(VerifyOptions{
+			Index:       index,
+			Files:       files,
+			IDField:     idField,
+			IDSeparator: idSeparator,
+			KeepID:      keepID,
+			Format:      format,
+			Types:       types,
+			InferTypes:  inferTypes,
+			Sample:      sample,
+		}) {
+			exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	verifyCmd.Flags().StringP("index", "i", "", "The index to check")
+	verifyCmd.Flags().StringArrayP("file", "F", nil, "A file (or glob pattern) the index was loaded from, instead of stdin; may be repeated")
+	verifyCmd.Flags().StringP("id-field", "f", "_id", "The field holding the document ID, or a dotted path; several fields may be separated by commas")
+	verifyCmd.Flags().String("id-separator", ":", "The separator between the values of a composite document ID")
+	verifyCmd.Flags().Bool("keep-id", false, "The ID field was kept in the indexed documents")
+	verifyCmd.Flags().String("format", "json", "The input format: json, csv, tsv, parquet, avro, xml, or yaml")
+	verifyCmd.Flags().StringToString("types", nil, "Column types for csv/tsv input, e.g. age=int,price=float,active=bool")
+	verifyCmd.Flags().Bool("infer-types", false, "Infer int, float, and bool values for csv/tsv columns without a type")
+	verifyCmd.Flags().Int("sample", 100, "The number of input documents to compare with the index")
+	verifyCmd.MarkFlagRequired("index")
+}
+
+// VerifyOptions holds the settings for checking an index against its input.
+type VerifyOptions struct {
+	Index       string   // The index to check
+	Files       []string // Files or glob patterns of the input; stdin if empty
+	IDField     string   // The fields (or dotted paths) holding the document ID, separated by commas
+	IDSeparator string   // The separator between the parts of a composite ID
+	KeepID      bool     // The ID field was indexed along with the rest of the document
+
+	Format     string            // The input format, as for bulk
+	Types      map[string]string // Column types for csv/tsv input
+	InferTypes bool              // Infer types of csv/tsv columns without one
+
+	Sample int // The number of documents to compare
+}
+
+// sampledDocument is an input document chosen to compare with the index.
+type sampledDocument struct {
+	id     string
+	source string // Where it was read from
+	fields map[string]interface{}
+}
+
+// maxReportedDifferences is the most differing fields reported for each
+// document.
+const maxReportedDifferences = 5
+
+// Verify checks that the index holds the documents of the input, reports
+// the differences, and returns whether it does.
+func Verify(opts VerifyOptions) bool {
+	if opts.Sample < 0 {
+		logFatalf("--sample can't be negative")
+	}
+	// a dry-run loader, for its parser of the input formats
+	loader, err := osdoc.NewBulkLoader(context.Background(), nil, osdoc.Options{
+		Index:        opts.Index,
+		Action:       "index",
+		IDField:      opts.IDField,
+		Format:       opts.Format,
+		Types:        opts.Types,
+		InferTypes:   opts.InferTypes,
+		MaxLineBytes: 100 << 20,
+		DryRun:       true,
+	})
+	if err != nil {
+		logFatalf("%s", err)
+	}
+	var src osdoc.DocumentSource
+	if len(opts.Files) == 0 {
+		src = osdoc.NewReaderSource("stdin", os.Stdin, loader.Parse)
+	} else {
+		src = osdoc.NewGlobSource(opts.Files, loader.Parse)
+	}
+	defer src.Close()
+	var idPaths [][]string
+	for _, field := range strings.Split(opts.IDField, ",") {
+		idPaths = append(idPaths, osdoc.SplitFieldPath(field))
+	}
+
+	// Read the input, counting the distinct IDs and sampling the documents
+	//
+	ids := map[string]struct{}{}
+	records, withoutID := 0, 0
+	var sample []sampledDocument
+	sampleIndex := map[string]int{} // The position of each ID in the sample
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for {
+		doc, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logFatalf("Error reading the input: %s", err)
+		}
+		records++
+		id, ok := verifyDocumentID(doc.Fields, idPaths, opts.IDSeparator)
+		if !ok {
+			withoutID++
+			continue
+		}
+		ids[id] = struct{}{}
+		sampled := sampledDocument{id, fmt.Sprintf("%s:%d", doc.Source, doc.Line), doc.Fields}
+		// the last document with an ID is the one indexed
+		if i, ok := sampleIndex[id]; ok {
+			sample[i] = sampled
+			continue
+		}
+		// a reservoir sample of the documents with IDs
+		n := records - withoutID
+		if len(sample) < opts.Sample {
+			sampleIndex[id] = len(sample)
+			sample = append(sample, sampled)
+		} else if i := random.Intn(n); i < opts.Sample {
+			delete(sampleIndex, sample[i].id)
+			sampleIndex[id] = i
+			sample[i] = sampled
+		}
+	}
+	if withoutID > 0 {
+		logWarnf("[%d] input records have no ID, or couldn't be parsed, and aren't checked", withoutID)
+	}
+
+	// Compare the number of documents
+	//
+	client, err := NewClient()
+	if err != nil {
+		logFatalf("Error creating the client: %s", err)
+	}
+	var count struct {
+		Count int `json:"count"`
+	}
+	if err := jsonRequest(context.Background(), client, http.MethodGet, "/"+url.PathEscape(opts.Index)+"/_count", nil, &count); err != nil {
+		logFatalf("Error counting the documents: %s", err)
+	}
+	passed := true
+	fmt.Printf("Index [%s] has [%d] documents; the input has [%d] distinct IDs in [%d] records\n",
+		opts.Index, count.Count, len(ids), records)
+	if count.Count != len(ids) {
+		fmt.Printf("FAIL: the counts differ by [%d]\n", count.Count-len(ids))
+		passed = false
+	}
+
+	// Compare the sampled documents
+	//
+	missing, different := 0, 0
+	for start := 0; start < len(sample); start += 1000 {
+		batch := sample[start:]
+		if len(batch) > 1000 {
+			batch = batch[:1000]
+		}
+		batchIDs := make([]string, len(batch))
+		for i, doc := range batch {
+			batchIDs[i] = doc.id
+		}
+		docs, err := multiGet(client, MultiGetOptions{Index: opts.Index}, batchIDs)
+		if err != nil {
+			logFatalf("Error getting the documents: %s", err)
+		}
+		for i, doc := range docs {
+			input := batch[i]
+			if !doc.Found {
+				fmt.Printf("%s: document [%s] is missing\n", input.source, input.id)
+				missing++
+				continue
+			}
+			if doc.Source == nil {
+				doc.Source = map[string]interface{}{}
+			}
+			if !opts.KeepID {
+				for _, path := range idPaths {
+					deleteFieldPath(input.fields, path)
+				}
+			}
+			differences := documentDifferences("", normalizeJSON(input.fields), normalizeJSON(doc.Source))
+			if len(differences) == 0 {
+				continue
+			}
+			different++
+			if len(differences) > maxReportedDifferences {
+				differences = append(differences[:maxReportedDifferences], fmt.Sprintf("and %d more", len(differences)-maxReportedDifferences))
+			}
+			fmt.Printf("%s: document [%s] differs: %s\n", input.source, input.id, strings.Join(differences, "; "))
+		}
+	}
+	fmt.Printf("Compared [%d] documents: [%d] match, [%d] missing, [%d] different\n",
+		len(sample), len(sample)-missing-different, missing, different)
+	if missing > 0 || different > 0 {
+		passed = false
+	}
+	if passed {
+		fmt.Println("PASS")
+	} else {
+		fmt.Println("FAIL")
+	}
+	return passed
+}
+
+// verifyDocumentID returns the ID of an input document, made from the
+// values of the ID fields as bulk does, and whether it has one.
+func verifyDocumentID(document map[string]interface{}, idPaths [][]string, separator string) (string, bool) {
+	if document == nil {
+		return "", false
+	}
+	parts := make([]string, len(idPaths))
+	for i, path := range idPaths {
+		value := osdoc.LookupField(document, path)
+		if value == nil {
+			return "", false
+		}
+		parts[i] = fmt.Sprintf("%v", value)
+	}
+	return strings.Join(parts, separator), true
+}
+
+// deleteFieldPath removes the field at the path of keys from a document.
+func deleteFieldPath(document map[string]interface{}, keys []string) {
+	for i, key := range keys {
+		if i == len(keys)-1 {
+			delete(document, key)
+			return
+		}
+		next, ok := document[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		document = next
+	}
+}
+
+// normalizeJSON returns a value as it would be decoded from its JSON, so
+// that input and indexed documents can be compared.
+func normalizeJSON(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	json.Unmarshal(data, &normalized)
+	return normalized
+}
+
+// documentDifferences describes how the indexed value differs from the
+// input value at the dotted path, field by field for objects.
+func documentDifferences(path string, input interface{}, indexed interface{}) []string {
+	inputObject, ok1 := input.(map[string]interface{})
+	indexedObject, ok2 := indexed.(map[string]interface{})
+	if !ok1 || !ok2 {
+		if reflect.DeepEqual(input, indexed) {
+			return nil
+		}
+		a, _ := json.Marshal(input)
+		b, _ := json.Marshal(indexed)
+		return []string{fmt.Sprintf("%s is %s in the input, %s in the index", path, a, b)}
+	}
+	keys := map[string]bool{}
+	for key := range inputObject {
+		keys[key] = true
+	}
+	for key := range indexedObject {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	var differences []string
+	for _, key := range sorted {
+		field := key
+		if path != "" {
+			field = path + "." + key
+		}
+		a, inInput := inputObject[key]
+		b, inIndex := indexedObject[key]
+		switch {
+		case !inIndex:
+			differences = append(differences, fmt.Sprintf("%s is missing from the index", field))
+		case !inInput:
+			differences = append(differences, fmt.Sprintf("%s is only in the index", field))
+		default:
+			differences = append(differences, documentDifferences(field, a, b)...)
+		}
+	}
+	return differences
+}
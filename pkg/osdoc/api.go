@@ -0,0 +1,52 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+)
+
+// APIError is an error response from OpenSearch.
+type APIError struct {
+	Status int
+	Type   string // e.g. resource_already_exists_exception
+	Reason string
+}
+
+func (e *APIError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("status %d: %s", e.Status, e.Reason)
+	}
+	return fmt.Sprintf("status %d: %s: %s", e.Status, e.Type, e.Reason)
+}
+
+// ResponseError returns the error described by an error response, or nil
+// if res isn't an error. It reads the body of an error response.
+func ResponseError(res *opensearchapi.Response) error {
+	if !res.IsError() {
+		return nil
+	}
+	body, _ := io.ReadAll(res.Body)
+	var parsed struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil || parsed.Error == nil {
+		return &APIError{Status: res.StatusCode, Reason: string(body)}
+	}
+	var cause struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(parsed.Error, &cause); err != nil {
+		// some errors are a bare string
+		var reason string
+		json.Unmarshal(parsed.Error, &reason)
+		return &APIError{Status: res.StatusCode, Reason: reason}
+	}
+	return &APIError{Status: res.StatusCode, Type: cause.Type, Reason: cause.Reason}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/opensearch-project/opensearch-go/opensearchtransport"
+)
+
+// The limits of the number of bulk requests the concurrencyTuner allows at
+// once.
+const (
+	minAutoTuneConcurrency = 1
+	maxAutoTuneWorkers     = 16 // The most, if Workers isn't set
+)
+
+// slowLatency is how many times the fastest bulk request a request can take
+// before the cluster is taken to be struggling.
+const slowLatency = 3
+
+// backoffInterval is the least time between two reductions of the number
+// of concurrent requests, so that one burst of rejections, from requests
+// sent at the same time, only counts once.
+const backoffInterval = time.Second
+
+// concurrencyTuner is a transport that limits the number of bulk requests
+// in flight, and adjusts the limit to the cluster's responses: it starts at
+// one, rises by one for each round of fast responses, and halves when the
+// cluster rejects requests with a 429 or 503, or rejects documents with a
+// 429 from a full write thread pool. A response that is much slower than
+// the fastest lowers the limit by one. Other requests aren't limited.
+type concurrencyTuner struct {
+	next opensearchtransport.Interface
+	max  int
+
+	mu        sync.Mutex
+	limit     int           // The number of requests allowed at once
+	inFlight  int           // The number of requests being sent
+	fast      int           // The fast responses since the limit last changed
+	fastest   time.Duration // The quickest response so far
+	lastDrop  time.Time     // When the limit was last lowered
+	available chan struct{} // Closed when a request finishes or the limit rises
+}
+
+// autoTuneClient returns a client that sends its requests with client's
+// transport, with the number of bulk requests at once tuned by a
+// concurrencyTuner, up to max.
+func autoTuneClient(client *opensearch.Client, max int) *opensearch.Client {
+	tuner := &concurrencyTuner{
+		next:      client.Transport,
+		max:       max,
+		limit:     minAutoTuneConcurrency,
+		available: make(chan struct{}),
+	}
+	return &opensearch.Client{Transport: tuner, API: opensearchapi.New(tuner)}
+}
+
+func (t *concurrencyTuner) Perform(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, "/_bulk") {
+		return t.next.Perform(req)
+	}
+	if err := t.acquire(req); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	res, err := t.next.Perform(req)
+	latency := time.Since(start)
+	throttled := ""
+	switch {
+	case err != nil:
+	case res.StatusCode == 429 || res.StatusCode == 503:
+		throttled = res.Status
+	case res.StatusCode == 200:
+		// the body is read here to find rejected documents, and replaced
+		// for the indexer to read
+		body, readErr := io.ReadAll(res.Body)
+		res.Body.Close()
+		res.Body = io.NopCloser(bytes.NewReader(body))
+		if readErr != nil {
+			err = readErr
+		} else if bytes.Contains(body, []byte(`"status":429`)) {
+			throttled = "documents rejected with 429"
+		}
+	}
+	t.release(latency, err == nil, throttled)
+	return res, err
+}
+
+// acquire waits until another bulk request is allowed, or the request's
+// context is done.
+func (t *concurrencyTuner) acquire(req *http.Request) error {
+	for {
+		t.mu.Lock()
+		if t.inFlight < t.limit {
+			t.inFlight++
+			t.mu.Unlock()
+			return nil
+		}
+		available := t.available
+		t.mu.Unlock()
+		select {
+		case <-available:
+		case <-req.Context().Done():
+			return req.Context().Err()
+		}
+	}
+}
+
+// release ends a bulk request that took latency, adjusting the limit by
+// how it went: whether a response came back at all, and if it did, why the
+// cluster throttled it, or "" if it didn't.
+func (t *concurrencyTuner) release(latency time.Duration, responded bool, throttled string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inFlight--
+	limit := t.limit
+	recent := time.Since(t.lastDrop) < backoffInterval
+	switch {
+	case throttled != "":
+		if !recent {
+			limit = t.limit / 2
+		}
+	case !responded:
+	case t.fastest == 0 || latency < t.fastest:
+		t.fastest = latency
+		t.fast++
+	case latency > slowLatency*t.fastest:
+		if !recent {
+			limit = t.limit - 1
+		}
+	default:
+		t.fast++
+	}
+	if limit < minAutoTuneConcurrency {
+		limit = minAutoTuneConcurrency
+	}
+	switch {
+	case limit < t.limit && throttled != "":
+		logInfof("The cluster is throttling bulk requests (%s); backing off to %d at once", throttled, limit)
+		t.lastDrop = time.Now()
+	case limit < t.limit:
+		logDebugf("A bulk request took %s; lowering to %d at once", latency, limit)
+		t.lastDrop = time.Now()
+	case t.fast >= t.limit && t.limit < t.max:
+		limit = t.limit + 1
+		logDebugf("Raising to %d bulk requests at once", limit)
+	}
+	if limit != t.limit {
+		t.fast = 0
+		t.limit = limit
+	}
+	// wake the requests waiting for one to finish
+	close(t.available)
+	t.available = make(chan struct{})
+}
@@ -0,0 +1,341 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// readAvro calls add with a document for each record of the Avro object
+// container file read from r.
+func readAvro(r io.Reader, name string, add AddFunc) error {
+	ocf, err := goavro.NewOCFReader(r)
+	if err != nil {
+		return err
+	}
+	codec, err := newAvroCodec(ocf.Codec())
+	if err != nil {
+		return err
+	}
+	record := 0
+	for ocf.Scan() {
+		record++
+		native, err := ocf.Read()
+		if err != nil {
+			return err
+		}
+		document, err := codec.document(native)
+		if err != nil {
+			logErrorf("%s:%d: %s; not adding", name, record, err)
+		}
+		if err := add(record, document); err != nil {
+			return err
+		}
+	}
+	return ocf.Err()
+}
+
+// avroCodec decodes Avro data to documents, following the schema to take
+// values out of their unions.
+type avroCodec struct {
+	codec  *goavro.Codec
+	schema interface{}            // The schema, as parsed JSON
+	names  map[string]interface{} // The named types of the schema, by full name
+}
+
+func newAvroCodec(codec *goavro.Codec) (*avroCodec, error) {
+	c := &avroCodec{codec: codec, names: map[string]interface{}{}}
+	if err := json.Unmarshal([]byte(codec.Schema()), &c.schema); err != nil {
+		return nil, fmt.Errorf("parsing the Avro schema: %w", err)
+	}
+	c.register(c.schema, "")
+	return c, nil
+}
+
+// document returns the document of a native Avro record.
+func (c *avroCodec) document(native interface{}) (map[string]interface{}, error) {
+	document, ok := c.convert(c.schema, "", native).(map[string]interface{})
+	if !ok {
+		return nil, errors.New("the Avro datum isn't a record")
+	}
+	return document, nil
+}
+
+// register records the named types defined in schema s, in namespace ns.
+func (c *avroCodec) register(s interface{}, ns string) {
+	switch s := s.(type) {
+	case []interface{}:
+		for _, member := range s {
+			c.register(member, ns)
+		}
+	case map[string]interface{}:
+		switch t := s["type"].(type) {
+		case string:
+			switch t {
+			case "record", "error", "enum", "fixed":
+				full := avroFullName(s, ns)
+				c.names[full] = s
+				if fields, ok := s["fields"].([]interface{}); ok {
+					for _, field := range fields {
+						if field, ok := field.(map[string]interface{}); ok {
+							c.register(field["type"], avroNamespace(full))
+						}
+					}
+				}
+			case "array":
+				c.register(s["items"], ns)
+			case "map":
+				c.register(s["values"], ns)
+			}
+		default:
+			c.register(t, ns)
+		}
+	}
+}
+
+// resolve returns the named type a name refers to in namespace ns, or nil
+// if it isn't one.
+func (c *avroCodec) resolve(name string, ns string) (interface{}, string) {
+	if s, ok := c.names[name]; ok {
+		return s, name
+	}
+	if ns != "" {
+		if s, ok := c.names[ns+"."+name]; ok {
+			return s, ns + "." + name
+		}
+	}
+	return nil, ""
+}
+
+// typeName returns the name by which goavro tells which member of a union
+// a value is: the full name of a named type, and the type of any other,
+// with its logical type.
+func (c *avroCodec) typeName(s interface{}, ns string) string {
+	switch s := s.(type) {
+	case string:
+		if _, full := c.resolve(s, ns); full != "" {
+			return full
+		}
+		return s
+	case map[string]interface{}:
+		t, _ := s["type"].(string)
+		switch t {
+		case "record", "error", "enum", "fixed":
+			return avroFullName(s, ns)
+		}
+		if logical, ok := s["logicalType"].(string); ok {
+			return t + "." + logical
+		}
+		return t
+	}
+	return ""
+}
+
+// convert returns the JSON value of v, a native value of schema s in
+// namespace ns: records and maps as objects, with null fields left out,
+// unions as the value of their member, and other values as leafValue does.
+func (c *avroCodec) convert(s interface{}, ns string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch s := s.(type) {
+	case string:
+		if named, full := c.resolve(s, ns); named != nil {
+			return c.convert(named, avroNamespace(full), v)
+		}
+	case []interface{}:
+		m, ok := v.(map[string]interface{})
+		if !ok || len(m) != 1 {
+			return avroLeafValue(v)
+		}
+		for key, value := range m {
+			for _, member := range s {
+				if c.typeName(member, ns) == key {
+					return c.convert(member, ns, value)
+				}
+			}
+			return avroLeafValue(value)
+		}
+	case map[string]interface{}:
+		switch t := s["type"].(type) {
+		case string:
+			switch t {
+			case "record", "error":
+				fields, _ := s["fields"].([]interface{})
+				values, _ := v.(map[string]interface{})
+				document := make(map[string]interface{}, len(fields))
+				childNs := avroNamespace(avroFullName(s, ns))
+				for _, field := range fields {
+					field, _ := field.(map[string]interface{})
+					name, _ := field["name"].(string)
+					if value := c.convert(field["type"], childNs, values[name]); value != nil {
+						document[name] = value
+					}
+				}
+				return document
+			case "array":
+				items, _ := v.([]interface{})
+				values := make([]interface{}, len(items))
+				for i, item := range items {
+					values[i] = c.convert(s["items"], ns, item)
+				}
+				return values
+			case "map":
+				entries, _ := v.(map[string]interface{})
+				values := make(map[string]interface{}, len(entries))
+				for key, value := range entries {
+					values[key] = c.convert(s["values"], ns, value)
+				}
+				return values
+			}
+			if s["logicalType"] == "decimal" {
+				if r, ok := v.(*big.Rat); ok {
+					scale, _ := s["scale"].(float64)
+					precision, _ := s["precision"].(float64)
+					return decimalNumber(r.FloatString(int(scale)), int(precision))
+				}
+			}
+		default:
+			return c.convert(t, ns, v)
+		}
+	}
+	return avroLeafValue(v)
+}
+
+// avroLeafValue returns the JSON value of a native Avro value: timestamps
+// and dates as RFC 3339 strings, times of day as HH:MM:SS, decimals as
+// numbers, floats and ints as float64 and int64, and bytes that aren't
+// text as base64.
+func avroLeafValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case time.Duration:
+		return time.Time{}.Add(v).Format("15:04:05.999999999")
+	case *big.Rat:
+		f, _ := v.Float64()
+		return f
+	case []byte:
+		if utf8.Valid(v) {
+			return string(v)
+		}
+		return base64.StdEncoding.EncodeToString(v)
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			values[key] = avroLeafValue(value)
+		}
+		return values
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, value := range v {
+			values[i] = avroLeafValue(value)
+		}
+		return values
+	}
+	return widenNumber(v)
+}
+
+// avroFullName returns the full name of the named type s defined in
+// namespace ns.
+func avroFullName(s map[string]interface{}, ns string) string {
+	name, _ := s["name"].(string)
+	if strings.Contains(name, ".") {
+		return name
+	}
+	if namespace, ok := s["namespace"].(string); ok {
+		ns = namespace
+	}
+	if ns == "" {
+		return name
+	}
+	return ns + "." + name
+}
+
+// avroNamespace returns the namespace of a full name.
+func avroNamespace(full string) string {
+	if i := strings.LastIndex(full, "."); i >= 0 {
+		return full[:i]
+	}
+	return ""
+}
+
+// schemaRegistry decodes messages framed as a schema registry's serializers
+// write them: a zero byte, the four-byte ID of the schema in the registry,
+// and the Avro encoding of the record. Schemas are fetched as they are
+// first needed.
+type schemaRegistry struct {
+	ctx    context.Context
+	url    string
+	codecs map[uint32]*avroCodec
+}
+
+func newSchemaRegistry(ctx context.Context, url string) *schemaRegistry {
+	return &schemaRegistry{ctx: ctx, url: strings.TrimSuffix(url, "/"), codecs: map[uint32]*avroCodec{}}
+}
+
+// document returns the document of a framed Avro message.
+func (r *schemaRegistry) document(value []byte) (map[string]interface{}, error) {
+	if len(value) < 5 || value[0] != 0 {
+		return nil, errors.New("the message isn't framed with a schema ID")
+	}
+	id := binary.BigEndian.Uint32(value[1:5])
+	codec, err := r.codec(id)
+	if err != nil {
+		return nil, fmt.Errorf("getting schema %d: %w", id, err)
+	}
+	native, _, err := codec.codec.NativeFromBinary(value[5:])
+	if err != nil {
+		return nil, fmt.Errorf("decoding Avro: %w", err)
+	}
+	return codec.document(native)
+}
+
+// codec returns the codec of the schema with the ID.
+func (r *schemaRegistry) codec(id uint32) (*avroCodec, error) {
+	if codec, ok := r.codecs[id]; ok {
+		return codec, nil
+	}
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, fmt.Sprintf("%s/schemas/ids/%d", r.url, id), nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", redactURL(r.url), res.Status)
+	}
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	codec, err := goavro.NewCodec(body.Schema)
+	if err != nil {
+		return nil, err
+	}
+	c, err := newAvroCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+	r.codecs[id] = c
+	return c, nil
+}
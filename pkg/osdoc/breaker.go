@@ -0,0 +1,191 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/opensearch-project/opensearch-go/opensearchtransport"
+)
+
+// defaultHealthInterval is how often the healthBreaker checks the cluster's
+// health, if HealthInterval isn't set.
+const defaultHealthInterval = 10 * time.Second
+
+// healthBreaker is a transport that holds bulk requests back while the
+// cluster is unhealthy: while its health is red, or yellow with
+// pauseOnYellow, or while its write thread pools reject more than
+// maxRejections requests a second. The health is checked periodically, and
+// the requests go on once it recovers. Other requests aren't held back.
+type healthBreaker struct {
+	client *opensearch.Client // The client to check the health with
+	next   opensearchtransport.Interface
+
+	pauseOnRed    bool
+	pauseOnYellow bool
+	maxRejections float64
+
+	mu       sync.Mutex
+	resumed  chan struct{} // While paused, closed when the load resumes
+	rejected int64         // The write rejections at the last check, or -1
+	checked  time.Time     // When rejected was read
+}
+
+// breakerClient returns a client that sends its requests with next's
+// transport, with bulk requests held back by a healthBreaker while the
+// cluster is unhealthy, and the breaker, whose health checks are sent with
+// client.
+func breakerClient(client *opensearch.Client, next *opensearch.Client, opts Options) (*opensearch.Client, *healthBreaker) {
+	breaker := &healthBreaker{
+		client:        client,
+		next:          next.Transport,
+		pauseOnRed:    opts.PauseOnRed,
+		pauseOnYellow: opts.PauseOnYellow,
+		maxRejections: opts.PauseRejections,
+		rejected:      -1,
+	}
+	return &opensearch.Client{Transport: breaker, API: opensearchapi.New(breaker)}, breaker
+}
+
+func (b *healthBreaker) Perform(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, "/_bulk") {
+		b.mu.Lock()
+		resumed := b.resumed
+		b.mu.Unlock()
+		if resumed != nil {
+			select {
+			case <-resumed:
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+	}
+	return b.next.Perform(req)
+}
+
+// checkEvery checks the cluster's health at once, and then every interval,
+// until ctx is done or stop is called; a check that fails leaves the load
+// as it was.
+func (b *healthBreaker) checkEvery(ctx context.Context, interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			checkCtx, cancel := context.WithTimeout(ctx, interval)
+			reason, err := b.check(checkCtx)
+			cancel()
+			if err != nil {
+				logWarnf("Error checking the cluster health: %s", err)
+			} else {
+				b.pause(reason)
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// pause holds the bulk requests back for the reason, or lets them go if
+// the reason is "".
+func (b *healthBreaker) pause(reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case reason != "" && b.resumed == nil:
+		logWarnf("Pausing the load: %s", reason)
+		b.resumed = make(chan struct{})
+	case reason == "" && b.resumed != nil:
+		logInfof("Resuming the load: the cluster has recovered")
+		close(b.resumed)
+		b.resumed = nil
+	}
+}
+
+// check returns why the load should be paused, or "" if it shouldn't.
+func (b *healthBreaker) check(ctx context.Context) (string, error) {
+	if b.pauseOnRed || b.pauseOnYellow {
+		res, err := opensearchapi.ClusterHealthRequest{}.Do(ctx, b.client)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		if err := ResponseError(res); err != nil {
+			return "", err
+		}
+		var health struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&health); err != nil {
+			return "", err
+		}
+		if health.Status == "red" || health.Status == "yellow" && b.pauseOnYellow {
+			return fmt.Sprintf("the cluster health is %s", health.Status), nil
+		}
+	}
+	if b.maxRejections > 0 {
+		rate, err := b.rejectionRate(ctx)
+		if err != nil {
+			return "", err
+		}
+		if rate > b.maxRejections {
+			return fmt.Sprintf("the write thread pools are rejecting %.1f requests a second", rate), nil
+		}
+	}
+	return "", nil
+}
+
+// rejectionRate returns the number of requests a second the write thread
+// pools of the cluster's nodes have rejected since the last check, or 0 at
+// the first.
+func (b *healthBreaker) rejectionRate(ctx context.Context) (float64, error) {
+	res, err := opensearchapi.NodesStatsRequest{Metric: []string{"thread_pool"}}.Do(ctx, b.client)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if err := ResponseError(res); err != nil {
+		return 0, err
+	}
+	var stats struct {
+		Nodes map[string]struct {
+			ThreadPool map[string]struct {
+				Rejected int64 `json:"rejected"`
+			} `json:"thread_pool"`
+		} `json:"nodes"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&stats); err != nil {
+		return 0, err
+	}
+	var rejected int64
+	for _, node := range stats.Nodes {
+		rejected += node.ThreadPool["write"].Rejected
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var rate float64
+	// the count falls when a node restarts
+	if b.rejected >= 0 && rejected >= b.rejected {
+		rate = float64(rejected-b.rejected) / now.Sub(b.checked).Seconds()
+	}
+	b.rejected, b.checked = rejected, now
+	return rate, nil
+}
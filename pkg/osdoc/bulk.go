@@ -0,0 +1,1240 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchutil"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Options holds the settings for a bulk load.
+type Options struct {
+	Index       string // The default index name, which may contain a date pattern
+	IndexField  string // A field giving the index for each document
+	DateField   string // A field giving the date for the index date pattern
+	Pipeline    string // An ingest pipeline to run the documents through
+	Action      string // index, create, update, or delete
+	ActionField string // A field giving the action for each document
+	Upsert      bool   // Create documents that don't exist when updating
+
+	Refresh             string // true, false, or wait_for, to make documents searchable
+	WaitForActiveShards string // The number of active shard copies each request waits for
+
+	Routing      string // A routing value for all documents
+	RoutingField string // A field giving the routing value of each document
+
+	VersionField string // A field giving the external version of each document
+	VersionType  string // external or external_gte
+	SkipExisting bool   // Don't count creates of existing documents as failures
+
+	IDField       string            // The fields (or dotted paths) holding the document ID, separated by commas
+	IDSeparator   string            // The separator between the parts of a composite ID
+	KeepID        bool              // Index the ID field along with the rest of the document
+	AutoID        bool              // Let OpenSearch assign IDs to documents without the ID field
+	HashID        bool              // Derive IDs of documents without the ID field from their content
+	Format        string            // json, csv, tsv, ids, parquet, avro, xml, or yaml
+	Types         map[string]string // Column types for csv/tsv input
+	Columns       []string          // The columns of parquet input to read; all of them if empty
+	RecordElement string            // The name of the elements of xml input that are documents
+	InferTypes    bool              // Infer types of csv/tsv columns without one
+	MaxLineBytes  int               // The longest JSON line to accept
+
+	Skip   int     // Documents to skip at the start of the input
+	Limit  int     // The most documents to index, if positive
+	Sample float64 // The fraction of documents to index, if between 0 and 1
+
+	Dedupe         string // first or last, to drop documents with duplicate IDs
+	DedupeApprox   bool   // Track IDs with a bloom filter
+	DedupeCapacity int    // The number of IDs to size the bloom filter for
+
+	Where          string   // A jq expression documents must satisfy to be indexed
+	Transform      string   // A jq expression applied to each document
+	Set            []string // key=value settings for fields of each document
+	Drop           []string // Fields to remove from each document
+	Rename         []string // old=new renamings of fields of each document
+	TimestampField string   // A field to set to the time each document is read
+
+	EmbedField     string // A text field to embed with the EmbedEndpoint
+	EmbedTarget    string // The field to set to the embedding of the EmbedField
+	EmbedEndpoint  string // The URL of an OpenAI-compatible embeddings API
+	EmbedModel     string // The model to ask the embeddings API for
+	EmbedAPIKey    string // A bearer token for the embeddings API
+	EmbedBatchSize int    // The number of documents to embed in each request
+	EmbedWorkers   int    // The number of embedding requests to make at once
+	EmbedRetries   int    // The most times to retry a failed embedding request
+
+	Workers       int           // The number of worker goroutines, or with AutoTune, the most
+	AutoTune      bool          // Adjust the number of concurrent bulk requests to the cluster's responses
+	FlushBytes    int           // The flush threshold in bytes
+	FlushInterval time.Duration // The periodic flush interval
+
+	MaxDocsPerSec  int  // The most documents to send per second, if positive
+	MaxBytesPerSec int  // The most document bytes to send per second, if positive
+	OptimizeLoad   bool // Turn off refresh and replicas on the index during the load
+
+	PauseOnRed      bool          // Hold bulk requests back while the cluster health is red
+	PauseOnYellow   bool          // Hold bulk requests back while the cluster health is yellow or red
+	PauseRejections float64       // Hold bulk requests back while the write thread pools reject more requests a second, if positive
+	HealthInterval  time.Duration // How often to check the cluster health for pausing
+
+	FailedOutput string // A file for documents that fail to index
+	MaxErrors    int    // Stop after this many failures, if positive
+
+	Checkpoint         string        // A file to record progress in
+	CheckpointInterval time.Duration // How often to write the checkpoint
+	Resume             bool          // Skip input recorded in the checkpoint
+
+	Schema          string // A JSON Schema file documents must match
+	DryRun          bool   // Validate the input without indexing it
+	ToFile          string // A file to write the bulk request bodies to, instead of sending them
+	ValidateMapping bool   // Check documents against the index mapping in a dry run
+}
+
+// BulkLoader loads documents into OpenSearch with a bulk indexer. The
+// documents are read from one or more inputs, changed and checked as the
+// Options say, and added to the indexer; Close flushes them and returns the
+// Stats of the load. Reading isn't safe for concurrent use, so inputs are
+// read one at a time.
+type BulkLoader struct {
+	opts        Options
+	idPaths     [][]string         // The keys of each ID field
+	routingPath []string           // The keys of the routing field, if any
+	versionPath []string           // The keys of the version field, if any
+	indexPath   []string           // The keys of the index field, if any
+	datePath    []string           // The keys of the date field, if any
+	schema      *jsonschema.Schema // The schema documents must match, if any
+	where       *transform         // The test documents must pass to be indexed, if any
+	transform   *transform         // The transform applied to each document, if any
+	reshape     *reshape           // The field changes made to each document, if any
+	docLimit    *tokenBucket
+	byteLimit   *tokenBucket
+	indexer     opensearchutil.BulkIndexer
+	failed      *deadLetterWriter
+	checkpoint  *checkpoint
+	optimizer   *loadOptimizer
+	sources     []DocumentSource // The sources loaded, to close
+
+	// Embeds the EmbedField of documents before they are added, if set;
+	// documents are added by its workers as well as by the reader, so
+	// adding them is serialized by addMu
+	embedder *embedder
+	addMu    sync.Mutex
+
+	// Stops saving the checkpoint periodically, if it is being saved
+	stopCheckpoint func()
+
+	// Stops checking the cluster health, if it is being checked
+	stopHealth func()
+
+	// The load's requests are made with ctx, which Cancel cancels, and it
+	// stops reading input once reading is done
+	ctx     context.Context
+	cancel  context.CancelFunc
+	reading context.Context
+	stop    context.CancelFunc
+
+	// The number of failed documents, of version conflicts that aren't
+	// failures, of creates of documents that already exist, and of failed
+	// bulk requests; updated atomically by the indexer's workers
+	failures      atomic.Int64
+	conflicts     atomic.Int64
+	existing      atomic.Int64
+	requestErrors atomic.Int64
+
+	// The number of failures of each error type
+	errorsMu   sync.Mutex
+	errorTypes map[string]int
+
+	// For dry runs, the mapping to check against, if any
+	mapping *indexMapping
+
+	// The number of valid records in a dry run, and of invalid records
+	valid, invalid atomic.Int64
+
+	// The number of records read, and of documents added, for --skip,
+	// --sample, and --limit
+	seen, added int
+	sample      *rand.Rand // The source of random samples, if sampling
+
+	// The number of documents skipped by --skip, --sample, --where, or
+	// --transform
+	skipped atomic.Int64
+
+	// For --dedupe: the IDs seen, or with --dedupe last, the last document
+	// with each ID in the order the IDs were first seen; and the number of
+	// duplicates dropped
+	seenIDs    idSet
+	held       map[string]heldDocument
+	heldOrder  []string
+	duplicates atomic.Int64
+}
+
+// NewBulkLoader returns a loader that indexes documents with client, or an
+// error if the options are invalid or the load can't be set up. A dry run
+// only uses the client to get the index mapping with ValidateMapping, and a
+// load with ToFile doesn't use it, so otherwise it may be nil. The requests
+// to the cluster, including those flushing the documents when the loader is
+// closed, are made with ctx; once it is done, the load stops and the
+// documents not yet sent are dropped.
+func NewBulkLoader(ctx context.Context, client *opensearch.Client, opts Options) (*BulkLoader, error) {
+	l := &BulkLoader{opts: opts, errorTypes: map[string]int{}}
+	if !validAction(opts.Action) {
+		return nil, fmt.Errorf("unknown action '%s'", opts.Action)
+	}
+	if (opts.AutoID || opts.HashID) && (opts.Action == "update" || opts.Action == "delete") {
+		return nil, fmt.Errorf("--auto-id and --hash-id can't be used with the %s action", opts.Action)
+	}
+	switch opts.Refresh {
+	case "", "true", "false", "wait_for":
+	default:
+		return nil, fmt.Errorf("--refresh must be true, false, or wait_for, not '%s'", opts.Refresh)
+	}
+	if opts.Sample < 0 || opts.Sample > 1 {
+		return nil, fmt.Errorf("--sample must be between 0 and 1")
+	}
+	if opts.Sample > 0 && opts.Sample < 1 {
+		l.sample = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	switch opts.Dedupe {
+	case "":
+	case "first":
+		if opts.DedupeApprox {
+			if opts.DedupeCapacity <= 0 {
+				return nil, fmt.Errorf("--dedupe-capacity must be positive")
+			}
+			l.seenIDs = newBloomIDSet(opts.DedupeCapacity)
+		} else {
+			l.seenIDs = exactIDSet{}
+		}
+	case "last":
+		if opts.DedupeApprox {
+			return nil, fmt.Errorf("--dedupe-approx can't be used with --dedupe last")
+		}
+		l.held = map[string]heldDocument{}
+	default:
+		return nil, fmt.Errorf("--dedupe must be first or last, not '%s'", opts.Dedupe)
+	}
+	if opts.Schema != "" {
+		var err error
+		l.schema, err = compileSchema(opts.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("reading the schema: %w", err)
+		}
+	}
+	if opts.Where != "" {
+		var err error
+		l.where, err = newTransform(opts.Where)
+		if err != nil {
+			return nil, fmt.Errorf("parsing the where expression: %w", err)
+		}
+	}
+	if opts.Transform != "" {
+		var err error
+		l.transform, err = newTransform(opts.Transform)
+		if err != nil {
+			return nil, fmt.Errorf("parsing the transform: %w", err)
+		}
+	}
+	var err error
+	l.reshape, err = newReshape(opts.Rename, opts.Drop, opts.Set, opts.TimestampField)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range strings.Split(opts.IDField, ",") {
+		l.idPaths = append(l.idPaths, SplitFieldPath(field))
+	}
+	if opts.Format == "ids" && (opts.Action != "delete" || len(l.idPaths) != 1) {
+		return nil, fmt.Errorf("--format ids needs --action delete and a single ID field")
+	}
+	if opts.Format == "xml" && opts.RecordElement == "" {
+		return nil, fmt.Errorf("--format xml needs a --record-element")
+	}
+	if (opts.EmbedField != "" || opts.EmbedTarget != "" || opts.EmbedEndpoint != "") &&
+		(opts.EmbedField == "" || opts.EmbedTarget == "" || opts.EmbedEndpoint == "") {
+		return nil, fmt.Errorf("--embed-field, --embed-target, and --embed-endpoint must be given together")
+	}
+	if opts.EmbedField != "" && opts.Action == "delete" {
+		return nil, fmt.Errorf("--embed-field can't be used with the delete action")
+	}
+	if opts.RoutingField != "" {
+		l.routingPath = SplitFieldPath(opts.RoutingField)
+	}
+	if opts.VersionField != "" {
+		if opts.VersionType != "external" && opts.VersionType != "external_gte" {
+			return nil, fmt.Errorf("--version-type must be external or external_gte, not '%s'", opts.VersionType)
+		}
+		if opts.Action == "update" {
+			return nil, fmt.Errorf("--version-field can't be used with the update action")
+		}
+		l.versionPath = SplitFieldPath(opts.VersionField)
+	}
+	l.ctx, l.cancel = context.WithCancel(ctx)
+	l.reading, l.stop = context.WithCancel(l.ctx)
+	l.docLimit = newTokenBucket(float64(opts.MaxDocsPerSec))
+	l.byteLimit = newTokenBucket(float64(opts.MaxBytesPerSec))
+	if opts.IndexField != "" {
+		l.indexPath = SplitFieldPath(opts.IndexField)
+	}
+	if opts.DateField != "" {
+		l.datePath = SplitFieldPath(opts.DateField)
+	}
+	if opts.DryRun {
+		if opts.ValidateMapping {
+			l.mapping, err = getIndexMapping(l.ctx, client, indexPatternWildcard(opts.Index))
+			if err != nil {
+				return nil, fmt.Errorf("getting the index mapping: %w", err)
+			}
+		}
+		return l, nil
+	}
+	if err := l.start(client); err != nil {
+		l.failed.Close()
+		l.cancel()
+		return nil, err
+	}
+	if opts.EmbedField != "" {
+		l.embedder = newEmbedder(l.ctx, opts, l.addEmbedded)
+	}
+	return l, nil
+}
+
+// start sets up the indexing: the checkpoint, the failed output file, the
+// index settings for OptimizeLoad, and the indexer, or the file the bulk
+// requests are written to with ToFile.
+func (l *BulkLoader) start(client *opensearch.Client) error {
+	opts := l.opts
+	var err error
+	if opts.Checkpoint != "" {
+		l.checkpoint, err = newCheckpoint(opts.Checkpoint, opts.Resume)
+		if err != nil {
+			return fmt.Errorf("reading the checkpoint file: %w", err)
+		}
+	}
+	if opts.FailedOutput != "" {
+		l.failed, err = newDeadLetterWriter(opts.FailedOutput, opts.Resume)
+		if err != nil {
+			return fmt.Errorf("creating the failed output file: %w", err)
+		}
+	}
+	if opts.OptimizeLoad && opts.ToFile != "" {
+		return fmt.Errorf("--optimize-load needs a cluster, and can't be used with --to-file")
+	}
+	if opts.OptimizeLoad {
+		l.optimizer, err = optimizeLoad(l.ctx, client, indexPatternWildcard(opts.Index))
+		if err != nil {
+			return fmt.Errorf("turning off refresh and replicas: %w", err)
+		}
+		if l.optimizer == nil {
+			logWarnf("No index matches [%s] yet; not optimizing the load", opts.Index)
+		} else {
+			logInfof("Turned off refresh and replicas on %v until the load ends", l.optimizer.indices())
+		}
+	}
+	// A date pattern isn't an index name, so every item names its own index
+	defaultIndex := opts.Index
+	if isIndexPattern(defaultIndex) {
+		defaultIndex = ""
+	}
+	if opts.ToFile != "" {
+		l.indexer, err = newBulkFileWriter(opts.ToFile, defaultIndex, opts.Pipeline)
+		if err != nil {
+			return fmt.Errorf("creating the bulk output file: %w", err)
+		}
+		if l.checkpoint != nil {
+			l.stopCheckpoint = l.checkpoint.saveEvery(opts.CheckpointInterval)
+		}
+		return nil
+	}
+	healthClient := client
+	// With AutoTune, each worker waits for the tuner to let its request go
+	workers := opts.Workers
+	if opts.AutoTune {
+		if workers <= 0 {
+			workers = maxAutoTuneWorkers
+		}
+		client = autoTuneClient(client, workers)
+	}
+	// The breaker holds requests back before the tuner counts them, and
+	// checks the health with the client as it was given
+	if opts.PauseOnRed || opts.PauseOnYellow || opts.PauseRejections > 0 {
+		interval := opts.HealthInterval
+		if interval <= 0 {
+			interval = defaultHealthInterval
+		}
+		var breaker *healthBreaker
+		client, breaker = breakerClient(healthClient, client, opts)
+		l.stopHealth = breaker.checkEvery(l.ctx, interval)
+	}
+	// Create the indexer
+	//
+	l.indexer = newBulkIndexer(l.ctx, opensearchutil.BulkIndexerConfig{
+		Client:              client,                   // The OpenSearch client
+		Index:               defaultIndex,             // The default index name
+		Pipeline:            opts.Pipeline,            // The default ingest pipeline
+		Refresh:             opts.Refresh,             // Whether to refresh after each request
+		WaitForActiveShards: opts.WaitForActiveShards, // The active shard copies to wait for
+		NumWorkers:          workers,                  // The number of worker goroutines (default: number of CPUs)
+		FlushBytes:          opts.FlushBytes,          // The flush threshold in bytes (default: 5M)
+		FlushInterval:       opts.FlushInterval,       // The periodic flush interval (default: 30s)
+		OnError: func(ctx context.Context, err error) { // Called for each failed bulk request
+			logErrorf("Error sending a bulk request: %s", err)
+			l.requestErrors.Add(1)
+		},
+	})
+	logDebugf("indexer created")
+	if l.checkpoint != nil {
+		l.stopCheckpoint = l.checkpoint.saveEvery(opts.CheckpointInterval)
+	}
+	return nil
+}
+
+// Stop stops the load: no more documents are read, though those already
+// read are still indexed when the loader is closed. It is safe to call from
+// any goroutine, for example on an interrupt.
+func (l *BulkLoader) Stop() {
+	l.stop()
+}
+
+// Cancel cancels the load: like Stop, but the documents not yet sent are
+// dropped, and any requests in progress are abandoned. It is safe to call
+// from any goroutine, for example on a second interrupt.
+func (l *BulkLoader) Cancel() {
+	l.cancel()
+}
+
+// Context returns a context that is done once the load is stopped, for
+// reading its input with.
+func (l *BulkLoader) Context() context.Context {
+	return l.reading
+}
+
+// Stopped reports whether the load has been stopped, by Stop or Cancel, by
+// reaching the Limit or MaxErrors, or by its context being done.
+func (l *BulkLoader) Stopped() bool {
+	return l.reading.Err() != nil
+}
+
+// Close adds any documents held back by Dedupe last, flushes the documents
+// to the cluster, closes the sources loaded, restores the index settings
+// changed by OptimizeLoad, and saves the failed output file and the
+// checkpoint. It returns the Stats of the load, and the first error in
+// winding it up.
+func (l *BulkLoader) Close() (Stats, error) {
+	var firstErr error
+	keep := func(what string, err error) {
+		if err == nil {
+			return
+		}
+		if firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", what, err)
+		} else {
+			logErrorf("Error %s: %s", what, err)
+		}
+	}
+	keep("adding the held documents", l.addHeld())
+	l.embedder.close()
+	if l.indexer != nil {
+		// Close the indexer channel and flush remaining items
+		//
+		keep("flushing the documents", l.indexer.Close(l.ctx))
+	}
+	if l.stopHealth != nil {
+		l.stopHealth()
+	}
+	if l.stopCheckpoint != nil {
+		l.stopCheckpoint()
+	}
+	for _, src := range l.sources {
+		keep("closing the input", src.Close())
+	}
+	keep("restoring the index settings", l.restore())
+	keep("writing the failed output file", l.failed.Close())
+	keep("writing the checkpoint file", l.checkpoint.save())
+	l.cancel()
+	return l.Stats(), firstErr
+}
+
+// restoreTimeout is how long restoring the index settings changed by
+// OptimizeLoad may take.
+const restoreTimeout = time.Minute
+
+// restore restores the index settings changed by OptimizeLoad. It doesn't
+// use the load's context, since the settings are restored even when the
+// load is cancelled or times out.
+func (l *BulkLoader) restore() error {
+	ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+	defer cancel()
+	return l.optimizer.restore(ctx)
+}
+
+// Stats counts what has happened to the documents of a load.
+type Stats struct {
+	Flushed  uint64 // Documents the cluster indexed, created, updated, or deleted successfully
+	Failed   uint64 // Documents that failed, including those rejected before being sent
+	Indexed  uint64 // Documents indexed
+	Created  uint64 // Documents created
+	Updated  uint64 // Documents updated
+	Deleted  uint64 // Documents deleted
+	Requests uint64 // Bulk requests sent
+
+	RequestErrors int64 // Bulk requests that failed outright
+	Valid         int64 // Documents found valid in a dry run
+	Rejected      int64 // Documents rejected before being sent, as unparseable or invalid
+	Skipped       int64 // Documents left out by Skip, Sample, Where, or Transform
+	Duplicates    int64 // Documents dropped by Dedupe
+	Conflicts     int64 // Version conflicts with VersionField, which aren't failures
+	Existing      int64 // Creates of documents that already existed
+
+	Errors map[string]int // The number of failures of each error type
+}
+
+// Stats returns the Stats of the load so far. It is safe to call from any
+// goroutine, for example to report progress.
+func (l *BulkLoader) Stats() Stats {
+	var stats opensearchutil.BulkIndexerStats
+	if l.indexer != nil {
+		stats = l.indexer.Stats()
+	}
+	s := Stats{
+		Flushed:       stats.NumFlushed,
+		Indexed:       stats.NumIndexed,
+		Created:       stats.NumCreated,
+		Updated:       stats.NumUpdated,
+		Deleted:       stats.NumDeleted,
+		Requests:      stats.NumRequests,
+		RequestErrors: l.requestErrors.Load(),
+		Valid:         l.valid.Load(),
+		Rejected:      l.invalid.Load(),
+		Skipped:       l.skipped.Load(),
+		Duplicates:    l.duplicates.Load(),
+		Conflicts:     l.conflicts.Load(),
+		Existing:      l.existing.Load(),
+		Errors:        l.errorCounts(),
+	}
+	// version conflicts, and existing documents with SkipExisting, aren't
+	// failures
+	s.Failed = stats.NumFailed + uint64(s.Rejected) - uint64(s.Conflicts)
+	if l.opts.SkipExisting {
+		s.Failed -= uint64(s.Existing)
+	}
+	return s
+}
+
+// Load adds each document from src to the indexer, until there are no more
+// or the load is stopped. An input of src that can't be read is logged, and
+// the load goes on with the next one. The loader closes src when it is
+// closed, once the documents read from it have been flushed, so that an
+// Acknowledger can commit its position then.
+func (l *BulkLoader) Load(src DocumentSource) error {
+	l.sources = append(l.sources, src)
+	if a, ok := src.(Acknowledger); ok {
+		// the records handled are tracked by the checkpoint, which only
+		// needs a file to be saved
+		if l.checkpoint == nil {
+			l.checkpoint, _ = newCheckpoint("", false)
+		}
+		l.checkpoint.handled = a.Handled
+	}
+	adders := map[string]AddFunc{}
+	for !l.Stopped() {
+		doc, err := src.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			logErrorf("Error reading input: %s", err)
+			continue
+		}
+		if r, ok := src.(restarter); ok && r.restarted(doc.Source) {
+			// the input started over, so its records are numbered afresh
+			delete(adders, doc.Source)
+			l.checkpoint.restart(doc.Source)
+		}
+		add, ok := adders[doc.Source]
+		if !ok {
+			add = l.Adder(doc.Source)
+			adders[doc.Source] = add
+		}
+		if err := add(doc.Line, doc.Fields); err != nil {
+			if err == ErrStopped {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// restarter is a DocumentSource whose inputs may start over, as a watched
+// file does when it is truncated.
+type restarter interface {
+	restarted(name string) bool
+}
+
+// Read adds each document read from r, which may be compressed, to the
+// indexer. The name is used to report which input an error came from, and
+// to resume from the checkpoint; each input needs a different one.
+func (l *BulkLoader) Read(name string, r io.Reader) error {
+	err := l.Parse(name, r, l.Adder(name))
+	if err == ErrStopped {
+		return nil
+	}
+	return err
+}
+
+// Parse is the Parser for the loader's Format: it calls add with each
+// record read from r, which may be compressed.
+func (l *BulkLoader) Parse(name string, r io.Reader, add AddFunc) error {
+	r, closeReader, err := decompress(r)
+	if err != nil {
+		return fmt.Errorf("decompressing: %w", err)
+	}
+	defer closeReader()
+	// Deleting only needs IDs, which can come as a one-column CSV or a
+	// plain list
+	deleting := l.opts.Action == "delete" && len(l.idPaths) == 1
+	switch l.opts.Format {
+	case "csv", "tsv":
+		comma := ','
+		if l.opts.Format == "tsv" {
+			comma = '\t'
+		}
+		if deleting {
+			add = idColumn(add, l.idPaths[0])
+		}
+		return readDelimited(r, comma, l.opts.Types, l.opts.InferTypes, name, add)
+	case "parquet":
+		return readParquet(r, l.opts.Columns, name, add)
+	case "avro":
+		return readAvro(r, name, add)
+	case "xml":
+		return readXML(r, l.opts.RecordElement, name, add)
+	case "yaml":
+		return readYAML(r, name, add)
+	}
+	br := bufio.NewReaderSize(r, 64*1024)
+	switch {
+	case l.opts.Format == "ids" || deleting && isIDList(br):
+		return readIDLines(br, l.idPaths[0], name, add)
+	case isJSONStream(br):
+		return readJSONStream(br, name, add)
+	}
+	return ReadJSONLines(br, l.opts.MaxLineBytes, name, add)
+}
+
+// Adder returns the AddFunc for the named input, which adds each document
+// to the indexer, for inputs Parse can't parse. Records are numbered as they
+// are read, so the checkpoint can record how many of each input have been
+// handled.
+func (l *BulkLoader) Adder(name string) AddFunc {
+	skip := l.checkpoint.resumeFrom(name)
+	if skip > 0 {
+		logInfof("%s: Resuming after %d records", name, skip)
+	}
+	record := 0
+	return func(line int, document map[string]interface{}) error {
+		if l.reading.Err() != nil {
+			return ErrStopped
+		}
+		record++
+		if record <= skip {
+			return nil
+		}
+		// --skip and --sample count across all of the inputs
+		l.seen++
+		if l.seen <= l.opts.Skip || (l.sample != nil && l.sample.Float64() >= l.opts.Sample) {
+			l.skip(name, record)
+			return nil
+		}
+		if document == nil {
+			l.reject(name, record)
+			return nil
+		}
+		if l.where != nil {
+			ok, err := l.where.test(document)
+			if err != nil {
+				logErrorf("%s:%d: Error testing document: %s; not adding", name, line, err)
+				l.reject(name, record)
+				return nil
+			}
+			if !ok {
+				l.skip(name, record)
+				return nil
+			}
+		}
+		documents := []map[string]interface{}{document}
+		if l.transform != nil {
+			var err error
+			documents, err = l.transform.apply(document)
+			if err != nil {
+				logErrorf("%s:%d: Error transforming document: %s; not adding", name, line, err)
+				l.reject(name, record)
+				return nil
+			}
+			if len(documents) == 0 {
+				l.skip(name, record)
+				return nil
+			}
+			l.checkpoint.split(name, record, len(documents))
+		}
+		for _, document := range documents {
+			if l.reshape != nil {
+				l.reshape.apply(document)
+			}
+			if l.dedupe(name, line, record, document) {
+				continue
+			}
+			if err := l.queue(name, line, record, document); err != nil {
+				// a cancelled load ends like a stopped one; Close reports why
+				if l.ctx.Err() != nil {
+					return ErrStopped
+				}
+				return err
+			}
+			l.added++
+		}
+		if l.opts.Limit > 0 && l.added >= l.opts.Limit {
+			logInfof("Stopping after %d documents", l.added)
+			l.stop()
+		}
+		return nil
+	}
+}
+
+// AddFunc is called by the input readers once for each record read, with
+// a nil document for a record that couldn't be parsed. The readers stop and
+// return the error if it returns one.
+type AddFunc func(line int, document map[string]interface{}) error
+
+// ErrStopped is returned by an AddFunc when the load has been stopped.
+var ErrStopped = errors.New("stopped")
+
+// ReadJSONLines calls add with each JSON object read from r, one per line.
+// Lines longer than maxLineBytes are skipped.
+func ReadJSONLines(r io.Reader, maxLineBytes int, name string, add AddFunc) error {
+	return readJSONLinesAfter(r, maxLineBytes, name, 0, add)
+}
+
+// readJSONLinesAfter is ReadJSONLines for input that follows the first
+// lines of name, such as lines appended to a file.
+func readJSONLinesAfter(r io.Reader, maxLineBytes int, name string, lines int, add AddFunc) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	line := lines
+	for {
+		text, err := readLine(reader, maxLineBytes)
+		if err == io.EOF {
+			return nil
+		}
+		line++
+		if err == errLineTooLong {
+			logErrorf("%s:%d: line is longer than %d bytes; not adding", name, line, maxLineBytes)
+			if err := add(line, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var f interface{}
+		err = json.Unmarshal(text, &f)
+		if err != nil {
+			logErrorf("%s:%d: Error unmarshalling JSON: %s", name, line, err)
+			if err := add(line, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		documentMap, ok := f.(map[string]interface{})
+		if !ok {
+			logErrorf("%s:%d: line is not a JSON object; not adding", name, line)
+			if err := add(line, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := add(line, documentMap); err != nil {
+			return err
+		}
+	}
+}
+
+// errLineTooLong is returned by readLine for a line that is too long.
+var errLineTooLong = errors.New("line too long")
+
+// readLine reads a line from r, without its line ending. A line longer
+// than max bytes is read to its end and discarded, and errLineTooLong is
+// returned, so the next read starts at the following line.
+func readLine(r *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			// allow for a \r\n line ending
+			tooLong = len(line) > max+2
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if tooLong || len(line) > max {
+		return nil, errLineTooLong
+	}
+	return line, nil
+}
+
+// queue adds a document to the indexer, first embedding its EmbedField
+// if it has one and the load embeds documents.
+func (l *BulkLoader) queue(name string, line int, record int, document map[string]interface{}) error {
+	if l.embedder == nil {
+		return l.add(name, line, record, document)
+	}
+	text, ok, err := l.embedder.text(document)
+	if err != nil {
+		logErrorf("%s:%d: %s; not adding", name, line, err)
+		l.reject(name, record)
+		return nil
+	}
+	if ok {
+		l.embedder.put(embedItem{name: name, line: line, record: record, document: document, text: text})
+		return nil
+	}
+	l.addMu.Lock()
+	defer l.addMu.Unlock()
+	return l.add(name, line, record, document)
+}
+
+// addEmbedded adds a document whose embedding has been set, or counts it as
+// failed if the embedding couldn't be made. It is called by the embedder's
+// workers.
+func (l *BulkLoader) addEmbedded(item embedItem, err error) {
+	if err != nil {
+		reason := "embedding: " + err.Error()
+		logErrorf("%s:%d: %s; not adding", item.name, item.line, reason)
+		if l.failed != nil {
+			original, _ := json.Marshal(item.document)
+			l.failed.Write(failedDocument{
+				Source:   item.name,
+				Line:     item.line,
+				Error:    reason,
+				Document: original,
+			})
+		}
+		l.invalid.Add(1)
+		l.checkpoint.done(item.name, item.record)
+		l.failure("embedding_error")
+		return
+	}
+	l.addMu.Lock()
+	defer l.addMu.Unlock()
+	if err := l.add(item.name, item.line, item.record, item.document); err != nil && l.ctx.Err() == nil {
+		logErrorf("%s:%d: Error adding document: %s", item.name, item.line, err)
+	}
+}
+
+// add adds a single document to the indexer, using the ID field for its
+// document ID. The record is the document's position in its input.
+func (l *BulkLoader) add(name string, line int, record int, documentMap map[string]interface{}) error {
+	// get the document Id from the JSON object using the idField
+	idString, missing := l.documentID(documentMap)
+	generated := missing != ""
+	if generated && !l.opts.AutoID && !l.opts.HashID {
+		logErrorf("%s:%d: document does not contain an value for the idField '%s'; not adding", name, line, missing)
+		l.reject(name, record)
+		return nil
+	}
+	// take the action from the action field, if there is one
+	action := l.opts.Action
+	if l.opts.ActionField != "" {
+		if value, ok := documentMap[l.opts.ActionField]; ok {
+			action = fmt.Sprintf("%v", value)
+			delete(documentMap, l.opts.ActionField)
+		}
+	}
+	if !validAction(action) {
+		logErrorf("%s:%d: unknown action '%s'; not adding", name, line, action)
+		l.reject(name, record)
+		return nil
+	}
+	if generated && (action == "update" || action == "delete") {
+		logErrorf("%s:%d: the %s action needs a value for the idField '%s'; not adding", name, line, action, missing)
+		l.reject(name, record)
+		return nil
+	}
+	index, err := l.documentIndex(documentMap)
+	if err != nil {
+		logErrorf("%s:%d: %s; not adding", name, line, err)
+		l.reject(name, record)
+		return nil
+	}
+	// keep the original document for the failed output file
+	var original []byte
+	if l.failed != nil {
+		original, _ = json.Marshal(documentMap)
+	}
+	// check the document against the schema before changing it
+	if l.schema != nil {
+		if problems := schemaProblems(l.schema, documentMap); problems != nil {
+			reason := strings.Join(problems, "; ")
+			logErrorf("%s:%d: document does not match the schema: %s; not adding", name, line, reason)
+			l.failed.Write(failedDocument{
+				Source:   name,
+				Line:     line,
+				Error:    "schema: " + reason,
+				Document: original,
+			})
+			l.reject(name, record)
+			return nil
+		}
+	}
+	// remove the id fields from the JSON object
+	if !l.opts.KeepID && !generated {
+		for _, path := range l.idPaths {
+			deleteField(documentMap, path)
+		}
+	}
+	if l.opts.DryRun {
+		l.validate(name, line, documentMap)
+		return nil
+	}
+	// marshal the JSON object back to a byte array; updates send it as a
+	// partial document
+	var document []byte
+	if action == "update" {
+		document, err = json.Marshal(updateBody{Doc: documentMap, DocAsUpsert: l.opts.Upsert})
+	} else {
+		document, err = json.Marshal(documentMap)
+	}
+	if err != nil {
+		logErrorf("%s:%d: Error marshalling JSON: %s", name, line, err)
+		l.reject(name, record)
+		return nil
+	}
+	// derive a missing id from the content, so reloading is idempotent;
+	// otherwise, with --auto-id, OpenSearch assigns one
+	if generated && l.opts.HashID {
+		sum := sha256.Sum256(document)
+		idString = hex.EncodeToString(sum[:])
+	}
+	// route by the routing field, if there is one, or the static routing
+	var routing *string
+	if l.opts.Routing != "" {
+		routing = &l.opts.Routing
+	}
+	if l.routingPath != nil {
+		if value := LookupField(documentMap, l.routingPath); value != nil {
+			r := fmt.Sprintf("%v", value)
+			routing = &r
+		}
+	}
+	// with external versioning, only index and delete take a version
+	var version *int64
+	var versionType *string
+	if l.versionPath != nil && (action == "index" || action == "delete") {
+		v, err := versionNumber(LookupField(documentMap, l.versionPath))
+		if err != nil {
+			logErrorf("%s:%d: %s; not adding", name, line, err)
+			l.reject(name, record)
+			return nil
+		}
+		version, versionType = &v, &l.opts.VersionType
+	}
+	// Deletes have no body
+	var body io.ReadSeeker
+	if action != "delete" {
+		body = strings.NewReader(string(document))
+	}
+	return l.send(name, line, record, opensearchutil.BulkIndexerItem{
+		// Action field configures the operation to perform (index, create, delete, update)
+		Action: action,
+
+		// Index is the document's index, if it isn't the default index
+		Index: index,
+
+		// DocumentID is the optional document ID
+		DocumentID: idString,
+
+		// Routing is the optional shard routing value
+		Routing: routing,
+
+		// Version and VersionType are the optional external version
+		Version:     version,
+		VersionType: versionType,
+
+		// Body is the document, converted to a readable byte array
+		Body: body,
+	}, len(document), original)
+}
+
+// send adds an item of the named input to the indexer, once the rate limits
+// allow it, with callbacks that mark the record as handled when it has been
+// flushed, and count its failure and write the original document to the
+// failed output file if it fails. The size is the length of its body.
+func (l *BulkLoader) send(name string, line int, record int, item opensearchutil.BulkIndexerItem, size int, original []byte) error {
+	// throttle, so a large load doesn't crowd out other traffic
+	l.docLimit.wait(1)
+	l.byteLimit.wait(size)
+	// OnSuccess is the optional callback for each successful operation
+	item.OnSuccess = func(
+		ctx context.Context,
+		item opensearchutil.BulkIndexerItem,
+		res opensearchutil.BulkIndexerResponseItem,
+	) {
+		l.checkpoint.done(name, record)
+	}
+	// OnFailure is the optional callback for each failed operation
+	item.OnFailure = func(
+		ctx context.Context,
+		item opensearchutil.BulkIndexerItem,
+		res opensearchutil.BulkIndexerResponseItem, err error,
+	) {
+		// a stale change under external versioning is expected
+		if err == nil && res.Status == 409 && item.Version != nil {
+			logDebugf("%s:%d: version conflict: %s", name, line, res.Error.Reason)
+			l.conflicts.Add(1)
+			l.checkpoint.done(name, record)
+			return
+		}
+		if err == nil && res.Status == 409 && item.Action == "create" {
+			l.existing.Add(1)
+			if l.opts.SkipExisting {
+				logDebugf("%s:%d: document already exists", name, line)
+				l.checkpoint.done(name, record)
+				return
+			}
+		}
+		var reason string
+		errorType := res.Error.Type
+		if err != nil {
+			reason = err.Error()
+			errorType = "request_error"
+		} else {
+			reason = fmt.Sprintf("%s: %s", res.Error.Type, res.Error.Reason)
+		}
+		logErrorf("%s:%d: %s", name, line, reason)
+		l.failed.Write(failedDocument{
+			Source:   name,
+			Line:     line,
+			Status:   res.Status,
+			Error:    reason,
+			Document: original,
+		})
+		l.checkpoint.done(name, record)
+		l.failure(errorType)
+	}
+	return l.indexer.Add(l.ctx, item)
+}
+
+// documentIndex returns the index for a document: the value of the index
+// field, if there is one, or the default index, with any date pattern
+// expanded using the date field. It returns "" for the default index.
+func (l *BulkLoader) documentIndex(documentMap map[string]interface{}) (string, error) {
+	index := l.opts.Index
+	if l.indexPath != nil {
+		if value := LookupField(documentMap, l.indexPath); value != nil {
+			index = fmt.Sprintf("%v", value)
+		}
+	}
+	if !isIndexPattern(index) {
+		if index == l.opts.Index {
+			return "", nil
+		}
+		return index, nil
+	}
+	// without a date field, documents go to the index for the current time
+	t := time.Now()
+	if l.datePath != nil {
+		value := LookupField(documentMap, l.datePath)
+		if value == nil {
+			return "", fmt.Errorf("document does not contain a value for the date field '%s'", l.opts.DateField)
+		}
+		var err error
+		t, err = parseDocumentTime(value)
+		if err != nil {
+			return "", err
+		}
+	}
+	return expandIndexPattern(index, t)
+}
+
+// updateBody is the body of an update action.
+type updateBody struct {
+	Doc         map[string]interface{} `json:"doc"`
+	DocAsUpsert bool                   `json:"doc_as_upsert,omitempty"`
+}
+
+// dedupe handles a document with --dedupe, and reports whether it has been
+// dealt with: dropped as a duplicate, or held back until the end of the
+// input in case a later document has the same ID.
+func (l *BulkLoader) dedupe(name string, line int, record int, document map[string]interface{}) bool {
+	if l.opts.Dedupe == "" {
+		return false
+	}
+	id, missing := l.documentID(document)
+	if missing != "" {
+		return false
+	}
+	if l.held != nil {
+		if previous, ok := l.held[id]; ok {
+			l.duplicate(previous.name, previous.record)
+		} else {
+			l.heldOrder = append(l.heldOrder, id)
+		}
+		l.held[id] = heldDocument{name: name, line: line, record: record, document: document}
+		return true
+	}
+	if l.seenIDs.add(id) {
+		l.duplicate(name, record)
+		return true
+	}
+	return false
+}
+
+// addHeld adds the documents held back by --dedupe last.
+func (l *BulkLoader) addHeld() error {
+	for _, id := range l.heldOrder {
+		if l.opts.Limit > 0 && l.added >= l.opts.Limit {
+			return nil
+		}
+		held := l.held[id]
+		if err := l.queue(held.name, held.line, held.record, held.document); err != nil {
+			return err
+		}
+		l.added++
+	}
+	return nil
+}
+
+// duplicate counts a document dropped by --dedupe, and marks it as handled.
+func (l *BulkLoader) duplicate(name string, record int) {
+	l.duplicates.Add(1)
+	l.checkpoint.done(name, record)
+}
+
+// skip counts a record that is deliberately left out, and marks it as
+// handled.
+func (l *BulkLoader) skip(name string, record int) {
+	l.skipped.Add(1)
+	l.checkpoint.done(name, record)
+}
+
+// reject counts a record that won't be indexed, and marks it as handled.
+func (l *BulkLoader) reject(name string, record int) {
+	l.invalid.Add(1)
+	l.checkpoint.done(name, record)
+	l.failure("invalid_document")
+}
+
+// errorCounts returns a copy of the number of failures of each error type.
+func (l *BulkLoader) errorCounts() map[string]int {
+	l.errorsMu.Lock()
+	defer l.errorsMu.Unlock()
+	counts := make(map[string]int, len(l.errorTypes))
+	for errorType, n := range l.errorTypes {
+		counts[errorType] = n
+	}
+	return counts
+}
+
+// failure counts a document that couldn't be indexed because of an error
+// of the given type, and stops the load once there have been --max-errors
+// of them.
+func (l *BulkLoader) failure(errorType string) {
+	l.errorsMu.Lock()
+	l.errorTypes[errorType]++
+	l.errorsMu.Unlock()
+	n := l.failures.Add(1)
+	if l.opts.MaxErrors > 0 && n == int64(l.opts.MaxErrors) {
+		logWarnf("Stopping after %d errors", n)
+		l.stop()
+	}
+}
+
+// validAction reports whether action is a bulk action.
+func validAction(action string) bool {
+	switch action {
+	case "index", "create", "update", "delete":
+		return true
+	}
+	return false
+}
+
+// documentID returns the document ID built from the ID fields of
+// documentMap, coercing each part to a string. If an ID field is missing,
+// its path is returned instead.
+func (l *BulkLoader) documentID(documentMap map[string]interface{}) (id string, missing string) {
+	parts := make([]string, len(l.idPaths))
+	for i, path := range l.idPaths {
+		value := LookupField(documentMap, path)
+		if value == nil {
+			return "", strings.Join(path, ".")
+		}
+		parts[i] = fmt.Sprintf("%v", value)
+	}
+	return strings.Join(parts, l.opts.IDSeparator), ""
+}
+
+// validate checks a document in a dry run against the index mapping, if
+// there is one, and counts it as valid or invalid.
+func (l *BulkLoader) validate(name string, line int, documentMap map[string]interface{}) {
+	if l.mapping != nil {
+		if problems := l.mapping.check(documentMap); len(problems) > 0 {
+			for _, problem := range problems {
+				logErrorf("%s:%d: %s", name, line, problem)
+			}
+			l.invalid.Add(1)
+			return
+		}
+	}
+	l.valid.Add(1)
+}
+
+// versionNumber converts the value of a version field to a version number.
+func versionNumber(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v), nil
+		}
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case string:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, nil
+		}
+	case nil:
+		return 0, fmt.Errorf("document has no version field")
+	}
+	return 0, fmt.Errorf("can't use %v as a version number", value)
+}
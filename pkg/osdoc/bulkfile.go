@@ -0,0 +1,125 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/opensearch-project/opensearch-go/opensearchutil"
+)
+
+// bulkFileWriter is a BulkIndexer that writes the body of the bulk requests
+// to a file instead of sending them: for each item, its action and metadata
+// line, then its document line unless it is a delete. The file can be sent
+// later with a POST to /_bulk. Each item succeeds once it is written, so
+// the checkpoint and Stats count it as flushed.
+type bulkFileWriter struct {
+	index    string // The default index
+	pipeline string // The default ingest pipeline
+
+	mu    sync.Mutex
+	file  *os.File
+	w     *bufio.Writer
+	stats opensearchutil.BulkIndexerStats
+}
+
+// bulkMeta is the metadata of an item of a bulk request.
+type bulkMeta struct {
+	Index       string  `json:"_index,omitempty"`
+	ID          string  `json:"_id,omitempty"`
+	Routing     *string `json:"routing,omitempty"`
+	Version     *int64  `json:"version,omitempty"`
+	VersionType *string `json:"version_type,omitempty"`
+	Pipeline    string  `json:"pipeline,omitempty"`
+
+	RetryOnConflict *int `json:"retry_on_conflict,omitempty"`
+}
+
+func newBulkFileWriter(path string, index string, pipeline string) (*bulkFileWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &bulkFileWriter{index: index, pipeline: pipeline, file: file, w: bufio.NewWriter(file)}, nil
+}
+
+func (b *bulkFileWriter) Add(ctx context.Context, item opensearchutil.BulkIndexerItem) error {
+	meta := bulkMeta{
+		Index:       item.Index,
+		ID:          item.DocumentID,
+		Routing:     item.Routing,
+		Version:     item.Version,
+		VersionType: item.VersionType,
+
+		RetryOnConflict: item.RetryOnConflict,
+	}
+	// the request has no URL to give the defaults in, so each item has them
+	if meta.Index == "" {
+		meta.Index = b.index
+	}
+	if item.Action == "index" || item.Action == "create" {
+		meta.Pipeline = b.pipeline
+	}
+	line, err := json.Marshal(map[string]bulkMeta{item.Action: meta})
+	if err != nil {
+		return err
+	}
+	var document []byte
+	if item.Body != nil {
+		document, err = io.ReadAll(item.Body)
+		if err != nil {
+			return err
+		}
+	}
+	b.mu.Lock()
+	b.w.Write(line)
+	b.w.WriteByte('\n')
+	if document != nil {
+		b.w.Write(document)
+		b.w.WriteByte('\n')
+	}
+	b.stats.NumAdded++
+	b.stats.NumFlushed++
+	switch item.Action {
+	case "index":
+		b.stats.NumIndexed++
+	case "create":
+		b.stats.NumCreated++
+	case "update":
+		b.stats.NumUpdated++
+	case "delete":
+		b.stats.NumDeleted++
+	}
+	b.mu.Unlock()
+	if item.OnSuccess != nil {
+		item.OnSuccess(ctx, item, opensearchutil.BulkIndexerResponseItem{
+			Index:      meta.Index,
+			DocumentID: item.DocumentID,
+			Status:     200,
+		})
+	}
+	return nil
+}
+
+// Close writes what is buffered and closes the file.
+func (b *bulkFileWriter) Close(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.w.Flush()
+	if closeErr := b.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (b *bulkFileWriter) Stats() opensearchutil.BulkIndexerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
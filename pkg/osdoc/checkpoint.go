@@ -0,0 +1,182 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// checkpoint tracks how many records of each input have been handled:
+// indexed, failed, or skipped. Documents are acknowledged out of order by
+// the indexer's workers, so it keeps the records acknowledged past the
+// first gap until the gap is filled. A nil *checkpoint tracks nothing, and
+// one without a path isn't saved.
+type checkpoint struct {
+	mu      sync.Mutex
+	path    string
+	Records map[string]int `json:"records"` // Records handled in order, by input name
+
+	// Called, with mu held, when the records handled of an input increase
+	handled func(name string, records int)
+
+	resume  map[string]int          // Records to skip, by input name
+	pending map[string]map[int]bool // Records handled after the first gap
+	parts   map[string]map[int]int  // Outstanding documents of records split into several
+}
+
+// newCheckpoint creates a checkpoint saved to path. If resume is set, the
+// records already in the file are skipped on this run.
+func newCheckpoint(path string, resume bool) (*checkpoint, error) {
+	c := &checkpoint{
+		path:    path,
+		Records: map[string]int{},
+		resume:  map[string]int{},
+		pending: map[string]map[int]bool{},
+		parts:   map[string]map[int]int{},
+	}
+	if !resume {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	for name, n := range c.Records {
+		c.resume[name] = n
+	}
+	return c, nil
+}
+
+// resumeFrom returns the number of records of the named input to skip.
+func (c *checkpoint) resumeFrom(name string) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resume[name]
+}
+
+// split records that a record of the named input became n documents, so
+// it is only handled once done has been called for each of them.
+func (c *checkpoint) split(name string, record int, n int) {
+	if c == nil || n < 2 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.parts[name] == nil {
+		c.parts[name] = map[int]int{}
+	}
+	c.parts[name][record] = n
+}
+
+// done records that a record of the named input has been handled.
+func (c *checkpoint) done(name string, record int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n := c.parts[name][record]; n > 0 {
+		if n > 1 {
+			c.parts[name][record] = n - 1
+			return
+		}
+		delete(c.parts[name], record)
+	}
+	if record != c.Records[name]+1 {
+		if c.pending[name] == nil {
+			c.pending[name] = map[int]bool{}
+		}
+		c.pending[name][record] = true
+		return
+	}
+	c.Records[name] = record
+	for next := record + 1; c.pending[name][next]; next++ {
+		delete(c.pending[name], next)
+		c.Records[name] = next
+	}
+	if c.handled != nil {
+		c.handled(name, c.Records[name])
+	}
+}
+
+// restart records that the named input has started over, so none of its
+// records have been handled, and none are to be skipped.
+func (c *checkpoint) restart(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.Records, name)
+	delete(c.resume, name)
+	delete(c.pending, name)
+	delete(c.parts, name)
+}
+
+// save writes the checkpoint file, replacing it atomically.
+func (c *checkpoint) save() error {
+	if c == nil || c.path == "" {
+		return nil
+	}
+	c.mu.Lock()
+	data, err := json.Marshal(c)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// saveEvery saves the checkpoint at each interval until the returned
+// function is called. A non-positive interval saves only at the end.
+func (c *checkpoint) saveEvery(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.save(); err != nil {
+					logErrorf("Error writing the checkpoint file: %s", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
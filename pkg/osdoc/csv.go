@@ -0,0 +1,112 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// readDelimited calls add with a document for each record read from r,
+// using the first record as the header for field names. Values are
+// converted according to types, or inferred when infer is set.
+func readDelimited(r io.Reader, comma rune, types map[string]string, infer bool, name string, add AddFunc) error {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	if comma == '\t' {
+		reader.LazyQuotes = true
+	}
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			logErrorf("%s:%d: Error parsing record: %s", name, parseErr.Line, parseErr.Err)
+			if err := add(parseErr.Line, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// a record that failed to parse has no field positions
+		line, _ := reader.FieldPos(0)
+		if len(record) != len(header) {
+			logErrorf("%s:%d: record has %d fields but the header has %d; not adding", name, line, len(record), len(header))
+			if err := add(line, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		document := make(map[string]interface{}, len(header))
+		for i, field := range header {
+			value, err := convertValue(record[i], types[field], infer)
+			if err != nil {
+				logErrorf("%s:%d: Error converting field '%s': %s; not adding", name, line, field, err)
+				document = nil
+				break
+			}
+			if value != nil {
+				document[field] = value
+			}
+		}
+		if err := add(line, document); err != nil {
+			return err
+		}
+	}
+}
+
+// convertValue converts a delimited value to the named type. Empty values
+// of a non-string type are returned as nil so the field is left out.
+func convertValue(value string, typ string, infer bool) (interface{}, error) {
+	if typ == "" && infer {
+		return inferValue(value), nil
+	}
+	if value == "" && typ != "" && typ != "string" {
+		return nil, nil
+	}
+	switch typ {
+	case "", "string":
+		return value, nil
+	case "int":
+		return strconv.ParseInt(value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(value, 64)
+	case "bool":
+		return strconv.ParseBool(value)
+	}
+	return nil, fmt.Errorf("unknown type '%s'", typ)
+}
+
+// inferValue returns value as an int, float, or bool if it parses as one,
+// and as a string otherwise.
+func inferValue(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil {
+		return f
+	}
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	return value
+}
@@ -0,0 +1,75 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// failedDocument is a line of the failed output file: a document that
+// could not be indexed, where it came from, and why it failed.
+type failedDocument struct {
+	Source   string          `json:"source"`
+	Line     int             `json:"line"`
+	Status   int             `json:"status,omitempty"`
+	Error    string          `json:"error"`
+	Document json.RawMessage `json:"document"`
+}
+
+// deadLetterWriter writes failed documents to a file as NDJSON. It is safe
+// for concurrent use, since failures are reported from the indexer's
+// worker goroutines. A nil *deadLetterWriter discards everything.
+type deadLetterWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+}
+
+// newDeadLetterWriter returns a writer to the file at path. On a resumed
+// load, the failures are appended to those of the earlier run; otherwise
+// the file is truncated.
+func newDeadLetterWriter(path string, resume bool) (*deadLetterWriter, error) {
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if resume {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flag, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &deadLetterWriter{file: file, w: bufio.NewWriter(file)}, nil
+}
+
+// Write appends a failed document to the file.
+func (d *deadLetterWriter) Write(doc failedDocument) {
+	if d == nil {
+		return
+	}
+	line, err := json.Marshal(doc)
+	if err != nil {
+		logErrorf("Error marshalling failed document: %s", err)
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.w.Write(line)
+	d.w.WriteByte('\n')
+}
+
+// Close flushes and closes the file.
+func (d *deadLetterWriter) Close() error {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.w.Flush(); err != nil {
+		d.file.Close()
+		return err
+	}
+	return d.file.Close()
+}
@@ -0,0 +1,74 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// idSet records the document IDs seen in a run.
+type idSet interface {
+	// add adds id to the set, and reports whether it was already there.
+	add(id string) bool
+}
+
+// exactIDSet is an idSet that keeps every ID.
+type exactIDSet map[string]struct{}
+
+func (s exactIDSet) add(id string) bool {
+	if _, ok := s[id]; ok {
+		return true
+	}
+	s[id] = struct{}{}
+	return false
+}
+
+// bloomIDSet is an idSet in constant memory. It may report an ID that
+// hasn't been seen as a duplicate, with a probability of about 0.1% until
+// it holds more than its capacity.
+type bloomIDSet struct {
+	bits   []uint64
+	hashes int
+}
+
+// newBloomIDSet returns a bloomIDSet sized for capacity IDs.
+func newBloomIDSet(capacity int) *bloomIDSet {
+	const falsePositives = 0.001
+	m := math.Ceil(-float64(capacity) * math.Log(falsePositives) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomIDSet{bits: make([]uint64, int(m)/64+1), hashes: k}
+}
+
+func (s *bloomIDSet) add(id string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(id))
+	sum := h.Sum64()
+	// derive the k hashes from two halves of one, as Kirsch and
+	// Mitzenmacher show is enough
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	n := uint64(len(s.bits) * 64)
+	present := true
+	for i := 0; i < s.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % n
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if s.bits[word]&mask == 0 {
+			present = false
+			s.bits[word] |= mask
+		}
+	}
+	return present
+}
+
+// heldDocument is a document held back until the end of the input, so a
+// later document with the same ID can replace it.
+type heldDocument struct {
+	name     string
+	line     int
+	record   int
+	document map[string]interface{}
+}
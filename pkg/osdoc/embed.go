@@ -0,0 +1,236 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultEmbedBatchSize is the number of texts sent in each embedding
+// request if EmbedBatchSize isn't positive.
+const defaultEmbedBatchSize = 64
+
+// embedBackoff is the delay before the first retry of an embedding
+// request; it doubles on each retry.
+const embedBackoff = time.Second
+
+// embedItem is a document waiting for its embedding.
+type embedItem struct {
+	name     string
+	line     int
+	record   int
+	document map[string]interface{}
+	text     string
+}
+
+// embedder sets a field of documents to the embedding of another, from an
+// OpenAI-compatible embeddings API. Documents are gathered into batches,
+// which workers embed concurrently, handing each document on to done once
+// its batch has been embedded, or has failed to be. A batch that doesn't
+// fill within the flush interval is sent as it is, so documents trickling
+// in aren't held back.
+type embedder struct {
+	opts   Options
+	source []string // The keys of the field to embed
+	target []string // The keys of the field to set
+	client *http.Client
+	ctx    context.Context
+	done   func(item embedItem, err error)
+
+	mu      sync.Mutex
+	batch   []embedItem
+	timer   *time.Timer
+	batches chan []embedItem
+	wg      sync.WaitGroup
+}
+
+// newEmbedder returns an embedder for the options, whose requests are made
+// with ctx, and which calls done with each document put to it.
+func newEmbedder(ctx context.Context, opts Options, done func(item embedItem, err error)) *embedder {
+	if opts.EmbedBatchSize <= 0 {
+		opts.EmbedBatchSize = defaultEmbedBatchSize
+	}
+	if opts.EmbedWorkers <= 0 {
+		opts.EmbedWorkers = 1
+	}
+	e := &embedder{
+		opts:    opts,
+		source:  SplitFieldPath(opts.EmbedField),
+		target:  SplitFieldPath(opts.EmbedTarget),
+		client:  &http.Client{Timeout: time.Minute},
+		ctx:     ctx,
+		done:    done,
+		batches: make(chan []embedItem),
+	}
+	for i := 0; i < opts.EmbedWorkers; i++ {
+		e.wg.Add(1)
+		go e.work()
+	}
+	return e
+}
+
+// text returns the text of a document to embed, and whether it has one.
+// A document without the field, or with an empty one, is indexed as it is;
+// one with a value that isn't a string is an error.
+func (e *embedder) text(document map[string]interface{}) (string, bool, error) {
+	value := LookupField(document, e.source)
+	if value == nil {
+		return "", false, nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return "", false, fmt.Errorf("the embed field '%s' is not a string", e.opts.EmbedField)
+	}
+	return text, text != "", nil
+}
+
+// put adds a document to the current batch, sending the batch to the
+// workers once it is full. It blocks while all of the workers are busy.
+func (e *embedder) put(item embedItem) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.batch = append(e.batch, item)
+	if len(e.batch) == 1 && e.opts.FlushInterval > 0 {
+		e.timer = time.AfterFunc(e.opts.FlushInterval, e.flush)
+	}
+	if len(e.batch) >= e.opts.EmbedBatchSize {
+		e.send()
+	}
+}
+
+// flush sends the current batch, however full it is.
+func (e *embedder) flush() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.send()
+}
+
+// send sends the current batch to the workers; e.mu must be held.
+func (e *embedder) send() {
+	if e.timer != nil {
+		e.timer.Stop()
+		e.timer = nil
+	}
+	if len(e.batch) == 0 {
+		return
+	}
+	e.batches <- e.batch
+	e.batch = nil
+}
+
+// close sends the last batch, and waits for the workers to finish. A nil
+// embedder has nothing to close.
+func (e *embedder) close() {
+	if e == nil {
+		return
+	}
+	e.flush()
+	close(e.batches)
+	e.wg.Wait()
+}
+
+// work embeds the batches sent to the workers. Once the load is cancelled,
+// the documents are dropped.
+func (e *embedder) work() {
+	defer e.wg.Done()
+	for batch := range e.batches {
+		if e.ctx.Err() != nil {
+			continue
+		}
+		texts := make([]string, len(batch))
+		for i, item := range batch {
+			texts[i] = item.text
+		}
+		vectors, err := e.embed(texts)
+		if e.ctx.Err() != nil {
+			continue
+		}
+		for i, item := range batch {
+			if err == nil {
+				SetField(item.document, e.target, vectors[i])
+			}
+			e.done(item, err)
+		}
+	}
+}
+
+// embed returns the embeddings of the texts, retrying a request that fails
+// with a network error, a 429, or a 5xx status up to EmbedRetries times.
+func (e *embedder) embed(texts []string) ([][]float64, error) {
+	backoff := embedBackoff
+	for attempt := 0; ; attempt++ {
+		vectors, retry, err := e.request(texts)
+		if err == nil || !retry || attempt == e.opts.EmbedRetries {
+			return vectors, err
+		}
+		logWarnf("Error embedding %d documents: %s; retrying in %s", len(texts), err, backoff)
+		select {
+		case <-e.ctx.Done():
+			return nil, e.ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// embeddingResponse is the response of an OpenAI-compatible embeddings API.
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+}
+
+// request makes one embedding request for the texts. It reports whether a
+// failed request is worth retrying.
+func (e *embedder) request(texts []string) ([][]float64, bool, error) {
+	body := map[string]interface{}{"input": texts}
+	if e.opts.EmbedModel != "" {
+		body["model"] = e.opts.EmbedModel
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, false, err
+	}
+	req, err := http.NewRequestWithContext(e.ctx, http.MethodPost, e.opts.EmbedEndpoint, bytes.NewReader(data))
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.opts.EmbedAPIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.opts.EmbedAPIKey)
+	}
+	res, err := e.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+		return nil, retry, fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(message))
+	}
+	var result embeddingResponse
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, true, fmt.Errorf("reading the response: %w", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, false, fmt.Errorf("got %d embeddings for %d texts", len(result.Data), len(texts))
+	}
+	vectors := make([][]float64, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(texts) || vectors[d.Index] != nil {
+			return nil, false, fmt.Errorf("the response has a bad embedding index %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, false, nil
+}
@@ -0,0 +1,68 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import "strings"
+
+// SplitFieldPath splits a dotted field path such as metadata.uuid into its
+// keys. A backslash escapes a dot that is part of a key, as in a\.b.
+func SplitFieldPath(path string) []string {
+	var keys []string
+	var key strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path) && path[i+1] == '.':
+			key.WriteByte('.')
+			i++
+		case path[i] == '.':
+			keys = append(keys, key.String())
+			key.Reset()
+		default:
+			key.WriteByte(path[i])
+		}
+	}
+	return append(keys, key.String())
+}
+
+// LookupField returns the value at the path of keys in document, or nil if
+// there is none.
+func LookupField(document map[string]interface{}, keys []string) interface{} {
+	var value interface{} = document
+	for _, key := range keys {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// deleteField removes the value at the path of keys from document.
+func deleteField(document map[string]interface{}, keys []string) {
+	object := document
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := object[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		object = next
+	}
+	delete(object, keys[len(keys)-1])
+}
+
+// SetField sets the value at the path of keys in document, creating
+// objects along the path as needed and replacing any values in the way.
+func SetField(document map[string]interface{}, keys []string, value interface{}) {
+	object := document
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := object[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			object[key] = next
+		}
+		object = next
+	}
+	object[keys[len(keys)-1]] = value
+}
@@ -0,0 +1,352 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Generator makes documents from a template: a JSON object whose strings
+// may hold {{faker}} placeholders, such as {{name}} or {{int 1 100}}. A
+// string that is a single placeholder takes the placeholder's value, with
+// its type; otherwise each placeholder is replaced by its value as text.
+type Generator struct {
+	template generated
+	random   *rand.Rand
+	now      time.Time
+	seq      int
+}
+
+// generated makes a value of a document.
+type generated func(g *Generator) interface{}
+
+// fakers are the placeholders of a template. Each takes the placeholder's
+// arguments, and returns the function making its values or an error if
+// the arguments are wrong.
+var fakers = map[string]func(args []string) (generated, error){
+	"seq":        noArgs(func(g *Generator) interface{} { return g.seq }),
+	"uuid":       noArgs(func(g *Generator) interface{} { return g.uuid() }),
+	"bool":       noArgs(func(g *Generator) interface{} { return g.random.Intn(2) == 1 }),
+	"first_name": noArgs(func(g *Generator) interface{} { return g.pick(firstNames) }),
+	"last_name":  noArgs(func(g *Generator) interface{} { return g.pick(lastNames) }),
+	"name": noArgs(func(g *Generator) interface{} {
+		return g.pick(firstNames) + " " + g.pick(lastNames)
+	}),
+	"email": noArgs(func(g *Generator) interface{} {
+		return fmt.Sprintf("%s.%s@%s", strings.ToLower(g.pick(firstNames)), strings.ToLower(g.pick(lastNames)), g.pick(domains))
+	}),
+	"ip": noArgs(func(g *Generator) interface{} {
+		return net.IPv4(byte(1+g.random.Intn(223)), byte(g.random.Intn(256)), byte(g.random.Intn(256)), byte(1+g.random.Intn(254))).String()
+	}),
+	"ipv6": noArgs(func(g *Generator) interface{} {
+		ip := make(net.IP, net.IPv6len)
+		g.random.Read(ip)
+		ip[0], ip[1] = 0x20, 0x01
+		return ip.String()
+	}),
+	"word": noArgs(func(g *Generator) interface{} { return g.pick(loremWords) }),
+	"now":  noArgs(func(g *Generator) interface{} { return time.Now().UTC().Format(time.RFC3339Nano) }),
+	"lorem": func(args []string) (generated, error) {
+		words := 10
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 || len(args) > 1 {
+				return nil, fmt.Errorf("lorem takes a number of words")
+			}
+			words = n
+		}
+		return func(g *Generator) interface{} {
+			text := make([]string, words)
+			for i := range text {
+				text[i] = g.pick(loremWords)
+			}
+			return strings.Join(text, " ")
+		}, nil
+	},
+	"int": func(args []string) (generated, error) {
+		low, high, err := intRange(args, 0, 100)
+		if err != nil {
+			return nil, fmt.Errorf("int takes a least and a greatest value: %w", err)
+		}
+		// the span may not fit in an int64, though its wrapped difference
+		// is right as a uint64
+		span := uint64(high-low) + 1
+		return func(g *Generator) interface{} { return low + int64(g.below(span)) }, nil
+	},
+	"float": func(args []string) (generated, error) {
+		low, high := 0.0, 1.0
+		if len(args) > 0 {
+			var err1, err2 error
+			if len(args) == 2 {
+				low, err1 = strconv.ParseFloat(args[0], 64)
+				high, err2 = strconv.ParseFloat(args[1], 64)
+			}
+			if len(args) != 2 || err1 != nil || err2 != nil || high < low {
+				return nil, fmt.Errorf("float takes a least and a greatest value")
+			}
+		}
+		return func(g *Generator) interface{} { return low + g.random.Float64()*(high-low) }, nil
+	},
+	"choice": func(args []string) (generated, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("choice takes the values to choose from")
+		}
+		return func(g *Generator) interface{} { return g.pick(args) }, nil
+	},
+	"timestamp": func(args []string) (generated, error) {
+		var from, to time.Time
+		switch len(args) {
+		case 0:
+		case 2:
+			var err error
+			if from, err = parseTemplateTime(args[0]); err == nil {
+				to, err = parseTemplateTime(args[1])
+			}
+			if err != nil || to.Before(from) {
+				return nil, fmt.Errorf("timestamp takes the first and last times, as 2006-01-02 or RFC 3339")
+			}
+		default:
+			return nil, fmt.Errorf("timestamp takes the first and last times, or nothing")
+		}
+		return func(g *Generator) interface{} {
+			first, last := from, to
+			// without a range, the last thirty days
+			if first.IsZero() {
+				last = g.now
+				first = last.AddDate(0, 0, -30)
+			}
+			// a range of more than 292 years doesn't fit in a Duration, so
+			// it is drawn to the second
+			var t time.Time
+			if span := last.Sub(first); span < math.MaxInt64 {
+				t = first.Add(time.Duration(g.below(uint64(span) + 1)))
+			} else {
+				t = time.Unix(first.Unix()+int64(g.below(uint64(last.Unix()-first.Unix())+1)), 0)
+			}
+			return t.UTC().Format(time.RFC3339Nano)
+		}, nil
+	},
+}
+
+// NewGenerator returns a Generator of documents from template, with its
+// random values drawn from seed.
+func NewGenerator(template map[string]interface{}, seed int64) (*Generator, error) {
+	compiled, err := compileTemplate("", template)
+	if err != nil {
+		return nil, err
+	}
+	return &Generator{
+		template: compiled,
+		random:   rand.New(rand.NewSource(seed)),
+		now:      time.Now(),
+	}, nil
+}
+
+// Next returns the next document.
+func (g *Generator) Next() map[string]interface{} {
+	g.seq++
+	return g.template(g).(map[string]interface{})
+}
+
+// compileTemplate returns the function making the values of the template
+// value at path.
+func compileTemplate(path string, value interface{}) (generated, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		// the fields are made in order, so that a seed makes the same
+		// documents
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		fields := make([]generated, len(keys))
+		for i, key := range keys {
+			compiled, err := compileTemplate(joinPath(path, key), v[key])
+			if err != nil {
+				return nil, err
+			}
+			fields[i] = compiled
+		}
+		return func(g *Generator) interface{} {
+			object := make(map[string]interface{}, len(fields))
+			for i, field := range fields {
+				object[keys[i]] = field(g)
+			}
+			return object
+		}, nil
+	case []interface{}:
+		elements := make([]generated, len(v))
+		for i, element := range v {
+			compiled, err := compileTemplate(fmt.Sprintf("%s[%d]", path, i), element)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = compiled
+		}
+		return func(g *Generator) interface{} {
+			array := make([]interface{}, len(elements))
+			for i, element := range elements {
+				array[i] = element(g)
+			}
+			return array
+		}, nil
+	case string:
+		compiled, err := compileString(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return compiled, nil
+	}
+	return func(*Generator) interface{} { return value }, nil
+}
+
+// compileString returns the function making the values of a template
+// string.
+func compileString(s string) (generated, error) {
+	var parts []generated
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed placeholder in '%s'", s)
+		}
+		if start > 0 {
+			text := s[:start]
+			parts = append(parts, func(*Generator) interface{} { return text })
+		}
+		words := strings.Fields(s[start+2 : start+end])
+		if len(words) == 0 {
+			return nil, fmt.Errorf("empty placeholder")
+		}
+		faker, ok := fakers[words[0]]
+		if !ok {
+			return nil, fmt.Errorf("unknown placeholder '%s'", words[0])
+		}
+		part, err := faker(words[1:])
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		s = s[start+end+2:]
+	}
+	if s != "" || len(parts) == 0 {
+		text := s
+		parts = append(parts, func(*Generator) interface{} { return text })
+	}
+	// a single placeholder keeps the type of its value
+	if len(parts) == 1 {
+		return parts[0], nil
+	}
+	return func(g *Generator) interface{} {
+		var text strings.Builder
+		for _, part := range parts {
+			fmt.Fprint(&text, part(g))
+		}
+		return text.String()
+	}, nil
+}
+
+func noArgs(fn generated) func(args []string) (generated, error) {
+	return func(args []string) (generated, error) {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("the placeholder takes no arguments")
+		}
+		return fn, nil
+	}
+}
+
+// intRange parses the least and greatest values of a range, or returns the
+// defaults if there are no arguments.
+func intRange(args []string, low int64, high int64) (int64, int64, error) {
+	if len(args) == 0 {
+		return low, high, nil
+	}
+	if len(args) != 2 {
+		return 0, 0, fmt.Errorf("got %d arguments", len(args))
+	}
+	low, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	high, err = strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if high < low {
+		return 0, 0, fmt.Errorf("%d is less than %d", high, low)
+	}
+	return low, high, nil
+}
+
+// parseTemplateTime parses a time of a timestamp placeholder.
+func parseTemplateTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// below returns a random number less than n, or any number if n is 0, for
+// a span of every uint64.
+func (g *Generator) below(n uint64) uint64 {
+	if n == 0 {
+		return g.random.Uint64()
+	}
+	if n <= math.MaxInt64 {
+		return uint64(g.random.Int63n(int64(n)))
+	}
+	// more than half of the values are below n, so this soon ends
+	for {
+		if v := g.random.Uint64(); v < n {
+			return v
+		}
+	}
+}
+
+func (g *Generator) pick(values []string) string {
+	return values[g.random.Intn(len(values))]
+}
+
+// uuid returns a random (version 4) UUID.
+func (g *Generator) uuid() string {
+	b := make([]byte, 16)
+	g.random.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+var firstNames = strings.Fields(`James Mary Robert Patricia John Jennifer Michael Linda David
+	Elizabeth William Barbara Richard Susan Joseph Jessica Thomas Sarah Charles Karen Wei Ana
+	Mohammed Fatima Hiroshi Yuki Olga Ivan Priya Arjun Sofia Mateo Amara Kwame Ingrid Lars`)
+
+var lastNames = strings.Fields(`Smith Johnson Williams Brown Jones Garcia Miller Davis Rodriguez
+	Martinez Hernandez Lopez Gonzalez Wilson Anderson Thomas Taylor Moore Jackson Martin Lee
+	Wang Chen Kim Nguyen Patel Singh Tanaka Ivanova Okafor Silva Rossi Muller Larsen Cohen`)
+
+var domains = strings.Fields(`example.com example.org example.net mail.example test.example`)
+
+var loremWords = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit sed do
+	eiusmod tempor incididunt ut labore et dolore magna aliqua enim ad minim veniam quis nostrud
+	exercitation ullamco laboris nisi aliquip ex ea commodo consequat duis aute irure in
+	reprehenderit voluptate velit esse cillum fugiat nulla pariatur excepteur sint occaecat
+	cupidatat non proident sunt culpa qui officia deserunt mollit anim id est laborum`)
@@ -0,0 +1,56 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"bufio"
+	"strings"
+)
+
+// isIDList reports whether the input in r is a list of IDs rather than JSON
+// documents: it doesn't start with an object or an array. Nothing is read
+// from r.
+func isIDList(r *bufio.Reader) bool {
+	c, err := peekNonSpace(r)
+	return err == nil && c != '{' && c != '['
+}
+
+// readIDLines calls add with a document for each line of r, holding the
+// line as its ID at idPath. Blank lines are skipped, and an ID quoted as in
+// CSV is unquoted.
+func readIDLines(r *bufio.Reader, idPath []string, name string, add AddFunc) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		id := strings.TrimSpace(scanner.Text())
+		if id == "" {
+			continue
+		}
+		if len(id) >= 2 && id[0] == '"' && id[len(id)-1] == '"' {
+			id = strings.ReplaceAll(id[1:len(id)-1], `""`, `"`)
+		}
+		document := map[string]interface{}{}
+		SetField(document, idPath, id)
+		if err := add(line, document); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// idColumn wraps add so that a document with a single field, such as a
+// record of a one-column CSV, has that field as its ID at idPath, whatever
+// its name.
+func idColumn(add AddFunc, idPath []string) AddFunc {
+	return func(line int, document map[string]interface{}) error {
+		if len(document) == 1 {
+			for _, value := range document {
+				document = map[string]interface{}{}
+				SetField(document, idPath, value)
+			}
+		}
+		return add(line, document)
+	}
+}
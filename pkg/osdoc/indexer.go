@@ -0,0 +1,264 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+	"github.com/opensearch-project/opensearch-go/opensearchutil"
+)
+
+// The defaults of the indexer's FlushBytes and FlushInterval, as in
+// opensearchutil.
+const (
+	defaultFlushBytes    = 5e6
+	defaultFlushInterval = 30 * time.Second
+)
+
+// bulkIndexer is a BulkIndexer that sends the items to the cluster, as
+// opensearchutil's does: each of its workers gathers the items it takes
+// into a bulk request, sent once it reaches FlushBytes, every FlushInterval,
+// and on Close. Unlike opensearchutil's, when a whole request fails, with a
+// network error or an error status, each of its items fails with the error,
+// so they reach the failed output file and the checkpoint. The items of a
+// request abandoned because the load was cancelled are dropped.
+type bulkIndexer struct {
+	config  opensearchutil.BulkIndexerConfig
+	ctx     context.Context
+	queue   chan opensearchutil.BulkIndexerItem
+	workers []*bulkWorker
+	wg      sync.WaitGroup
+	ticker  *time.Ticker
+	done    chan struct{}
+
+	mu    sync.Mutex
+	stats opensearchutil.BulkIndexerStats
+}
+
+// bulkWorker is the bulk request a worker is gathering, and its items.
+type bulkWorker struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	items []opensearchutil.BulkIndexerItem
+}
+
+// newBulkIndexer returns an indexer whose requests are made with ctx. Of
+// the config, it uses the Client, the request parameters Index, Pipeline,
+// Refresh, and WaitForActiveShards, NumWorkers, FlushBytes, FlushInterval,
+// and OnError, which is called for each request that fails.
+func newBulkIndexer(ctx context.Context, config opensearchutil.BulkIndexerConfig) *bulkIndexer {
+	if config.NumWorkers <= 0 {
+		config.NumWorkers = runtime.NumCPU()
+	}
+	if config.FlushBytes <= 0 {
+		config.FlushBytes = defaultFlushBytes
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaultFlushInterval
+	}
+	b := &bulkIndexer{
+		config: config,
+		ctx:    ctx,
+		queue:  make(chan opensearchutil.BulkIndexerItem, config.NumWorkers),
+		ticker: time.NewTicker(config.FlushInterval),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < config.NumWorkers; i++ {
+		w := &bulkWorker{}
+		b.workers = append(b.workers, w)
+		b.wg.Add(1)
+		go b.work(w)
+	}
+	go b.flushEvery()
+	return b
+}
+
+func (b *bulkIndexer) Add(ctx context.Context, item opensearchutil.BulkIndexerItem) error {
+	b.mu.Lock()
+	b.stats.NumAdded++
+	b.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case b.queue <- item:
+		return nil
+	}
+}
+
+// Close sends the requests the workers are gathering, unless ctx is done.
+func (b *bulkIndexer) Close(ctx context.Context) error {
+	b.ticker.Stop()
+	close(b.done)
+	close(b.queue)
+	b.wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, w := range b.workers {
+		w.mu.Lock()
+		b.flush(w)
+		w.mu.Unlock()
+	}
+	return nil
+}
+
+func (b *bulkIndexer) Stats() opensearchutil.BulkIndexerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stats
+}
+
+// work adds the items from the queue to a worker's request, sending it
+// once it is full.
+func (b *bulkIndexer) work(w *bulkWorker) {
+	defer b.wg.Done()
+	for item := range b.queue {
+		w.mu.Lock()
+		if err := w.write(item); err != nil {
+			b.fail([]opensearchutil.BulkIndexerItem{item}, opensearchutil.BulkIndexerResponseItem{}, err)
+		} else if w.buf.Len() >= b.config.FlushBytes {
+			b.flush(w)
+		}
+		w.mu.Unlock()
+	}
+}
+
+// flushEvery sends the workers' requests every FlushInterval, until the
+// indexer is closed.
+func (b *bulkIndexer) flushEvery() {
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-b.ticker.C:
+			for _, w := range b.workers {
+				w.mu.Lock()
+				b.flush(w)
+				w.mu.Unlock()
+			}
+		}
+	}
+}
+
+// write adds an item to the request: its action and metadata line, and
+// its document line unless it is a delete. w.mu must be held.
+func (w *bulkWorker) write(item opensearchutil.BulkIndexerItem) error {
+	line, err := json.Marshal(map[string]bulkMeta{item.Action: {
+		Index:       item.Index,
+		ID:          item.DocumentID,
+		Routing:     item.Routing,
+		Version:     item.Version,
+		VersionType: item.VersionType,
+
+		RetryOnConflict: item.RetryOnConflict,
+	}})
+	if err != nil {
+		return err
+	}
+	var document bytes.Buffer
+	if item.Body != nil {
+		if _, err := document.ReadFrom(item.Body); err != nil {
+			return err
+		}
+		document.WriteByte('\n')
+	}
+	w.buf.Write(line)
+	w.buf.WriteByte('\n')
+	w.buf.Write(document.Bytes())
+	w.items = append(w.items, item)
+	return nil
+}
+
+// flush sends a worker's request, if it has any items, and calls the
+// callbacks of each of them. w.mu must be held.
+func (b *bulkIndexer) flush(w *bulkWorker) {
+	if len(w.items) == 0 {
+		return
+	}
+	items := w.items
+	defer func() {
+		w.buf.Reset()
+		w.items = w.items[:0]
+	}()
+	b.mu.Lock()
+	b.stats.NumRequests++
+	b.mu.Unlock()
+	res, err := opensearchapi.BulkRequest{
+		Index:               b.config.Index,
+		Body:                bytes.NewReader(w.buf.Bytes()),
+		Pipeline:            b.config.Pipeline,
+		Refresh:             b.config.Refresh,
+		WaitForActiveShards: b.config.WaitForActiveShards,
+	}.Do(b.ctx, b.config.Client)
+	status := 0
+	var response opensearchutil.BulkIndexerResponse
+	if err == nil {
+		defer res.Body.Close()
+		status = res.StatusCode
+		err = ResponseError(res)
+	}
+	if err == nil {
+		if decodeErr := json.NewDecoder(res.Body).Decode(&response); decodeErr != nil {
+			err = fmt.Errorf("reading the response: %w", decodeErr)
+		} else if len(response.Items) != len(items) {
+			err = fmt.Errorf("the response has %d items for %d documents", len(response.Items), len(items))
+		}
+	}
+	if err != nil {
+		if b.ctx.Err() != nil {
+			return
+		}
+		if b.config.OnError != nil {
+			b.config.OnError(b.ctx, err)
+		}
+		b.fail(items, opensearchutil.BulkIndexerResponseItem{Status: status}, err)
+		return
+	}
+	for i, result := range response.Items {
+		item := items[i]
+		// each result is a map of the action to its outcome
+		for action, info := range result {
+			if info.Error.Type != "" || info.Status > 201 {
+				b.fail([]opensearchutil.BulkIndexerItem{item}, info, nil)
+				continue
+			}
+			b.mu.Lock()
+			b.stats.NumFlushed++
+			switch action {
+			case "index":
+				b.stats.NumIndexed++
+			case "create":
+				b.stats.NumCreated++
+			case "update":
+				b.stats.NumUpdated++
+			case "delete":
+				b.stats.NumDeleted++
+			}
+			b.mu.Unlock()
+			if item.OnSuccess != nil {
+				item.OnSuccess(b.ctx, item, info)
+			}
+		}
+	}
+}
+
+// fail counts items as failed, and calls their OnFailure callbacks with the
+// outcome of a failed action, or with the error of a request that failed.
+func (b *bulkIndexer) fail(items []opensearchutil.BulkIndexerItem, info opensearchutil.BulkIndexerResponseItem, err error) {
+	b.mu.Lock()
+	b.stats.NumFailed += uint64(len(items))
+	b.mu.Unlock()
+	for _, item := range items {
+		if item.OnFailure != nil {
+			item.OnFailure(b.ctx, item, info, err)
+		}
+	}
+}
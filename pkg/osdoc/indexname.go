@@ -0,0 +1,110 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateLayouts are the layouts tried, in order, when parsing a string date
+// field.
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// isIndexPattern reports whether an index name contains a date pattern, as
+// in logs-{yyyy.MM.dd}.
+func isIndexPattern(index string) bool {
+	return strings.Contains(index, "{")
+}
+
+// expandIndexPattern replaces each {...} date pattern in index with t,
+// formatted in UTC. Patterns use yyyy, yy, MM, dd, HH, mm, and ss; other
+// characters are copied as they are.
+func expandIndexPattern(index string, t time.Time) (string, error) {
+	t = t.UTC()
+	var name strings.Builder
+	for {
+		start := strings.IndexByte(index, '{')
+		if start < 0 {
+			name.WriteString(index)
+			return name.String(), nil
+		}
+		end := strings.IndexByte(index[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unclosed date pattern in index name %q", index)
+		}
+		name.WriteString(index[:start])
+		pattern := index[start+1 : start+end]
+		for i := 0; i < len(pattern); {
+			n := 1
+			for i+n < len(pattern) && pattern[i+n] == pattern[i] {
+				n++
+			}
+			switch token := pattern[i : i+n]; token {
+			case "yyyy":
+				fmt.Fprintf(&name, "%04d", t.Year())
+			case "yy":
+				fmt.Fprintf(&name, "%02d", t.Year()%100)
+			case "MM":
+				fmt.Fprintf(&name, "%02d", t.Month())
+			case "dd":
+				fmt.Fprintf(&name, "%02d", t.Day())
+			case "HH":
+				fmt.Fprintf(&name, "%02d", t.Hour())
+			case "mm":
+				fmt.Fprintf(&name, "%02d", t.Minute())
+			case "ss":
+				fmt.Fprintf(&name, "%02d", t.Second())
+			default:
+				name.WriteString(token)
+			}
+			i += n
+		}
+		index = index[start+end+1:]
+	}
+}
+
+// indexPatternWildcard replaces each {...} date pattern in index with *, so
+// that it matches every index the pattern expands to.
+func indexPatternWildcard(index string) string {
+	var name strings.Builder
+	for {
+		start := strings.IndexByte(index, '{')
+		end := strings.IndexByte(index, '}')
+		if start < 0 || end < start {
+			name.WriteString(index)
+			return name.String()
+		}
+		name.WriteString(index[:start])
+		name.WriteByte('*')
+		index = index[end+1:]
+	}
+}
+
+// parseDocumentTime parses the value of a date field: a string in one of
+// the dateLayouts, or a number of milliseconds since the epoch.
+func parseDocumentTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case string:
+		for _, layout := range dateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("can't parse %q as a date", v)
+	case float64:
+		return time.UnixMilli(int64(v)), nil
+	case int:
+		return time.UnixMilli(int64(v)), nil
+	case int64:
+		return time.UnixMilli(v), nil
+	}
+	return time.Time{}, fmt.Errorf("can't use %v as a date", value)
+}
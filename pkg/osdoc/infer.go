@@ -0,0 +1,192 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// spacedDateLayout is the one of the dateLayouts that OpenSearch's default
+// date format doesn't accept, so a field of such dates needs its own format.
+const spacedDateLayout = "2006-01-02 15:04:05"
+
+// textWords is the number of words from which a string is taken to be text
+// rather than a keyword.
+const textWords = 4
+
+// maxKeywordLength is the longest string indexed by the keyword sub-field
+// of a text field.
+const maxKeywordLength = 256
+
+// MappingInferrer proposes a mapping for an index from sample documents.
+type MappingInferrer struct {
+	root      inferredField
+	documents int
+}
+
+// inferredField counts the kinds of values seen in a field of the sample.
+type inferredField struct {
+	booleans, integers, floats, strings, dates, objects int
+
+	spacedDates bool // Some dates have a space between the date and the time
+	text        bool // Some strings look like text
+	maxLength   int  // The length of the longest string
+	inArray     bool // Some objects were in arrays
+
+	properties map[string]*inferredField
+}
+
+// NewMappingInferrer returns a MappingInferrer with no documents.
+func NewMappingInferrer() *MappingInferrer {
+	return &MappingInferrer{}
+}
+
+// Add adds a document to the sample.
+func (m *MappingInferrer) Add(document map[string]interface{}) {
+	m.documents++
+	m.root.addObject(document)
+}
+
+// Documents returns the number of documents in the sample.
+func (m *MappingInferrer) Documents() int {
+	return m.documents
+}
+
+func (f *inferredField) addObject(object map[string]interface{}) {
+	if f.properties == nil {
+		f.properties = map[string]*inferredField{}
+	}
+	for name, value := range object {
+		field, ok := f.properties[name]
+		if !ok {
+			field = &inferredField{}
+			f.properties[name] = field
+		}
+		field.add(value, false)
+	}
+}
+
+func (f *inferredField) add(value interface{}, inArray bool) {
+	switch v := value.(type) {
+	case nil:
+	case bool:
+		f.booleans++
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			f.integers++
+		} else {
+			f.floats++
+		}
+	case float32:
+		f.add(float64(v), inArray)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		f.integers++
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			f.integers++
+		} else {
+			f.floats++
+		}
+	case string:
+		f.addString(v)
+	case map[string]interface{}:
+		f.objects++
+		f.inArray = f.inArray || inArray
+		f.addObject(v)
+	case []interface{}:
+		for _, element := range v {
+			f.add(element, true)
+		}
+	default:
+		f.addString(fmt.Sprintf("%v", v))
+	}
+}
+
+func (f *inferredField) addString(value string) {
+	f.strings++
+	if len(value) > f.maxLength {
+		f.maxLength = len(value)
+	}
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			f.dates++
+			f.spacedDates = f.spacedDates || layout == spacedDateLayout
+			return
+		}
+	}
+	if len(strings.Fields(value)) >= textWords || len(value) > maxKeywordLength {
+		f.text = true
+	}
+}
+
+// Mapping returns the proposed mapping of the sample's fields, and a
+// description of each field whose values can't share a mapping, such as a
+// field holding both objects and strings. Fields whose values were all
+// null are left out, for dynamic mapping to settle.
+func (m *MappingInferrer) Mapping() (map[string]interface{}, []string) {
+	var conflicts []string
+	properties := m.root.propertiesMapping("", &conflicts)
+	sort.Strings(conflicts)
+	return map[string]interface{}{"properties": properties}, conflicts
+}
+
+func (f *inferredField) propertiesMapping(prefix string, conflicts *[]string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for name, field := range f.properties {
+		if mapping := field.mapping(prefix+name, conflicts); mapping != nil {
+			properties[name] = mapping
+		}
+	}
+	return properties
+}
+
+// mapping returns the mapping of the field at path, or nil if it held only
+// nulls.
+func (f *inferredField) mapping(path string, conflicts *[]string) map[string]interface{} {
+	scalars := f.booleans + f.integers + f.floats + f.strings
+	if f.objects > 0 {
+		if scalars > 0 {
+			*conflicts = append(*conflicts, fmt.Sprintf("%s holds both objects and other values; mapped as an object", path))
+		}
+		mapping := map[string]interface{}{"properties": f.propertiesMapping(path+".", conflicts)}
+		// arrays of objects are nested, so that the fields of each object
+		// are queried together
+		if f.inArray {
+			mapping["type"] = "nested"
+		}
+		return mapping
+	}
+	switch {
+	case scalars == 0:
+		return nil
+	case f.booleans == scalars:
+		return map[string]interface{}{"type": "boolean"}
+	case f.integers == scalars:
+		return map[string]interface{}{"type": "long"}
+	case f.integers+f.floats == scalars:
+		return map[string]interface{}{"type": "double"}
+	case f.dates == scalars:
+		mapping := map[string]interface{}{"type": "date"}
+		if f.spacedDates {
+			mapping["format"] = "yyyy-MM-dd HH:mm:ss||strict_date_optional_time||epoch_millis"
+		}
+		return mapping
+	case f.strings < scalars:
+		*conflicts = append(*conflicts, fmt.Sprintf("%s holds values of different types; mapped as a keyword", path))
+	case f.text:
+		mapping := map[string]interface{}{"type": "text"}
+		if f.maxLength <= maxKeywordLength {
+			mapping["fields"] = map[string]interface{}{
+				"keyword": map[string]interface{}{"type": "keyword", "ignore_above": maxKeywordLength},
+			}
+		}
+		return mapping
+	}
+	return map[string]interface{}{"type": "keyword"}
+}
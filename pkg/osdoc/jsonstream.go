@@ -0,0 +1,99 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// isJSONStream reports whether the JSON input in r isn't one object per
+// line: it starts with a top-level array, or with an object whose opening
+// brace is alone on its line, as pretty-printers write it. Nothing is read
+// from r.
+func isJSONStream(r *bufio.Reader) bool {
+	opened := false
+	for n := 1; n <= r.Size(); n++ {
+		peek, err := r.Peek(n)
+		if err != nil {
+			return false
+		}
+		switch c := peek[n-1]; {
+		case c == '\n':
+			if opened {
+				return true
+			}
+		case c == ' ' || c == '\t' || c == '\r':
+		case opened:
+			return false
+		case c == '[':
+			return true
+		case c == '{':
+			opened = true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// readJSONStream calls add with each JSON object read from r, which may be
+// a top-level array of objects or a sequence of objects laid out in any
+// way. Since documents needn't start on their own lines, errors are
+// reported with the position of the document instead of a line number. A
+// syntax error ends the input.
+func readJSONStream(r *bufio.Reader, name string, add AddFunc) error {
+	decoder := json.NewDecoder(r)
+	array := false
+	if peek, err := peekNonSpace(r); err == nil && peek == '[' {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		array = true
+	}
+	position := 0
+	for decoder.More() {
+		position++
+		var f interface{}
+		if err := decoder.Decode(&f); err != nil {
+			return err
+		}
+		documentMap, ok := f.(map[string]interface{})
+		if !ok {
+			logErrorf("%s:%d: document is not a JSON object; not adding", name, position)
+			if err := add(position, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := add(position, documentMap); err != nil {
+			return err
+		}
+	}
+	if array {
+		// the closing bracket
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// peekNonSpace returns the first byte of r that isn't whitespace, without
+// reading anything from r.
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for n := 1; n <= r.Size(); n++ {
+		peek, err := r.Peek(n)
+		if err != nil {
+			return 0, err
+		}
+		switch c := peek[n-1]; c {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return c, nil
+		}
+	}
+	return 0, io.EOF
+}
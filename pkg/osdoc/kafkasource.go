@@ -0,0 +1,207 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaOptions holds the settings for consuming documents from Kafka.
+type KafkaOptions struct {
+	Brokers        []string      // The addresses of the brokers
+	Topic          string        // The topic to consume
+	Group          string        // The consumer group, whose offsets are committed
+	CommitInterval time.Duration // How often to commit the offsets of the documents handled
+	SchemaRegistry string        // The URL of the schema registry for Avro messages; messages are JSON if empty
+}
+
+// kafkaCommitTimeout is how long committing the offsets may take.
+const kafkaCommitTimeout = 30 * time.Second
+
+// kafkaSource is a DocumentSource of the JSON messages of a Kafka topic. The
+// offset of a message is only committed once its document, and those of
+// the messages before it in its partition, have been handled, so messages
+// whose documents were read but not flushed are consumed again by the
+// next run.
+type kafkaSource struct {
+	ctx      context.Context
+	reader   *kafka.Reader
+	registry *schemaRegistry // For Avro messages
+
+	mu         sync.Mutex
+	partitions map[string]*kafkaPartition // By input name
+
+	stopCommits func()
+}
+
+// kafkaPartition tracks the messages read from a partition.
+type kafkaPartition struct {
+	topic     string
+	partition int
+	offsets   []int64 // The offsets of the messages read and not committed
+	committed int     // The number of messages committed
+	handled   int     // The number of messages handled
+}
+
+// NewKafkaSource returns a DocumentSource of the JSON objects in the
+// messages of a Kafka topic, or of the Avro records if there is a schema
+// registry, consumed as a member of a consumer group, until ctx is done.
+// Each partition is an input named topic/partition, and the position of a
+// document is its offset.
+func NewKafkaSource(ctx context.Context, opts KafkaOptions) (DocumentSource, error) {
+	if len(opts.Brokers) == 0 || opts.Topic == "" || opts.Group == "" {
+		return nil, errors.New("Kafka brokers, a topic, and a consumer group are needed")
+	}
+	s := &kafkaSource{
+		ctx: ctx,
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: opts.Brokers,
+			Topic:   opts.Topic,
+			GroupID: opts.Group,
+		}),
+		partitions: map[string]*kafkaPartition{},
+	}
+	if opts.SchemaRegistry != "" {
+		s.registry = newSchemaRegistry(ctx, opts.SchemaRegistry)
+	}
+	s.stopCommits = s.commitEvery(opts.CommitInterval)
+	return s, nil
+}
+
+func (s *kafkaSource) Next() (Document, error) {
+	msg, err := s.reader.FetchMessage(s.ctx)
+	if err != nil {
+		if s.ctx.Err() != nil || err == io.EOF {
+			return Document{}, io.EOF
+		}
+		return Document{}, fmt.Errorf("reading from Kafka: %w", err)
+	}
+	name := fmt.Sprintf("%s/%d", msg.Topic, msg.Partition)
+	s.mu.Lock()
+	p := s.partitions[name]
+	if p == nil {
+		p = &kafkaPartition{topic: msg.Topic, partition: msg.Partition}
+		s.partitions[name] = p
+	}
+	p.offsets = append(p.offsets, msg.Offset)
+	s.mu.Unlock()
+	doc := Document{Source: name, Line: int(msg.Offset)}
+	if s.registry != nil {
+		documentMap, err := s.registry.document(msg.Value)
+		if err != nil {
+			logErrorf("%s:%d: %s; not adding", name, msg.Offset, err)
+		}
+		doc.Fields = documentMap
+		return doc, nil
+	}
+	var f interface{}
+	if err := json.Unmarshal(msg.Value, &f); err != nil {
+		logErrorf("%s:%d: Error unmarshalling JSON: %s", name, msg.Offset, err)
+		return doc, nil
+	}
+	documentMap, ok := f.(map[string]interface{})
+	if !ok {
+		logErrorf("%s:%d: message is not a JSON object; not adding", name, msg.Offset)
+		return doc, nil
+	}
+	doc.Fields = documentMap
+	return doc, nil
+}
+
+// Handled notes that the first records messages read from a partition have
+// been handled, so their offsets can be committed.
+func (s *kafkaSource) Handled(name string, records int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p := s.partitions[name]; p != nil && records > p.handled {
+		p.handled = records
+	}
+}
+
+// commit commits the offset of the last message handled in each partition.
+func (s *kafkaSource) commit() error {
+	type commit struct {
+		p       *kafkaPartition
+		handled int
+	}
+	var commits []commit
+	var msgs []kafka.Message
+	s.mu.Lock()
+	for _, p := range s.partitions {
+		if p.handled > p.committed {
+			commits = append(commits, commit{p, p.handled})
+			msgs = append(msgs, kafka.Message{
+				Topic:     p.topic,
+				Partition: p.partition,
+				Offset:    p.offsets[p.handled-p.committed-1],
+			})
+		}
+	}
+	s.mu.Unlock()
+	if len(msgs) == 0 {
+		return nil
+	}
+	// the load's context may be done by now, but what was handled is still
+	// committed
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaCommitTimeout)
+	defer cancel()
+	if err := s.reader.CommitMessages(ctx, msgs...); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	for _, c := range commits {
+		c.p.offsets = c.p.offsets[c.handled-c.p.committed:]
+		c.p.committed = c.handled
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// commitEvery commits the offsets at each interval until the returned
+// function is called. A non-positive interval commits only at the end.
+func (s *kafkaSource) commitEvery(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.commit(); err != nil {
+					logErrorf("Error committing the Kafka offsets: %s", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
+
+// Close commits the offsets of the messages handled, and leaves the
+// consumer group.
+func (s *kafkaSource) Close() error {
+	s.stopCommits()
+	err := s.commit()
+	if closeErr := s.reader.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
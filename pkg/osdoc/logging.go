@@ -0,0 +1,39 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+// Logger receives the messages logged while loading documents, such as the
+// reasons documents are rejected. It must be safe for concurrent use.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// nopLogger is a Logger that discards everything.
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Infof(format string, args ...interface{})  {}
+func (nopLogger) Warnf(format string, args ...interface{})  {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
+
+// logger is the Logger the package logs to.
+var logger Logger = nopLogger{}
+
+// SetLogger sets the Logger the package logs to; it should be called
+// before any documents are loaded. By default, or if l is nil, messages
+// are discarded.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	logger = l
+}
+
+func logDebugf(format string, args ...interface{}) { logger.Debugf(format, args...) }
+func logInfof(format string, args ...interface{})  { logger.Infof(format, args...) }
+func logWarnf(format string, args ...interface{})  { logger.Warnf(format, args...) }
+func logErrorf(format string, args ...interface{}) { logger.Errorf(format, args...) }
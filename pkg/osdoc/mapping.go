@@ -0,0 +1,226 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+)
+
+// indexMapping is the mapping of an index, flattened to the type of each
+// field by its dotted path.
+type indexMapping struct {
+	Types   map[string]string
+	Dynamic string // true, false, or strict
+}
+
+// mappingProperties is the part of a mapping that describes fields.
+type mappingProperties struct {
+	Type       string                       `json:"type"`
+	Dynamic    interface{}                  `json:"dynamic"`
+	Properties map[string]mappingProperties `json:"properties"`
+}
+
+// getIndexMapping fetches the mapping of index. If index matches several
+// indices, their mappings are merged.
+func getIndexMapping(ctx context.Context, client *opensearch.Client, index string) (*indexMapping, error) {
+	res, err := opensearchapi.IndicesGetMappingRequest{Index: []string{index}}.Do(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return nil, fmt.Errorf("getting the mapping of %s: %s", index, res.String())
+	}
+	var body map[string]struct {
+		Mappings mappingProperties `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	mapping := &indexMapping{Types: map[string]string{}, Dynamic: "true"}
+	for _, index := range body {
+		if index.Mappings.Dynamic != nil {
+			mapping.Dynamic = fmt.Sprintf("%v", index.Mappings.Dynamic)
+		}
+		flattenMapping("", index.Mappings.Properties, mapping.Types)
+	}
+	return mapping, nil
+}
+
+func flattenMapping(prefix string, properties map[string]mappingProperties, types map[string]string) {
+	for name, property := range properties {
+		typ := property.Type
+		if typ == "" {
+			typ = "object"
+		}
+		types[prefix+name] = typ
+		flattenMapping(prefix+name+".", property.Properties, types)
+	}
+}
+
+// The kinds of MappingProblem
+const (
+	ProblemConflict = "conflict" // A value of the wrong type, which fails the document
+	ProblemStrict   = "strict"   // An unmapped field in a strict mapping, which fails the document
+	ProblemDynamic  = "dynamic"  // An unmapped field that dynamic mapping would add
+	ProblemIgnored  = "ignored"  // An unmapped field that would be kept in the source but not indexed
+)
+
+// MappingProblem is a field of a document that doesn't fit the mapping of
+// an index.
+type MappingProblem struct {
+	Field  string // The dotted path of the field
+	Kind   string // One of the Problem kinds
+	Detail string // What is wrong, following the field's name
+}
+
+// Fails reports whether the problem would fail the document.
+func (p MappingProblem) Fails() bool {
+	return p.Kind == ProblemConflict || p.Kind == ProblemStrict
+}
+
+// MappingChecker checks documents against the mapping of an index.
+type MappingChecker struct {
+	mapping *indexMapping
+}
+
+// NewMappingChecker fetches the mapping of index, which may be a date
+// pattern, as for Options.Index, to check documents against.
+func NewMappingChecker(ctx context.Context, client *opensearch.Client, index string) (*MappingChecker, error) {
+	mapping, err := getIndexMapping(ctx, client, indexPatternWildcard(index))
+	if err != nil {
+		return nil, err
+	}
+	return &MappingChecker{mapping}, nil
+}
+
+// Dynamic returns the mapping's dynamic setting: true, false, or strict.
+func (c *MappingChecker) Dynamic() string {
+	return c.mapping.Dynamic
+}
+
+// Check returns the problems of each field of document, in order of field.
+func (c *MappingChecker) Check(document map[string]interface{}) []MappingProblem {
+	var problems []MappingProblem
+	c.mapping.checkObject("", document, &problems)
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Field < problems[j].Field })
+	return problems
+}
+
+// check returns a description of each field of document that the mapping
+// would reject: fields of the wrong type, and unmapped fields when the
+// mapping is strict.
+func (m *indexMapping) check(document map[string]interface{}) []string {
+	var problems []MappingProblem
+	m.checkObject("", document, &problems)
+	var rejected []string
+	for _, problem := range problems {
+		if problem.Fails() {
+			rejected = append(rejected, fmt.Sprintf("field '%s' %s", problem.Field, problem.Detail))
+		}
+	}
+	sort.Strings(rejected)
+	return rejected
+}
+
+func (m *indexMapping) checkObject(prefix string, object map[string]interface{}, problems *[]MappingProblem) {
+	for name, value := range object {
+		m.checkValue(prefix+name, value, problems)
+	}
+}
+
+func (m *indexMapping) checkValue(path string, value interface{}, problems *[]MappingProblem) {
+	if values, ok := value.([]interface{}); ok {
+		for _, v := range values {
+			m.checkValue(path, v, problems)
+		}
+		return
+	}
+	typ, mapped := m.Types[path]
+	if !mapped {
+		switch {
+		case m.Dynamic == "strict":
+			*problems = append(*problems, MappingProblem{path, ProblemStrict, "is not in the strict mapping"})
+		case value == nil:
+			// null values don't add fields
+			return
+		case m.Dynamic == "false":
+			*problems = append(*problems, MappingProblem{path, ProblemIgnored, "is not mapped, so it won't be indexed"})
+			return
+		default:
+			// dynamic mapping adds an object's fields along with it
+			*problems = append(*problems, MappingProblem{path, ProblemDynamic, fmt.Sprintf("is not mapped, and dynamic mapping would add it for its %s value", jsonType(value))})
+			return
+		}
+		if object, ok := value.(map[string]interface{}); ok {
+			m.checkObject(path+".", object, problems)
+		}
+		return
+	}
+	if value == nil {
+		return
+	}
+	if !compatibleValue(typ, value) {
+		*problems = append(*problems, MappingProblem{path, ProblemConflict, fmt.Sprintf("has %s value %v but is mapped as %s", jsonType(value), value, typ)})
+		return
+	}
+	if object, ok := value.(map[string]interface{}); ok {
+		m.checkObject(path+".", object, problems)
+	}
+}
+
+// compatibleValue reports whether a JSON value can be indexed as a field of
+// the given mapping type. OpenSearch coerces numeric and boolean strings,
+// so those are allowed.
+func compatibleValue(typ string, value interface{}) bool {
+	switch typ {
+	case "object", "nested", "flattened":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "long", "integer", "short", "byte", "double", "float", "half_float", "scaled_float", "unsigned_long":
+		switch v := value.(type) {
+		case float64, int64, int:
+			return true
+		case string:
+			_, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			return err == nil
+		}
+		return false
+	case "boolean":
+		switch v := value.(type) {
+		case bool:
+			return true
+		case string:
+			return v == "true" || v == "false" || v == ""
+		}
+		return false
+	}
+	_, isObject := value.(map[string]interface{})
+	return !isObject
+}
+
+// jsonType names the JSON type of a decoded value.
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64, int64, int:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
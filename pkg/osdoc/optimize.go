@@ -0,0 +1,119 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/opensearch-project/opensearch-go"
+	"github.com/opensearch-project/opensearch-go/opensearchapi"
+)
+
+// loadSettings are the index settings that slow a bulk load down: refresh,
+// which makes new documents searchable, and replicas, which copy each
+// document again.
+var loadSettings = []string{"index.refresh_interval", "index.number_of_replicas"}
+
+// loadOptimizer turns refresh and replicas off on the indices of a bulk
+// load, and restores them when it ends. A nil *loadOptimizer does nothing.
+type loadOptimizer struct {
+	client   *opensearch.Client
+	original map[string]map[string]interface{} // the loadSettings of each index, nil if unset
+}
+
+// optimizeLoad turns refresh and replicas off on the existing indices
+// matching index, remembering their settings.
+func optimizeLoad(ctx context.Context, client *opensearch.Client, index string) (*loadOptimizer, error) {
+	flat := true
+	res, err := opensearchapi.IndicesGetSettingsRequest{
+		Index:        []string{index},
+		Name:         loadSettings,
+		FlatSettings: &flat,
+	}.Do(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == 404 {
+		return nil, nil
+	}
+	if err := ResponseError(res); err != nil {
+		return nil, err
+	}
+	var body map[string]struct {
+		Settings map[string]interface{} `json:"settings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	o := &loadOptimizer{client: client, original: map[string]map[string]interface{}{}}
+	for name, index := range body {
+		settings := map[string]interface{}{}
+		for _, key := range loadSettings {
+			settings[key] = index.Settings[key]
+		}
+		o.original[name] = settings
+	}
+	if len(o.original) == 0 {
+		return nil, nil
+	}
+	optimized := map[string]interface{}{
+		"index.refresh_interval":   "-1",
+		"index.number_of_replicas": "0",
+	}
+	if err := PutIndexSettings(ctx, client, o.indices(), optimized); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// indices returns the names of the optimized indices, sorted.
+func (o *loadOptimizer) indices() []string {
+	indices := make([]string, 0, len(o.original))
+	for index := range o.original {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+	return indices
+}
+
+// restore puts back the settings of each index and refreshes them, so the
+// documents loaded are searchable at once.
+func (o *loadOptimizer) restore(ctx context.Context) error {
+	if o == nil {
+		return nil
+	}
+	for _, index := range o.indices() {
+		if err := PutIndexSettings(ctx, o.client, []string{index}, o.original[index]); err != nil {
+			return fmt.Errorf("restoring the settings of %s: %w", index, err)
+		}
+	}
+	res, err := opensearchapi.IndicesRefreshRequest{Index: o.indices()}.Do(ctx, o.client)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return ResponseError(res)
+}
+
+// PutIndexSettings updates the settings of indices.
+func PutIndexSettings(ctx context.Context, client *opensearch.Client, indices []string, settings map[string]interface{}) error {
+	body, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	res, err := opensearchapi.IndicesPutSettingsRequest{
+		Index: indices,
+		Body:  bytes.NewReader(body),
+	}.Do(ctx, client)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return ResponseError(res)
+}
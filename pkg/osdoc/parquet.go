@@ -0,0 +1,363 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/schema"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/types"
+)
+
+// parquetBatchRows is the number of rows read from a Parquet file at once.
+const parquetBatchRows = 1000
+
+// readParquet calls add with a document for each row of the Parquet file
+// read from r, keeping only the named top-level columns if there are any.
+// A Parquet file is read starting from its footer, so r is first copied to
+// a temporary file.
+func readParquet(r io.Reader, columns []string, name string, add AddFunc) error {
+	f, err := os.CreateTemp("", "opensearch-doc-*.parquet")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := io.Copy(f, r); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	pr, err := reader.NewParquetReader(parquetFile{f}, nil, 1)
+	if err != nil {
+		return fmt.Errorf("reading the Parquet footer: %w", err)
+	}
+	defer pr.ReadStop()
+	s := newParquetSchema(pr.SchemaHandler)
+	keep := map[string]bool{}
+	for _, column := range columns {
+		if !s.hasColumn(column) {
+			return fmt.Errorf("there is no column '%s'", column)
+		}
+		keep[column] = true
+	}
+	rows := int(pr.GetNumRows())
+	for row := 0; row < rows; {
+		n := parquetBatchRows
+		if rows-row < n {
+			n = rows - row
+		}
+		batch, err := pr.ReadByNumber(n)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		for _, value := range batch {
+			row++
+			document, _ := s.convert(0, reflect.ValueOf(value)).(map[string]interface{})
+			if len(keep) > 0 {
+				for field := range document {
+					if !keep[field] {
+						delete(document, field)
+					}
+				}
+			}
+			if err := add(row, document); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parquetFile is a local Parquet file, opened again for each column read.
+type parquetFile struct {
+	*os.File
+}
+
+func (f parquetFile) Open(name string) (source.ParquetFile, error) {
+	if name != "" {
+		return nil, fmt.Errorf("columns stored in other files, such as '%s', aren't supported", name)
+	}
+	g, err := os.Open(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	return parquetFile{g}, nil
+}
+
+func (f parquetFile) Create(name string) (source.ParquetFile, error) {
+	return nil, errors.New("Parquet files are only read")
+}
+
+// parquetSchema converts the rows read from a Parquet file, as values of
+// the types the reader makes from the schema, to JSON values, using the
+// schema's logical types.
+type parquetSchema struct {
+	handler  *schema.SchemaHandler
+	children [][]int // The indexes of the elements of each group
+}
+
+func newParquetSchema(handler *schema.SchemaHandler) *parquetSchema {
+	s := &parquetSchema{handler: handler, children: make([][]int, len(handler.SchemaElements))}
+	// the elements are listed depth first, with the number of children
+	// of each group
+	var walk func(i int) int
+	walk = func(i int) int {
+		next := i + 1
+		for c := 0; c < int(handler.SchemaElements[i].GetNumChildren()); c++ {
+			s.children[i] = append(s.children[i], next)
+			next = walk(next)
+		}
+		return next
+	}
+	if len(handler.SchemaElements) > 0 {
+		walk(0)
+	}
+	return s
+}
+
+// hasColumn reports whether there is a top-level column with the name.
+func (s *parquetSchema) hasColumn(name string) bool {
+	for _, c := range s.children[0] {
+		if s.handler.Infos[c].ExName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// convert returns the JSON value of v, a value of schema element i. Null
+// values are nil, and null fields are left out of objects.
+func (s *parquetSchema) convert(i int, v reflect.Value) interface{} {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	children := s.children[i]
+	switch {
+	case len(children) == 0:
+		if v.Kind() == reflect.Slice {
+			// a repeated value
+			values := make([]interface{}, v.Len())
+			for j := range values {
+				values[j] = s.scalar(i, v.Index(j).Interface())
+			}
+			return values
+		}
+		return s.scalar(i, v.Interface())
+	case v.Kind() == reflect.Map:
+		// a MAP group, with a key_value group of a key and a value
+		key, value := s.children[children[0]][0], s.children[children[0]][1]
+		values := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			values[fmt.Sprint(s.convert(key, iter.Key()))] = s.convert(value, iter.Value())
+		}
+		return values
+	case v.Kind() == reflect.Slice:
+		// a LIST group, with a repeated group of an element, or a repeated
+		// group
+		element := i
+		if s.isList(i) {
+			element = s.children[children[0]][0]
+		}
+		values := make([]interface{}, v.Len())
+		for j := range values {
+			values[j] = s.convert(element, v.Index(j))
+		}
+		return values
+	}
+	fields := make(map[string]interface{}, len(children))
+	for j, c := range children {
+		if value := s.convert(c, v.Field(j)); value != nil {
+			fields[s.handler.Infos[c].ExName] = value
+		}
+	}
+	return fields
+}
+
+// isList reports whether element i is a LIST group read as a slice of its
+// elements, as the reader does with the standard three-level layout.
+func (s *parquetSchema) isList(i int) bool {
+	e := s.handler.SchemaElements[i]
+	if !e.IsSetConvertedType() || e.GetConvertedType() != parquet.ConvertedType_LIST || len(s.children[i]) != 1 {
+		return false
+	}
+	list := s.children[i][0]
+	return s.handler.Infos[list].InName == "List" && len(s.children[list]) == 1 &&
+		s.handler.Infos[s.children[list][0]].InName == "Element"
+}
+
+// scalar returns the JSON value of x, a value of the primitive schema
+// element i: timestamps and dates as strings OpenSearch parses as dates,
+// decimals as numbers, and binary data that isn't text as base64.
+func (s *parquetSchema) scalar(i int, x interface{}) interface{} {
+	e := s.handler.SchemaElements[i]
+	logical := e.GetLogicalType()
+	converted := parquet.ConvertedType(-1)
+	if e.IsSetConvertedType() {
+		converted = e.GetConvertedType()
+	}
+	switch {
+	case e.IsSetType() && e.GetType() == parquet.Type_INT96:
+		return types.INT96ToTime(x.(string)).Format(time.RFC3339Nano)
+	case logical != nil && logical.DECIMAL != nil:
+		return decimalValue(x, int(logical.DECIMAL.Scale), int(logical.DECIMAL.Precision))
+	case converted == parquet.ConvertedType_DECIMAL:
+		return decimalValue(x, int(e.GetScale()), int(e.GetPrecision()))
+	case logical != nil && logical.TIMESTAMP != nil:
+		return timestampValue(x.(int64), logical.TIMESTAMP.Unit, logical.TIMESTAMP.IsAdjustedToUTC)
+	case converted == parquet.ConvertedType_TIMESTAMP_MILLIS:
+		return timestampValue(x.(int64), &parquet.TimeUnit{MILLIS: &parquet.MilliSeconds{}}, true)
+	case converted == parquet.ConvertedType_TIMESTAMP_MICROS:
+		return timestampValue(x.(int64), &parquet.TimeUnit{MICROS: &parquet.MicroSeconds{}}, true)
+	case logical != nil && logical.DATE != nil, converted == parquet.ConvertedType_DATE:
+		return time.Unix(int64(x.(int32))*24*60*60, 0).UTC().Format("2006-01-02")
+	case logical != nil && logical.TIME != nil:
+		return timeOfDayValue(x, logical.TIME.Unit)
+	case converted == parquet.ConvertedType_TIME_MILLIS:
+		return timeOfDayValue(x, &parquet.TimeUnit{MILLIS: &parquet.MilliSeconds{}})
+	case converted == parquet.ConvertedType_TIME_MICROS:
+		return timeOfDayValue(x, &parquet.TimeUnit{MICROS: &parquet.MicroSeconds{}})
+	case logical != nil && logical.UUID != nil:
+		b := []byte(x.(string))
+		if len(b) == 16 {
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+		}
+	case converted == parquet.ConvertedType_UINT_32:
+		return int64(uint32(x.(int32)))
+	case converted == parquet.ConvertedType_UINT_64:
+		return unsignedValue(uint64(x.(int64)))
+	}
+	if b, ok := x.(string); ok && !utf8.ValidString(b) {
+		return base64.StdEncoding.EncodeToString([]byte(b))
+	}
+	return widenNumber(x)
+}
+
+// widenNumber returns a float32 as a float64, and an int32 as an int64, the
+// number types decoded JSON has, which schemas and mapping checks expect.
+// Other values are returned as they are.
+func widenNumber(x interface{}) interface{} {
+	switch x := x.(type) {
+	case float32:
+		// by way of its shortest decimal form, so 0.1 stays 0.1
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(float64(x), 'g', -1, 32), 64)
+		return f
+	case int32:
+		return int64(x)
+	}
+	return x
+}
+
+// unsignedValue returns an unsigned 64-bit integer as an int64 if it fits,
+// and as a string of its digits otherwise, as decimalNumber does.
+func unsignedValue(u uint64) interface{} {
+	if u <= math.MaxInt64 {
+		return int64(u)
+	}
+	return strconv.FormatUint(u, 10)
+}
+
+// decimalValue returns a decimal, stored as an unscaled int32, int64, or
+// big-endian two's complement bytes, as decimalNumber does.
+func decimalValue(x interface{}, scale int, precision int) interface{} {
+	unscaled := new(big.Int)
+	switch x := x.(type) {
+	case int32:
+		unscaled.SetInt64(int64(x))
+	case int64:
+		unscaled.SetInt64(x)
+	case string:
+		unscaled.SetBytes([]byte(x))
+		if len(x) > 0 && x[0]&0x80 != 0 {
+			unscaled.Sub(unscaled, new(big.Int).Lsh(big.NewInt(1), uint(len(x))*8))
+		}
+	default:
+		return x
+	}
+	digits := new(big.Int).Abs(unscaled).String()
+	if scale > 0 {
+		if len(digits) <= scale {
+			digits = strings.Repeat("0", scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+	}
+	if unscaled.Sign() < 0 {
+		digits = "-" + digits
+	}
+	return decimalNumber(digits, precision)
+}
+
+// decimalNumber returns the digits of a decimal with the precision as a
+// float64 if it has few enough digits to be exact, and as a string
+// otherwise, which OpenSearch also accepts for numeric fields.
+func decimalNumber(digits string, precision int) interface{} {
+	if precision <= 15 {
+		if f, err := strconv.ParseFloat(digits, 64); err == nil {
+			return f
+		}
+	}
+	return digits
+}
+
+// timestampValue returns a timestamp in the unit as an RFC 3339 string,
+// without a time zone if it isn't adjusted to UTC.
+func timestampValue(n int64, unit *parquet.TimeUnit, utc bool) string {
+	var t time.Time
+	switch {
+	case unit.IsSetNANOS():
+		t = time.Unix(0, n)
+	case unit.IsSetMICROS():
+		t = time.UnixMicro(n)
+	default:
+		t = time.UnixMilli(n)
+	}
+	if !utc {
+		return t.UTC().Format("2006-01-02T15:04:05.999999999")
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// timeOfDayValue returns a time of day, as an int32 or int64 in the unit
+// since midnight, as an HH:MM:SS string.
+func timeOfDayValue(x interface{}, unit *parquet.TimeUnit) interface{} {
+	var n int64
+	switch x := x.(type) {
+	case int32:
+		n = int64(x)
+	case int64:
+		n = x
+	default:
+		return x
+	}
+	d := time.Duration(n) * time.Millisecond
+	switch {
+	case unit.IsSetNANOS():
+		d = time.Duration(n)
+	case unit.IsSetMICROS():
+		d = time.Duration(n) * time.Microsecond
+	}
+	return time.Time{}.Add(d).Format("15:04:05.999999999")
+}
@@ -0,0 +1,50 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import "time"
+
+// tokenBucket limits the rate of some quantity, such as documents or bytes,
+// to a number per second, allowing bursts of up to one second's worth. A nil
+// tokenBucket doesn't limit anything. It is not safe for concurrent use.
+type tokenBucket struct {
+	rate   float64 // tokens per second
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a bucket that allows rate tokens per second, or nil
+// if rate isn't positive.
+func newTokenBucket(rate float64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// wait takes n tokens from the bucket, first sleeping until they have
+// accumulated. A request for more than the bucket holds goes through once
+// the bucket is full, leaving it in debt.
+func (b *tokenBucket) wait(n int) {
+	if b == nil {
+		return
+	}
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	need := float64(n)
+	if need > b.rate {
+		need = b.rate
+	}
+	if b.tokens < need {
+		delay := time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+		time.Sleep(delay)
+		b.tokens = need
+		b.last = b.last.Add(delay)
+	}
+	b.tokens -= float64(n)
+}
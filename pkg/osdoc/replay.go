@@ -0,0 +1,132 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/opensearch-project/opensearch-go/opensearchutil"
+)
+
+// Replay sends the items of a _bulk request body read from r, which may be
+// compressed, such as one written with ToFile or captured from traffic:
+// each action and metadata line, followed by its document line unless it is
+// a delete. The items go through the indexer as they are, so the requests
+// are sized by FlushBytes and retried like any others, and the checkpoint
+// counts them as records; the Options that change documents don't apply.
+// The indexer sets the ingest pipeline for each request, so the pipeline
+// of an item is replaced by the Pipeline option.
+func (l *BulkLoader) Replay(name string, r io.Reader) error {
+	if l.opts.DryRun {
+		return errors.New("a bulk request body can't be replayed in a dry run")
+	}
+	r, closeReader, err := decompress(r)
+	if err != nil {
+		return fmt.Errorf("decompressing: %w", err)
+	}
+	defer closeReader()
+	br := bufio.NewReaderSize(r, 64*1024)
+	skip := l.checkpoint.resumeFrom(name)
+	if skip > 0 {
+		logInfof("%s: Resuming after %d records", name, skip)
+	}
+	lines, record := 0, 0
+	warnedPipeline := false
+	for l.reading.Err() == nil {
+		actionLine, err := readLine(br, l.opts.MaxLineBytes)
+		if err == io.EOF {
+			return nil
+		}
+		lines++
+		if err != nil {
+			return fmt.Errorf("%s:%d: reading the action: %w", name, lines, err)
+		}
+		if len(bytes.TrimSpace(actionLine)) == 0 {
+			continue
+		}
+		line := lines
+		action, meta, err := parseBulkAction(actionLine)
+		if err != nil {
+			// without the action, the document lines can't be told apart
+			return fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		var document []byte
+		tooLong := false
+		if action != "delete" {
+			document, err = readLine(br, l.opts.MaxLineBytes)
+			switch {
+			case err == io.EOF:
+				return fmt.Errorf("%s:%d: the %s action has no document", name, line, action)
+			case err == errLineTooLong:
+				tooLong = true
+			case err != nil:
+				return err
+			}
+			lines++
+		}
+		record++
+		if record <= skip {
+			continue
+		}
+		if tooLong {
+			logErrorf("%s:%d: line too long; not adding", name, line+1)
+			l.reject(name, record)
+			continue
+		}
+		if meta.Pipeline != "" && meta.Pipeline != l.opts.Pipeline && !warnedPipeline {
+			logWarnf("%s:%d: the items' pipelines are replaced by --pipeline", name, line)
+			warnedPipeline = true
+		}
+		index := meta.Index
+		if index == l.opts.Index {
+			index = ""
+		}
+		item := opensearchutil.BulkIndexerItem{
+			Action:          action,
+			Index:           index,
+			DocumentID:      meta.ID,
+			Routing:         meta.Routing,
+			Version:         meta.Version,
+			VersionType:     meta.VersionType,
+			RetryOnConflict: meta.RetryOnConflict,
+		}
+		if document != nil {
+			item.Body = bytes.NewReader(document)
+		}
+		if err := l.send(name, line, record, item, len(document), document); err != nil {
+			// a cancelled load ends like a stopped one; Close reports why
+			if l.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		l.added++
+	}
+	return nil
+}
+
+// parseBulkAction returns the action and metadata of an action line of a
+// bulk request body.
+func parseBulkAction(line []byte) (string, bulkMeta, error) {
+	var actions map[string]bulkMeta
+	if err := json.Unmarshal(line, &actions); err != nil {
+		return "", bulkMeta{}, fmt.Errorf("parsing the action: %w", err)
+	}
+	if len(actions) != 1 {
+		return "", bulkMeta{}, fmt.Errorf("an action line needs a single action, not %d", len(actions))
+	}
+	var action string
+	var meta bulkMeta
+	for action, meta = range actions {
+	}
+	if !validAction(action) {
+		return "", bulkMeta{}, fmt.Errorf("unknown action '%s'", action)
+	}
+	return action, meta, nil
+}
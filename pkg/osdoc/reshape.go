@@ -0,0 +1,84 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// reshape makes simple changes to each document: renaming fields, dropping
+// them, and setting them to fixed values or to the time the document was
+// read. Fields may be dotted paths.
+type reshape struct {
+	renames   []fieldRename
+	drops     [][]string
+	sets      []fieldValue
+	timestamp []string // The keys of the timestamp field, if any
+}
+
+type fieldRename struct {
+	from, to []string
+}
+
+type fieldValue struct {
+	keys  []string
+	value interface{}
+}
+
+// newReshape parses the --rename old=new, --drop field, and --set
+// key=value flags. A value that is valid JSON, such as 42, true, or
+// ["a","b"], is set as that value; any other value is set as a string.
+func newReshape(renames, drops, sets []string, timestampField string) (*reshape, error) {
+	if len(renames) == 0 && len(drops) == 0 && len(sets) == 0 && timestampField == "" {
+		return nil, nil
+	}
+	r := &reshape{}
+	for _, rename := range renames {
+		from, to, ok := strings.Cut(rename, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("--rename %q is not of the form old=new", rename)
+		}
+		r.renames = append(r.renames, fieldRename{SplitFieldPath(from), SplitFieldPath(to)})
+	}
+	for _, drop := range drops {
+		r.drops = append(r.drops, SplitFieldPath(drop))
+	}
+	for _, set := range sets {
+		key, text, ok := strings.Cut(set, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("--set %q is not of the form key=value", set)
+		}
+		var value interface{}
+		if err := json.Unmarshal([]byte(text), &value); err != nil {
+			value = text
+		}
+		r.sets = append(r.sets, fieldValue{SplitFieldPath(key), value})
+	}
+	if timestampField != "" {
+		r.timestamp = SplitFieldPath(timestampField)
+	}
+	return r, nil
+}
+
+// apply changes document in place: renames first, then drops, then sets.
+func (r *reshape) apply(document map[string]interface{}) {
+	for _, rename := range r.renames {
+		if value := LookupField(document, rename.from); value != nil {
+			deleteField(document, rename.from)
+			SetField(document, rename.to, value)
+		}
+	}
+	for _, keys := range r.drops {
+		deleteField(document, keys)
+	}
+	for _, set := range r.sets {
+		SetField(document, set.keys, set.value)
+	}
+	if r.timestamp != nil {
+		SetField(document, r.timestamp, time.Now().UTC().Format(time.RFC3339Nano))
+	}
+}
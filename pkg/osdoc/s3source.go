@@ -0,0 +1,103 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// NewS3Source returns a DocumentSource of the documents parsed from the S3
+// objects at location, in key order: s3://bucket/key for one object,
+// s3://bucket/prefix/ (ending with a slash) for every object under the
+// prefix, or a glob pattern such as s3://bucket/prefix/*.ndjson.gz for the
+// objects whose keys match it, where * doesn't match a slash. The objects
+// are listed when the first is opened, and each is streamed as it is read.
+func NewS3Source(ctx context.Context, client *s3.S3, location string, parse Parser) (DocumentSource, error) {
+	bucket, key, err := parseS3URL(location)
+	if err != nil {
+		return nil, err
+	}
+	pattern := ""
+	if i := strings.IndexAny(key, "*?["); i >= 0 {
+		if _, err := path.Match(key, ""); err != nil {
+			return nil, fmt.Errorf("'%s': %w", location, err)
+		}
+		pattern, key = key, key[:i]
+	}
+	var keys []string
+	listed := false
+	return newStreamSource(func() (string, io.ReadCloser, error) {
+		if !listed {
+			listed = true
+			if pattern != "" || key == "" || strings.HasSuffix(key, "/") {
+				keys, err = listS3Keys(ctx, client, bucket, key, pattern)
+				if err != nil {
+					return "", nil, fmt.Errorf("listing %s: %w", location, err)
+				}
+				if len(keys) == 0 {
+					logWarnf("No S3 objects match %s", location)
+				}
+			} else {
+				keys = []string{key}
+			}
+		}
+		if len(keys) == 0 {
+			return "", nil, io.EOF
+		}
+		name := "s3://" + bucket + "/" + keys[0]
+		out, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(keys[0]),
+		})
+		keys = keys[1:]
+		if err != nil {
+			return "", nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return name, out.Body, nil
+	}, parse), nil
+}
+
+// parseS3URL returns the bucket and key of an s3://bucket/key URL. The key
+// is taken as it is, since it may be a glob pattern with a ? in it.
+func parseS3URL(location string) (bucket string, key string, err error) {
+	rest := strings.TrimPrefix(location, "s3://")
+	bucket, key, _ = strings.Cut(rest, "/")
+	if rest == location || bucket == "" {
+		return "", "", fmt.Errorf("'%s' isn't an s3://bucket/key URL", location)
+	}
+	return bucket, key, nil
+}
+
+// listS3Keys returns the keys of the objects in bucket under prefix, and
+// matching pattern if it isn't empty, in order, leaving out "directory"
+// placeholders.
+func listS3Keys(ctx context.Context, client *s3.S3, bucket string, prefix string, pattern string) ([]string, error) {
+	var keys []string
+	err := client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, last bool) bool {
+		for _, object := range page.Contents {
+			key := aws.StringValue(object.Key)
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+			if pattern != "" {
+				if ok, _ := path.Match(pattern, key); !ok {
+					continue
+				}
+			}
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys, err
+}
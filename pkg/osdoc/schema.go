@@ -0,0 +1,45 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// compileSchema reads and compiles the JSON Schema in the named file.
+func compileSchema(path string) (*jsonschema.Schema, error) {
+	return jsonschema.Compile(path)
+}
+
+// schemaProblems validates document against schema and returns a
+// description of each way it fails, or nil if it is valid.
+func schemaProblems(schema *jsonschema.Schema, document map[string]interface{}) []string {
+	err := schema.Validate(document)
+	if err == nil {
+		return nil
+	}
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []string{err.Error()}
+	}
+	var problems []string
+	var collect func(e *jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			location := e.InstanceLocation
+			if location == "" {
+				location = "/"
+			}
+			problems = append(problems, fmt.Sprintf("%s: %s", location, e.Message))
+		}
+		for _, cause := range e.Causes {
+			collect(cause)
+		}
+	}
+	collect(validationErr)
+	return problems
+}
@@ -0,0 +1,210 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DocumentSource is where the documents of a load come from, such as
+// stdin, files, S3 objects, or URLs.
+type DocumentSource interface {
+	// Next returns the next document, or io.EOF once there are no more.
+	// Any other error is for an input that couldn't be opened or read to
+	// the end; Next can be called again to go on with the next input.
+	Next() (Document, error)
+	// Close stops reading and releases the source's inputs.
+	Close() error
+}
+
+// Acknowledger is a DocumentSource that is told as its documents are
+// handled, such as one that commits its position in a stream.
+type Acknowledger interface {
+	// Handled is called, from the indexer's workers, with the number of
+	// records from the start of the named input that have all been handled:
+	// indexed, failed, or skipped.
+	Handled(name string, records int)
+}
+
+// Document is a record read from a DocumentSource, before any of the
+// loader's changes, with where it came from.
+type Document struct {
+	Fields map[string]interface{} // The document, or nil if the record couldn't be parsed
+	Source string                 // The name of the input, such as a file name or URL
+	Line   int                    // The line, or position, of the record in the input
+}
+
+// Parser parses the records read from r, calling add with each one, as
+// BulkLoader.Parse does. It stops and returns the error if add returns one.
+type Parser func(name string, r io.Reader, add AddFunc) error
+
+// opener opens the inputs of a streamSource in turn, returning io.EOF after
+// the last one.
+type opener func() (name string, r io.ReadCloser, err error)
+
+// streamSource is a DocumentSource of the documents parsed from a sequence
+// of inputs. Each input is parsed in a goroutine that hands the documents
+// over one at a time, so no more than one is held at once.
+type streamSource struct {
+	open  opener
+	parse Parser
+
+	// For the input being parsed: its name, the documents, and the error
+	// parsing it, once it has been parsed
+	name  string
+	input io.ReadCloser
+	docs  chan Document
+	ended chan error
+
+	done      chan struct{} // Closed by Close, to stop parsing
+	closeOnce sync.Once
+}
+
+func newStreamSource(open opener, parse Parser) *streamSource {
+	return &streamSource{open: open, parse: parse, done: make(chan struct{})}
+}
+
+func (s *streamSource) Next() (Document, error) {
+	for {
+		if s.docs == nil {
+			name, r, err := s.open()
+			if err != nil {
+				return Document{}, err
+			}
+			s.start(name, r)
+		}
+		select {
+		case doc := <-s.docs:
+			return doc, nil
+		case err := <-s.ended:
+			name := s.name
+			s.finish()
+			if err != nil && err != ErrStopped {
+				return Document{}, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+}
+
+// start parses an input in a goroutine.
+func (s *streamSource) start(name string, r io.ReadCloser) {
+	docs, ended, done := make(chan Document), make(chan error, 1), s.done
+	s.name, s.input, s.docs, s.ended = name, r, docs, ended
+	go func() {
+		ended <- s.parse(name, r, func(line int, fields map[string]interface{}) error {
+			select {
+			case docs <- Document{Fields: fields, Source: name, Line: line}:
+				return nil
+			case <-done:
+				return ErrStopped
+			}
+		})
+	}()
+}
+
+// finish closes the input that has been parsed.
+func (s *streamSource) finish() {
+	s.input.Close()
+	s.name, s.input, s.docs, s.ended = "", nil, nil, nil
+}
+
+// Close stops the parsing goroutine, if there is one, at its next document;
+// it isn't waited for, since it may be blocked reading the input.
+func (s *streamSource) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if s.docs != nil {
+			s.finish()
+		}
+	})
+	return nil
+}
+
+// NewReaderSource returns a DocumentSource of the documents parsed from r,
+// such as stdin. Closing the source doesn't close r.
+func NewReaderSource(name string, r io.Reader, parse Parser) DocumentSource {
+	opened := false
+	return newStreamSource(func() (string, io.ReadCloser, error) {
+		if opened {
+			return "", nil, io.EOF
+		}
+		opened = true
+		return name, io.NopCloser(r), nil
+	}, parse)
+}
+
+// NewFileSource returns a DocumentSource of the documents parsed from each
+// of the named files in turn.
+func NewFileSource(names []string, parse Parser) DocumentSource {
+	i := 0
+	return newStreamSource(func() (string, io.ReadCloser, error) {
+		if i == len(names) {
+			return "", nil, io.EOF
+		}
+		name := names[i]
+		i++
+		f, err := os.Open(name)
+		if err != nil {
+			return "", nil, err
+		}
+		return name, f, nil
+	}, parse)
+}
+
+// NewGlobSource returns a DocumentSource of the documents parsed from each
+// of the files matching the glob patterns in turn.
+func NewGlobSource(patterns []string, parse Parser) DocumentSource {
+	return NewFileSource(ExpandGlobs(patterns), parse)
+}
+
+// ExpandGlobs expands the glob patterns, keeping those that match nothing,
+// so that opening them reports a useful error.
+func ExpandGlobs(patterns []string) []string {
+	var names []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil || len(matches) == 0 {
+			names = append(names, pattern)
+			continue
+		}
+		names = append(names, matches...)
+	}
+	return names
+}
+
+// multiSource is a DocumentSource of the documents of several sources, one
+// after the other.
+type multiSource struct {
+	sources []DocumentSource
+}
+
+// MultiSource returns a DocumentSource of the documents of each of sources
+// in turn.
+func MultiSource(sources ...DocumentSource) DocumentSource {
+	return &multiSource{sources: sources}
+}
+
+func (m *multiSource) Next() (Document, error) {
+	for len(m.sources) > 0 {
+		doc, err := m.sources[0].Next()
+		if err != io.EOF {
+			return doc, err
+		}
+		m.sources[0].Close()
+		m.sources = m.sources[1:]
+	}
+	return Document{}, io.EOF
+}
+
+func (m *multiSource) Close() error {
+	for _, source := range m.sources {
+		source.Close()
+	}
+	m.sources = nil
+	return nil
+}
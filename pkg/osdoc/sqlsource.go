@@ -0,0 +1,127 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// sqlSource is a DocumentSource of the rows of a query, streamed from the
+// database as they are read.
+type sqlSource struct {
+	ctx   context.Context
+	db    *sql.DB
+	name  string
+	query string
+
+	rows    *sql.Rows
+	columns []*sql.ColumnType
+	row     int
+	done    bool
+}
+
+// NewSQLSource returns a DocumentSource of the rows the query returns, run
+// with ctx on the database with the driver and data source name: each row
+// is a document with a field for each non-null column. The input is named
+// for the driver, and the position of a document is its row number, so
+// the query needs an ORDER BY for a checkpoint to be resumed. The driver
+// must have been registered, by importing it.
+func NewSQLSource(ctx context.Context, driver string, dsn string, query string) (DocumentSource, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlSource{ctx: ctx, db: db, name: driver, query: query}, nil
+}
+
+func (s *sqlSource) Next() (Document, error) {
+	if s.done {
+		return Document{}, io.EOF
+	}
+	if s.rows == nil {
+		rows, err := s.db.QueryContext(s.ctx, s.query)
+		if err != nil {
+			s.done = true
+			return Document{}, err
+		}
+		s.rows = rows
+		s.columns, err = rows.ColumnTypes()
+		if err != nil {
+			s.done = true
+			return Document{}, err
+		}
+	}
+	if !s.rows.Next() {
+		s.done = true
+		// a query stopped by ctx is done, not failed
+		if err := s.rows.Err(); err != nil && s.ctx.Err() == nil {
+			return Document{}, err
+		}
+		return Document{}, io.EOF
+	}
+	s.row++
+	values := make([]interface{}, len(s.columns))
+	for i := range values {
+		values[i] = new(interface{})
+	}
+	doc := Document{Source: s.name, Line: s.row}
+	if err := s.rows.Scan(values...); err != nil {
+		logErrorf("%s:%d: Error reading the row: %s", s.name, s.row, err)
+		return doc, nil
+	}
+	doc.Fields = make(map[string]interface{}, len(s.columns))
+	for i, column := range s.columns {
+		if value := sqlValue(*values[i].(*interface{}), column.DatabaseTypeName()); value != nil {
+			doc.Fields[column.Name()] = value
+		}
+	}
+	return doc, nil
+}
+
+// sqlValue returns the JSON value of a column value of the database type.
+// Drivers return many types as bytes, which are converted by the type's
+// name: numbers to numbers, JSON to its value, and binary data that isn't
+// text to base64. Times are RFC 3339 strings.
+func sqlValue(value interface{}, typeName string) interface{} {
+	switch value := value.(type) {
+	case []byte:
+		switch strings.ToUpper(typeName) {
+		case "INT", "INTEGER", "TINYINT", "SMALLINT", "MEDIUMINT", "BIGINT",
+			"INT2", "INT4", "INT8", "DECIMAL", "NUMERIC", "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "REAL":
+			return inferValue(string(value))
+		case "JSON", "JSONB":
+			var v interface{}
+			if err := json.Unmarshal(value, &v); err == nil {
+				return v
+			}
+		}
+		if !utf8.Valid(value) {
+			return base64.StdEncoding.EncodeToString(value)
+		}
+		return string(value)
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	}
+	return value
+}
+
+// Close closes the query's rows, ending the query, and the database.
+func (s *sqlSource) Close() error {
+	s.done = true
+	if s.rows != nil {
+		s.rows.Close()
+	}
+	return s.db.Close()
+}
@@ -0,0 +1,64 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"fmt"
+
+	"github.com/itchyny/gojq"
+)
+
+// transform is a compiled jq expression that reshapes or tests documents.
+type transform struct {
+	code *gojq.Code
+}
+
+// newTransform compiles the jq expression expr.
+func newTransform(expr string) (*transform, error) {
+	query, err := gojq.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, err
+	}
+	return &transform{code: code}, nil
+}
+
+// apply runs the expression on document and returns the documents it
+// produces: none if it yields nothing, as with select, and several if it
+// yields several, as with .items[].
+func (t *transform) apply(document map[string]interface{}) ([]map[string]interface{}, error) {
+	var documents []map[string]interface{}
+	iter := t.code.Run(document)
+	for {
+		value, ok := iter.Next()
+		if !ok {
+			return documents, nil
+		}
+		if err, ok := value.(error); ok {
+			return nil, err
+		}
+		result, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("transform produced %s, not an object", jsonType(value))
+		}
+		documents = append(documents, result)
+	}
+}
+
+// test reports whether the expression's first result for document is true,
+// that is, anything but false or null.
+func (t *transform) test(document map[string]interface{}) (bool, error) {
+	iter := t.code.Run(document)
+	value, ok := iter.Next()
+	if !ok {
+		return false, nil
+	}
+	if err, ok := value.(error); ok {
+		return false, err
+	}
+	return value != nil && value != false, nil
+}
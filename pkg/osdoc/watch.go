@@ -0,0 +1,208 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSource is a DocumentSource of the lines of JSON written to the files
+// of a directory, as they are created or appended to. Only complete lines
+// are read; the rest of a line is read once its newline is written.
+type watchSource struct {
+	*streamSource
+	ctx     context.Context
+	dir     string
+	pattern string
+	watcher *fsnotify.Watcher
+
+	offsets  map[string]int64 // The bytes of each file read
+	lines    map[string]int   // The lines of each file read
+	restarts map[string]bool  // The files read from the start again, truncated or replaced
+
+	// The files that may have new lines, in the order they changed
+	pending []string
+	queued  map[string]bool
+}
+
+// NewWatchSource returns a DocumentSource of the JSON objects, one per line,
+// in the files of dir whose names match pattern: first those already
+// there, then the lines added to them and to new files as they are
+// written. It has no more documents once ctx is done.
+func NewWatchSource(ctx context.Context, dir string, pattern string, maxLineBytes int) (DocumentSource, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("'%s': %w", pattern, err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// watch before listing, so no file written in between is missed
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	names, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	sort.Strings(names)
+	w := &watchSource{
+		ctx:      ctx,
+		dir:      dir,
+		pattern:  pattern,
+		watcher:  watcher,
+		offsets:  map[string]int64{},
+		lines:    map[string]int{},
+		restarts: map[string]bool{},
+		queued:   map[string]bool{},
+	}
+	for _, name := range names {
+		w.queue(name)
+	}
+	w.streamSource = newStreamSource(w.open, func(name string, r io.Reader, add AddFunc) error {
+		// number the lines after those already read
+		return readJSONLinesAfter(r, maxLineBytes, name, w.lines[name], func(line int, document map[string]interface{}) error {
+			w.lines[name] = line
+			return add(line, document)
+		})
+	})
+	return w, nil
+}
+
+// open returns the new lines of the next file that has any, waiting for
+// files to change.
+func (w *watchSource) open() (string, io.ReadCloser, error) {
+	for {
+		for len(w.pending) > 0 {
+			name := w.pending[0]
+			w.pending = w.pending[1:]
+			delete(w.queued, name)
+			r, err := w.newLines(name)
+			if err != nil {
+				return "", nil, err
+			}
+			if r != nil {
+				return name, r, nil
+			}
+		}
+		select {
+		case <-w.ctx.Done():
+			return "", nil, io.EOF
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return "", nil, io.EOF
+			}
+			w.handle(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return "", nil, io.EOF
+			}
+			return "", nil, fmt.Errorf("watching %s: %w", w.dir, err)
+		}
+	}
+}
+
+// handle notes a change to a file of the directory.
+func (w *watchSource) handle(event fsnotify.Event) {
+	if ok, _ := filepath.Match(w.pattern, filepath.Base(event.Name)); !ok {
+		return
+	}
+	switch {
+	case event.Op&(fsnotify.Create|fsnotify.Write) != 0:
+		w.queue(event.Name)
+	case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		if w.lines[event.Name] > 0 {
+			w.restarts[event.Name] = true
+		}
+		delete(w.offsets, event.Name)
+		delete(w.lines, event.Name)
+	}
+}
+
+func (w *watchSource) queue(name string) {
+	if !w.queued[name] {
+		w.queued[name] = true
+		w.pending = append(w.pending, name)
+	}
+}
+
+// newLines returns a reader of the complete lines of a file after those
+// already read, or nil if there are none.
+func (w *watchSource) newLines(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		f.Close()
+		return nil, err
+	}
+	offset := w.offsets[name]
+	if info.Size() < offset {
+		logWarnf("%s: File was truncated; reading it from the start", name)
+		offset = 0
+		w.lines[name] = 0
+		w.restarts[name] = true
+	}
+	end, err := lastLineEnd(f, offset, info.Size())
+	if err != nil || end <= offset {
+		f.Close()
+		return nil, err
+	}
+	w.offsets[name] = end
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, offset, end-offset), f}, nil
+}
+
+// lastLineEnd returns the offset just after the last newline in f between
+// start and end, or start if there isn't one.
+func lastLineEnd(f *os.File, start int64, end int64) (int64, error) {
+	buf := make([]byte, 64*1024)
+	for end > start {
+		n := int64(len(buf))
+		if end-start < n {
+			n = end - start
+		}
+		if _, err := f.ReadAt(buf[:n], end-n); err != nil {
+			return start, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			return end - n + int64(i) + 1, nil
+		}
+		end -= n
+	}
+	return start, nil
+}
+
+// restarted reports whether the named file has been read from the start
+// again since this was last called for it, so its records are numbered
+// afresh.
+func (w *watchSource) restarted(name string) bool {
+	if !w.restarts[name] {
+		return false
+	}
+	delete(w.restarts, name)
+	return true
+}
+
+func (w *watchSource) Close() error {
+	w.streamSource.Close()
+	return w.watcher.Close()
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// readXML calls add with a document for each element named recordElement
+// in the XML read from r, wherever it is, streaming the input so it can be
+// larger than memory. The line of a document is where its element starts.
+func readXML(r io.Reader, recordElement string, name string, add AddFunc) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != recordElement {
+			continue
+		}
+		line, _ := decoder.InputPos()
+		value, err := xmlElement(decoder, start)
+		if err != nil {
+			return err
+		}
+		document, ok := value.(map[string]interface{})
+		if !ok {
+			document = map[string]interface{}{"#text": value}
+		}
+		if err := add(line, document); err != nil {
+			return err
+		}
+	}
+}
+
+// xmlElement reads the rest of the element started by start and returns
+// its value. An element with only text is its text as a string; any other
+// is an object of its attributes, as "@name", its child elements, by name,
+// with those that are repeated as arrays, and its text, as "#text".
+// Namespace prefixes are dropped, and text is trimmed of spaces.
+func xmlElement(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	fields := map[string]interface{}{}
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		fields["@"+attr.Name.Local] = attr.Value
+	}
+	repeated := map[string]bool{}
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("the input ends inside <%s>", start.Name.Local)
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			child, err := xmlElement(decoder, token)
+			if err != nil {
+				return nil, err
+			}
+			key := token.Name.Local
+			switch existing, ok := fields[key]; {
+			case !ok:
+				fields[key] = child
+			case repeated[key]:
+				fields[key] = append(existing.([]interface{}), child)
+			default:
+				fields[key] = []interface{}{existing, child}
+				repeated[key] = true
+			}
+		case xml.CharData:
+			text.Write(token)
+		case xml.EndElement:
+			s := strings.TrimSpace(text.String())
+			if len(fields) == 0 {
+				return s, nil
+			}
+			if s != "" {
+				fields["#text"] = s
+			}
+			return fields, nil
+		}
+	}
+}
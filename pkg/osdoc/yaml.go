@@ -0,0 +1,77 @@
+/*
+Copyright © 2022 Will Fitzgerald <willf@github.com>
+*/
+package osdoc
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readYAML calls add with a document for each YAML document, separated by
+// "---" lines, read from r. The line of a document is where its content
+// starts, and empty documents are skipped.
+func readYAML(r io.Reader, name string, add AddFunc) error {
+	decoder := yaml.NewDecoder(r)
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(node.Content) == 0 {
+			continue
+		}
+		line := node.Content[0].Line
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			logErrorf("%s:%d: Error decoding YAML: %s", name, line, err)
+			if err := add(line, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		document, ok := yamlValue(value).(map[string]interface{})
+		if !ok {
+			logErrorf("%s:%d: document is not a YAML mapping; not adding", name, line)
+		}
+		if err := add(line, document); err != nil {
+			return err
+		}
+	}
+}
+
+// yamlValue returns the JSON value of a decoded YAML value: mappings as
+// objects, with their keys as strings, and timestamps as RFC 3339 strings.
+func yamlValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, v := range value {
+			value[key] = yamlValue(v)
+		}
+		return value
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			m[fmt.Sprint(key)] = yamlValue(v)
+		}
+		return m
+	case []interface{}:
+		for i, v := range value {
+			value[i] = yamlValue(v)
+		}
+		return value
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	}
+	return value
+}